@@ -10,14 +10,20 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 	
 	"../../pkg/phantom"
+	"../../pkg/proxy"
 )
 
 var coinName string
 var gitUrl string
 var gitParts []string
 var explorer string
+var proxyAddress string
+var timeout time.Duration
+
+var client *http.Client
 
 //SIMPLE UTILITY TO GENERATE A COINCONF FOR A GIVEN COIN.
 func main() {
@@ -26,9 +32,17 @@ func main() {
 	flag.StringVar(&coinName, "coin_name", "", "the name of the coin")
 	flag.StringVar(&gitUrl, "git_hub", "", "the git url")
 	flag.StringVar(&explorer, "explorer", "", "the bootstrap explorer")
+	flag.StringVar(&proxyAddress, "proxy", "", "the proxy to download the sources through, socks5://[user:password@]host:port or http://[user:password@]host:port")
+	flag.DurationVar(&timeout, "timeout", 30*time.Second, "the timeout of every download")
 
 	flag.Parse()
 
+	var err error
+	client, err = proxy.HTTPClient(proxyAddress, timeout)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	gitParts = strings.Split(gitUrl, "/")
 
 	if len(gitParts) == 5 {
@@ -41,6 +55,8 @@ func main() {
 	port := LoadPort()
 	magicMessage := LoadMagicMessage()
 	protocolVersion := LoadProtocolVersion()
+	minProtocolVersion := LoadMinProtocolVersion()
+	wifPrefix := LoadWIFPrefix()
 	sentinelVersion := LoadSentinelVersion()
 	daemonVersion := LoadDaemonVersion()
 
@@ -51,6 +67,7 @@ func main() {
 	}
 
 	coinConf.Magicbytes = magicBytes
+	coinConf.WIFPrefix = wifPrefix
 	coinConf.MagicMessage = magicMessage
 	coinConf.MagicMessageNewline = true
 
@@ -66,6 +83,14 @@ func main() {
 	}
 	coinConf.ProtocolNumber = uint(parsedProtocl)
 
+	if minProtocolVersion != "" {
+		parsedMinProtocol, err := strconv.Atoi(minProtocolVersion)
+		if err != nil {
+			log.Fatal("Error parsing minimum protocol version")
+		}
+		coinConf.MinProtocol = uint(parsedMinProtocol)
+	}
+
 	if sentinelVersion != "" {
 		coinConf.SentinelVersion = ConvertVersionHexToString(sentinelVersion)
 	}
@@ -97,6 +122,26 @@ func LoadMagicBytes() string {
 	return strings.ToUpper(result[3][1] + result[2][1] + result[1][1] + result[0][1])
 }
 
+func LoadWIFPrefix() string {
+	data, err := LoadFile(UrlForFile("chainparams.cpp"))
+	if err != nil {
+		log.Fatal()
+	}
+
+	//the main network comes first
+	re := regexp.MustCompile(`base58Prefixes\[SECRET_KEY\]\s*=\s*std::vector<unsigned char>\(1,\s*(\d+)\)`)
+	matches := re.FindStringSubmatch(data)
+	if len(matches) == 0 {
+		log.Fatal("No secret key prefix found.")
+	}
+
+	prefix, err := strconv.Atoi(matches[1])
+	if err != nil || prefix > 255 {
+		log.Fatal("Error parsing the secret key prefix")
+	}
+	return fmt.Sprintf("%02x", prefix)
+}
+
 func LoadPort() string {
 	data, err := LoadFile(UrlForFile("chainparams.cpp"))
 	if err != nil {
@@ -144,6 +189,21 @@ func LoadProtocolVersion() string {
 	return re.FindStringSubmatch(data)[1]
 }
 
+func LoadMinProtocolVersion() string {
+	data, err := LoadFile(UrlForFile("version.h"))
+	if err != nil {
+		log.Fatal()
+	}
+
+	re := regexp.MustCompile(`static const int MIN_PEER_PROTO_VERSION = (\d+)`)
+	matches := re.FindStringSubmatch(data)
+	if len(matches) > 0 {
+		return matches[1]
+	}
+
+	return ""
+}
+
 func LoadSentinelVersion() string {
 	data, err := LoadFile(UrlForFile("masternode.h"))
 	if err != nil {
@@ -192,7 +252,7 @@ func LoadDaemonVersion() string {
 }
 
 func LoadFile(url string) (string, error) {
-	response, err := http.Get(url)
+	response, err := client.Get(url)
 	if err != nil {
 		log.Printf("%s", err)
 		return "", err
@@ -0,0 +1,82 @@
+/**
+*    Copyright (C) 2019-present C2CV Holdings, LLC.
+*
+*    This program is free software: you can redistribute it and/or modify
+*    it under the terms of the Server Side Public License, version 1,
+*    as published by C2CV Holdings, LLC.
+*
+*    This program is distributed in the hope that it will be useful,
+*    but WITHOUT ANY WARRANTY; without even the implied warranty of
+*    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*    Server Side Public License for more details.
+*
+*    You should have received a copy of the Server Side Public License
+*    along with this program. If not, see
+*    <http://www.mongodb.com/licensing/server-side-public-license>.
+*
+*    As a special exception, the copyright holders give permission to link the
+*    code of portions of this program with the OpenSSL library under certain
+*    conditions as described in each individual source file and distribute
+*    linked combinations including the program with the OpenSSL library. You
+*    must comply with the Server Side Public License in all respects for
+*    all of the code used other than as permitted herein. If you modify file(s)
+*    with this exception, you may extend this exception to your version of the
+*    file(s), but you are not obligated to do so. If you do not wish to do so,
+*    delete this exception statement from your version. If you delete this
+*    exception statement from all source files in the program, then also delete
+*    it in the license file.
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"../../pkg/phantom"
+)
+
+// runCheck validates the coin and masternode configurations without
+// connecting to the network. It accepts the same flags as the daemon.
+func runCheck(args []string) {
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	registerFlags(flags)
+	flags.Parse(args)
+
+	var networks []*phantom.Network
+	for _, config := range loadNetworkConfigs(flags) {
+		networks = append(networks, phantom.NewNetwork(config, nil))
+	}
+
+	if !checkMasternodes(networks) {
+		os.Exit(1)
+	}
+}
+
+// checkMasternodes loads and validates the masternodes of every network and
+// prints all the problems found. It reports whether everything is valid.
+func checkMasternodes(networks []*phantom.Network) bool {
+	valid := true
+
+	for _, network := range networks {
+		entries, err := network.LoadMasternodes()
+		if err != nil {
+			valid = false
+
+			if confError, ok := err.(*phantom.MasternodeConfError); ok {
+				fmt.Printf("%s: %s: %d problem(s) found\n", network.Config.Name, confError.Path, len(confError.Problems))
+				for _, problem := range confError.Problems {
+					fmt.Println("\t" + problem)
+				}
+			} else {
+				fmt.Printf("%s: %s\n", network.Config.Name, err)
+			}
+			continue
+		}
+
+		fmt.Printf("%s: %s: %d masternode(s) OK\n", network.Config.Name, network.Config.MasternodeConf, len(entries))
+	}
+
+	return valid
+}
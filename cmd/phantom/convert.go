@@ -0,0 +1,72 @@
+/**
+*    Copyright (C) 2019-present C2CV Holdings, LLC.
+*
+*    This program is free software: you can redistribute it and/or modify
+*    it under the terms of the Server Side Public License, version 1,
+*    as published by C2CV Holdings, LLC.
+*
+*    This program is distributed in the hope that it will be useful,
+*    but WITHOUT ANY WARRANTY; without even the implied warranty of
+*    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*    Server Side Public License for more details.
+*
+*    You should have received a copy of the Server Side Public License
+*    along with this program. If not, see
+*    <http://www.mongodb.com/licensing/server-side-public-license>.
+*
+*    As a special exception, the copyright holders give permission to link the
+*    code of portions of this program with the OpenSSL library under certain
+*    conditions as described in each individual source file and distribute
+*    linked combinations including the program with the OpenSSL library. You
+*    must comply with the Server Side Public License in all respects for
+*    all of the code used other than as permitted herein. If you modify file(s)
+*    with this exception, you may extend this exception to your version of the
+*    file(s), but you are not obligated to do so. If you do not wish to do so,
+*    delete this exception statement from your version. If you delete this
+*    exception statement from all source files in the program, then also delete
+*    it in the license file.
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"../../pkg/phantom"
+)
+
+// runConvert turns a masternode.conf / masternode.txt into the structured
+// masternodeconf.json format.
+func runConvert(args []string) {
+	flags := flag.NewFlagSet("convert", flag.ExitOnError)
+
+	input := flags.String("masternode_conf", "masternode.txt", "The masternode.conf or masternode.txt file to convert.")
+	output := flags.String("out", "masternodeconf.json", "The destination of the structured masternode configuration.")
+	coin := flags.String("coin", "", "Optional coin name to store on every masternode.")
+	force := flags.Bool("force", false, "Overwrite the destination if it already exists.")
+	flags.Parse(args)
+
+	entries, err := phantom.LoadMasternodeFile(*input)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if _, err := os.Stat(*output); err == nil && !*force {
+		log.Fatal(*output, " already exists, use -force to overwrite it.")
+	}
+
+	for _, entry := range entries {
+		if entry.EpochAssumed {
+			log.Println("No epoch time found for", entry.Name, "using", entry.Epoch)
+		}
+	}
+
+	if err := phantom.WriteMasternodeConf(*output, entries, *coin); err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("Converted %d masternode(s) from %s to %s\n", len(entries), *input, *output)
+}
@@ -0,0 +1,171 @@
+/**
+*    Copyright (C) 2019-present C2CV Holdings, LLC.
+*
+*    This program is free software: you can redistribute it and/or modify
+*    it under the terms of the Server Side Public License, version 1,
+*    as published by C2CV Holdings, LLC.
+*
+*    This program is distributed in the hope that it will be useful,
+*    but WITHOUT ANY WARRANTY; without even the implied warranty of
+*    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*    Server Side Public License for more details.
+*
+*    You should have received a copy of the Server Side Public License
+*    along with this program. If not, see
+*    <http://www.mongodb.com/licensing/server-side-public-license>.
+*
+*    As a special exception, the copyright holders give permission to link the
+*    code of portions of this program with the OpenSSL library under certain
+*    conditions as described in each individual source file and distribute
+*    linked combinations including the program with the OpenSSL library. You
+*    must comply with the Server Side Public License in all respects for
+*    all of the code used other than as permitted herein. If you modify file(s)
+*    with this exception, you may extend this exception to your version of the
+*    file(s), but you are not obligated to do so. If you do not wish to do so,
+*    delete this exception statement from your version. If you delete this
+*    exception statement from all source files in the program, then also delete
+*    it in the license file.
+ */
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+
+	"../../pkg/keystore"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"golang.org/x/term"
+)
+
+const passphraseEnv = "PHANTOM_KEYSTORE_PASSPHRASE"
+
+// runKeys manages the encrypted keystore: phantom keys import|list|remove.
+func runKeys(args []string) {
+	if len(args) < 1 {
+		fmt.Println("usage: phantom keys import|list|remove [flags]")
+		os.Exit(2)
+	}
+
+	flags := flag.NewFlagSet("keys "+args[0], flag.ExitOnError)
+
+	path := flags.String("keystore", "keystore.json", "The encrypted keystore file.")
+	passphraseFile := flags.String("keystore_passphrase_file", "", "File holding the keystore passphrase. Defaults to the "+passphraseEnv+" environment variable, then to a prompt.")
+	alias := flags.String("alias", "", "The name the key is stored under (import and remove).")
+	keyFile := flags.String("key_file", "", "Read the private key to import from this file instead of prompting for it.")
+	flags.Parse(args[1:])
+
+	store, err := keystore.Open(*path)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	switch args[0] {
+	case "list":
+		for _, name := range store.Aliases() {
+			fmt.Println(name)
+		}
+
+	case "import":
+		if *alias == "" {
+			log.Fatal("-alias is required.")
+		}
+
+		unlockKeystore(store, *passphraseFile)
+
+		var privateKey string
+		if *keyFile != "" {
+			data, err := ioutil.ReadFile(*keyFile)
+			if err != nil {
+				log.Fatal(err)
+			}
+			privateKey = strings.TrimSpace(string(data))
+		} else {
+			privateKey = string(readSecret("Private key (WIF) for " + *alias + ": "))
+		}
+
+		if _, err := btcutil.DecodeWIF(privateKey); err != nil {
+			log.Fatal("Invalid private key: ", err)
+		}
+
+		if err := store.Put(*alias, privateKey); err != nil {
+			log.Fatal(err)
+		}
+
+		if err := store.Save(); err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Println("Imported the key of", *alias, "into", *path)
+		fmt.Println("Reference it as keystore:" + *alias + " in the masternode configuration.")
+
+	case "remove":
+		if *alias == "" {
+			log.Fatal("-alias is required.")
+		}
+
+		unlockKeystore(store, *passphraseFile)
+
+		if err := store.Remove(*alias); err != nil {
+			log.Fatal(err)
+		}
+
+		if err := store.Save(); err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Println("Removed the key of", *alias, "from", *path)
+
+	default:
+		fmt.Println("usage: phantom keys import|list|remove [flags]")
+		os.Exit(2)
+	}
+}
+
+// unlockKeystore unlocks the keystore with the passphrase read from the
+// passphrase file, the environment or a prompt, in that order.
+func unlockKeystore(store *keystore.Keystore, passphraseFile string) {
+	var passphrase []byte
+
+	if passphraseFile != "" {
+		data, err := ioutil.ReadFile(passphraseFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		passphrase = []byte(strings.TrimRight(string(data), "\r\n"))
+	} else if value, ok := os.LookupEnv(passphraseEnv); ok {
+		passphrase = []byte(value)
+	} else {
+		passphrase = readSecret("Keystore passphrase: ")
+	}
+
+	if err := store.Unlock(passphrase); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// readSecret prompts for a value without echoing it when stdin is a terminal.
+func readSecret(prompt string) []byte {
+	fmt.Fprint(os.Stderr, prompt)
+
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		secret, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return secret
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		log.Fatal(err)
+	}
+	return []byte(strings.TrimRight(line, "\r\n"))
+}
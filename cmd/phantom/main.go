@@ -30,16 +30,26 @@
 package main
 
 import (
-	"errors"
+	"context"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 
+	"../../pkg/api"
+	"../../pkg/keystore"
+	"../../pkg/metrics"
 	"../../pkg/phantom"
+	"../../pkg/powhash"
+	"../../pkg/proxy"
 	"../../pkg/socket/wire"
 	"../../pkg/storage"
 
@@ -50,464 +60,480 @@ var minConnections uint
 var maxConnections uint
 var noBlockMinutes uint
 
-var magicBytes uint32
+var magicHex string
+var magicMsgNewLine bool
+var protocolNum uint
+var minProtocol uint
 var defaultPort uint
-var protocolNumber uint32
 var magicMessage string
 var bootstrapIPs string
-var bootstrapHash chainhash.Hash
+var bootstrapHashStr string
 var bootstrapExplorer string
-var sentinelVersion uint32
-var daemonVersion uint32
-var masternodeConf string
-var coinCon phantom.CoinConf
+var bootstrapType string
+var bootstrapQuorum uint
+var sentinelString string
+var daemonString string
+var broadcastListen bool
 var dbPath string
 var userAgent string
-var cachedPeers error
-var numberConnections int
+var apiListen string
+var coinConfString string
+var masternodeConfString string
+var keystorePath string
+var keystorePassphraseFile string
+var apiTokenFile string
+var proxyAddress string
+var listenAddress string
+var maxInbound uint
 
 const VERSION = "1.2.10"
 
-var StartTime time.Time
+const defaultUserAgent = "True Nodes - Hospedagem de Masternodes"
 
-func main() {
-
-	//disable all logging
-	//log.SetOutput(ioutil.Discard)
+//exit codes of the health checks, so supervisors can tell them apart
+const (
+	exitMinConnections = 2
+	exitNoBlocks       = 3
+)
 
-	StartTime := time.Now()
-
-	var magicHex string
-	var magicMsgNewLine bool
-	var protocolNum uint
-	var bootstrapHashStr string
-	var sentinelString string
-	var daemonString string
-	var coinConfString string
-	var broadcastListen bool
-
-	flag.StringVar(&coinConfString, "coin_conf", "coinconf.json", "Name of the file to load the coin information from.")
-	flag.StringVar(&masternodeConf, "masternode_conf", "masternodeconf.json", "Name of the file to load the masternode information from.")
-	flag.UintVar(&minConnections, "min_connections", 0, "the minimum acceptable number of peers to maintain. If not satified in 5 minutes after app starts, then exit (default 0, never exit)")
-	flag.UintVar(&maxConnections, "max_connections", 64, "the maximum number of peers to maintain")
-	flag.UintVar(&noBlockMinutes, "noblock_minutes", 0, "Maximum value, in minutes, without receiving block signaling from the network. If you don't receive it in that time, close the software. Start counting after 5 minutes software started. (default 0, never exit)")
-	flag.StringVar(&magicHex, "magicbytes", "", "a hex string for the magic bytes")
-	flag.UintVar(&defaultPort, "port", 0, "the default port number")
-	flag.UintVar(&protocolNum, "protocol_number", 0, "the protocol number to connect and ping with")
-	flag.StringVar(&magicMessage, "magic_message", "", "the signing message")
-	flag.BoolVar(&magicMsgNewLine, "magic_message_newline", true, "add a new line to the magic message")
-	flag.StringVar(&bootstrapIPs, "bootstrap_ips", "", "IP addresses to bootstrap the network (i.e. \"1.1.1.1:1234,2.2.2.2:1234\")")
-	flag.StringVar(&bootstrapHashStr, "bootstrap_hash", "", "Hash to bootstrap the pings with ( top - 12 )")
-	flag.StringVar(&bootstrapExplorer, "bootstrap_url", "", "Explorer to bootstrap from.")
-	flag.StringVar(&sentinelString, "sentinel_version", "", "The string to use for the sentinel version number (i.e. 1.20.0)")
-	flag.StringVar(&daemonString, "daemon_version", "", "The string to use for the sentinel version number (i.e. 1.20.0)")
-	flag.StringVar(&userAgent, "user_agent", "True Nodes - Hospedagem de Masternodes", "The user agent string to connect to remote peers with.")
-	flag.BoolVar(&broadcastListen, "broadcast_listen", true, "If set to true, the phantom will listen for new broadcasts and cache them for 4 hours.")
-	flag.StringVar(&dbPath, "db_path", "./peers.db", "The destination for database storage.")
-	flag.Parse()
+func main() {
 
-	if coinConfString != "" {
-		coinInfo, err := phantom.LoadCoinConf(coinConfString)
-		if err != nil {
-			log.Println("Error reading coin configuration information from:", coinConfString)
-		} else {
-			//load all the flags with the coin conf information
-			//only overwrite default values
-			if magicHex == "" {
-				magicHex = coinInfo.Magicbytes
-			}
-			if defaultPort == 0 {
-				defaultPort = coinInfo.Port
-			}
-			if protocolNum == 0 {
-				protocolNum = coinInfo.ProtocolNumber
-			}
-			if magicMessage == "" {
-				magicMessage = coinInfo.MagicMessage
-			}
-			if magicMsgNewLine && !coinInfo.MagicMessageNewline {
-				magicMsgNewLine = false
-			}
-			if bootstrapIPs == "" {
-				bootstrapIPs = coinInfo.BootstrapIPs
-			}
-			if bootstrapExplorer == "" {
-				bootstrapExplorer = coinInfo.BootstrapURL
-			}
-			if sentinelString == "" {
-				sentinelString = coinInfo.SentinelVersion
-			}
-			if daemonString == "" {
-				daemonString = coinInfo.DaemonVersion
-			}
-			if userAgent == "True Nodes - Hospedagem de Masternodes" && coinInfo.UserAgent != "" {
-				userAgent = coinInfo.UserAgent
-			}
-			if dbPath == "" {
-				dbPath = "peers.db"
-			}
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "convert":
+			runConvert(os.Args[2:])
+			return
+		case "keys":
+			runKeys(os.Args[2:])
+			return
+		case "check":
+			runCheck(os.Args[2:])
+			return
+		case "mnb":
+			runMnb(os.Args[2:])
+			return
 		}
 	}
 
-	magicMsgNewLine = true
+	//disable all logging
+	//log.SetOutput(ioutil.Discard)
 
-	magicBytes64, _ := strconv.ParseUint(magicHex, 16, 32)
-	magicBytes = uint32(magicBytes64)
+	startTime := time.Now()
 
-	protocolNumber = uint32(protocolNum)
+	registerFlags(flag.CommandLine)
+	flag.Parse()
 
-	if sentinelString != "" {
-		//fmt.Println("ENABLING SENTINEL.")
-		sentinelVersion = phantom.ConvertVersionStringToInt(sentinelString)
-	}
+	configs := loadNetworkConfigs(flag.CommandLine)
 
-	if daemonString != "" {
-		//fmt.Println("ENABLING DAEMON.")
-		daemonVersion = phantom.ConvertVersionStringToInt(daemonString)
+	if dbPath == "" {
+		dbPath = "peers.db"
 	}
 
-	if magicMsgNewLine {
-		magicMessage = magicMessage + "\n"
+	db, err := storage.InitialiseDB(dbPath)
+	if err != nil {
+		log.Fatal("An error occurred initialising the database")
+	} else {
+		log.Println("Database was initialised:", db)
 	}
 
-	var connectionSet = make(map[string]*phantom.PingerConnection)
-	var peerSet = make(map[string]wire.NetAddress)
-	var broadcastSet = make(map[string]wire.MsgMNB)
-
-	var waitGroup sync.WaitGroup
-
-	if bootstrapIPs != "" {
-		addresses := phantom.SplitAddressList(bootstrapIPs)
-
-		if uint(len(addresses)) > maxConnections {
-			addresses = addresses[:maxConnections-1]
-		}
-
-		for _, address := range addresses {
-			peerSet[address.IP.String()] = address
-		}
+	var networks []*phantom.Network
+	for _, config := range configs {
+		networks = append(networks, phantom.NewNetwork(config, db))
 	}
 
-	addrProcessingChannel := make(chan wire.NetAddress, 1500)
-	hashProcessingChannel := make(chan chainhash.Hash, 1500)
-
-	var broadcastProcessingChannel chan wire.MsgMNB
-	if broadcastListen {
-		broadcastProcessingChannel = make(chan wire.MsgMNB, 1500)
+	//validate every masternode before any network activity
+	if !checkMasternodes(networks) {
+		log.Fatal("Invalid masternode configuration, nothing has been started.")
 	}
 
-	hashQueue := phantom.NewQueue(12)
-
-	if bootstrapExplorer != "" {
-		//check for a trailing slash
-		if bootstrapExplorer[len(bootstrapExplorer)-1] == '/' {
-			bootstrapExplorer = bootstrapExplorer[0 : len(bootstrapExplorer)-1]
-		}
-
-		bootstrapper := phantom.Bootstrapper{bootstrapExplorer}
-		var err error
-		bootstrapHash, err = bootstrapper.LoadBlockHash()
-
-		empthHash := chainhash.Hash{}
-		if err != nil {
-			log.Fatal("Unable to bootstrap using the explorer url provided. ", err)
+	for _, network := range networks {
+		if err := network.Bootstrap(); err != nil {
+			network.Logger.Fatal(err)
 		}
-
-		if bootstrapHash == empthHash {
-			log.Fatal("Unable to bootstrap using the explorer url provided. Invalid result returned.")
-		}
-
-		peers, _ := bootstrapper.LoadPossiblePeers(uint16(defaultPort))
-
-		for _, peer := range peers {
-			if len(peerSet) < int(maxConnections) {
-				peerSet[peer.IP.String()] = peer
-			} else {
-				break //exit early
-			}
-		}
-
-	} else {
-		chainhash.Decode(&bootstrapHash, bootstrapHashStr)
-		hashQueue.Push(&bootstrapHash)
 	}
 
 	phantom.Preamble(VERSION)
 
 	time.Sleep(10 * time.Second)
 
-	fmt.Println("--USING THE FOLLOWING SETTINGS--")
-	fmt.Println("Coin configuration: ", coinConfString)
-	fmt.Println("Masternode configuration: ", masternodeConf)
-	fmt.Println("Magic Bytes: ", magicHex)
-	fmt.Println("Magic Message: ", magicMessage)
-	fmt.Println("Magic Message Newline: ", magicMsgNewLine)
-	fmt.Println("Protocol Number: ", protocolNumber)
-	fmt.Println("Bootstrap IPs: ", bootstrapIPs)
-	fmt.Println("Default Port: ", defaultPort)
-	fmt.Println("Hash: ", bootstrapHash)
-	fmt.Println("Sentinel Version: ", sentinelVersion)
-	fmt.Println("Daemon Version: ", daemonVersion)
-	fmt.Println("Listen for broadcasts: ", broadcastListen)
-	fmt.Println()
-	fmt.Println("Minimum connections: ", minConnections)
-	fmt.Println("Maximum connections: ", maxConnections)
-	fmt.Println("Maximum time without blocks: ", noBlockMinutes, " minutes")
-	fmt.Println("\n\n")
-
-	db, err := storage.InitialiseDB(dbPath)
-	if err != nil {
-		log.Fatal("An error occurred initialising the database")
-	} else {
-		log.Println("Database was initialised:", db)
+	for _, network := range networks {
+		network.PrintSettings()
 	}
+	fmt.Println()
 
-	cachedPeers = storage.LoadPeersFromDB(db)
-
-	for _, ip := range peerSet {
-		//make the ping channel
-		pingChannel := make(chan phantom.MasternodePing, 1500)
-
-		waitGroup.Add(1)
+	var waitGroup sync.WaitGroup
 
-		pinger := phantom.PingerConnection{
-			MagicBytes:      magicBytes,
-			IpAddress:       ip.IP.String(),
-			Port:            uint16(ip.Port),
-			ProtocolNumber:  protocolNumber,
-			SentinelVersion: sentinelVersion,
-			DaemonVersion:   daemonVersion,
-			BootstrapHash:   bootstrapHash,
-			PingChannel:     pingChannel,
-			AddrChannel:     addrProcessingChannel,
-			HashChannel:     hashProcessingChannel,
-			Status:          0,
-			WaitGroup:       &waitGroup,
-		}
+	ctx, cancel := context.WithCancel(context.Background())
 
-		//not ideal
-		if broadcastListen {
-			pinger.BroadcastChannel = broadcastProcessingChannel
+	for _, network := range networks {
+		if err := network.Start(ctx, &waitGroup); err != nil {
+			network.Logger.Fatal(err)
 		}
-
-		//make a client
-		connectionSet[pinger.IpAddress] = &pinger
-
-		go pinger.Start(userAgent)
 	}
 
-	pingGeneratorChannel := make(chan phantom.MasternodePing, 1500)
+	go reloadOnHangup(networks)
+	go cancelOnSignal(cancel)
 
-	waitGroup.Add(1)
+	//a failing network stops the whole process
+	for _, network := range networks {
+		go func(network *phantom.Network) {
+			<-network.Done()
+			cancel()
+		}(network)
+	}
 
-	if broadcastListen {
-		go processNewBroadcasts(broadcastProcessingChannel, broadcastSet)
+	if apiListen != "" {
+		server := api.NewServer(networks)
+		server.Handle("/metrics", metrics.Handler())
+		server.RequireToken(readAPIToken(apiTokenFile))
+		go func() {
+			log.Fatal(server.ListenAndServe(apiListen))
+		}()
 	}
 
-	go processNewAddresses(addrProcessingChannel, peerSet)
-	go processNewHashes(hashProcessingChannel, hashQueue)
-	go sendPings(connectionSet, peerSet, pingGeneratorChannel, addrProcessingChannel, hashProcessingChannel, broadcastProcessingChannel, waitGroup)
-	go generatePings(pingGeneratorChannel, hashQueue, magicMessage, broadcastSet)
+	elapsed := time.Since(startTime)
+	log.Printf("Started %d network(s) in %s\n", len(networks), elapsed)
 
 	waitGroup.Wait()
 
-	elapsed := time.Since(StartTime)
-	fmt.Println("Started in %s", elapsed)
+	if err := db.Close(); err != nil {
+		log.Println("Unable to close the database:", err)
+	}
 
-	StartTime = time.Now()
+	os.Exit(exitCode(networks))
 }
 
-func generatePings(pingChannel chan phantom.MasternodePing, queue *phantom.Queue,
-	magicMessage string, broadcastSet map[string]wire.MsgMNB) {
+// cancelOnSignal cancels the context on SIGINT or SIGTERM.
+func cancelOnSignal(cancel context.CancelFunc) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
 
-	for {
-		phantom.GeneratePingsFromMasternodeFile(
-			masternodeConf,
-			pingChannel,
-			queue,
-			magicMessage,
-			sentinelVersion,
-			daemonVersion,
-			broadcastSet,
-		)
+	sig := <-signals
+	log.Println(sig, "received, shutting down.")
+	cancel()
 
-		time.Sleep((time.Minute * 10) + (time.Second * 5))
-	}
+	//a second signal skips the clean shut down
+	<-signals
+	os.Exit(1)
 }
 
-func processNewHashes(hashChannel chan chainhash.Hash, queue *phantom.Queue) {
-	for {
-		hash := <-hashChannel
-
-		//log.Println("Adding hash to queue: ", hash.String(), "(", queue.count, ")")
-
-		queue.Push(&hash)
-		for queue.Len() > 12 { //clear the queue until we're at 12 entries
-			queue.Pop()
-			//log.Println("Removing hash from queue: ", popped.String(), "(", queue.count, ")")
+// exitCode returns the exit code matching the health check that stopped the
+// first failing network, 0 when every network was shut down cleanly.
+func exitCode(networks []*phantom.Network) int {
+	for _, network := range networks {
+		switch network.Err() {
+		case phantom.ErrMinConnections:
+			return exitMinConnections
+		case phantom.ErrNoBlocks:
+			return exitNoBlocks
 		}
 	}
+	return 0
 }
 
-func processNewBroadcasts(broadcastChannel chan wire.MsgMNB, broadcastSet map[string]wire.MsgMNB) {
-	for {
+// registerFlags defines the daemon flags on the flag set, they are shared by
+// the daemon and the check command.
+func registerFlags(flags *flag.FlagSet) {
+	flags.StringVar(&coinConfString, "coin_conf", "coinconf.json", "Name of the file to load the coin information from. Several coins can be served at once with a comma separated list (i.e. \"pac.json,ands.json\")")
+	flags.StringVar(&masternodeConfString, "masternode_conf", "masternodeconf.json", "Name of the file to load the masternode information from. Provide one file per coin_conf entry, in the same order, when serving several coins")
+	flags.UintVar(&minConnections, "min_connections", 0, "the minimum acceptable number of peers to maintain. If not satified in 5 minutes after app starts, then exit (default 0, never exit)")
+	flags.UintVar(&maxConnections, "max_connections", 64, "the maximum number of peers to maintain")
+	flags.UintVar(&noBlockMinutes, "noblock_minutes", 0, "Maximum value, in minutes, without receiving block signaling from the network. If you don't receive it in that time, close the software. Start counting after 5 minutes software started. (default 0, never exit)")
+	flags.StringVar(&magicHex, "magicbytes", "", "a hex string for the magic bytes")
+	flags.UintVar(&defaultPort, "port", 0, "the default port number")
+	flags.UintVar(&protocolNum, "protocol_number", 0, "the protocol number to connect and ping with")
+	flags.UintVar(&minProtocol, "min_protocol", 0, "the lowest protocol number accepted from the peers, older peers are banned for 6 hours (default the protocol_number)")
+	flags.StringVar(&magicMessage, "magic_message", "", "the signing message")
+	flags.BoolVar(&magicMsgNewLine, "magic_message_newline", true, "add a new line to the magic message")
+	flags.StringVar(&bootstrapIPs, "bootstrap_ips", "", "IP addresses to bootstrap the network (i.e. \"1.1.1.1:1234,2.2.2.2:1234\")")
+	flags.StringVar(&bootstrapHashStr, "bootstrap_hash", "", "Hash to bootstrap the pings with ( top - 12 )")
+	flags.StringVar(&bootstrapExplorer, "bootstrap_url", "", "Explorers to bootstrap from (i.e. \"https://explorer1,https://explorer2\")")
+	flags.StringVar(&bootstrapType, "bootstrap_type", "", "The API of the bootstrap_url explorers, one for all or one per explorer: "+strings.Join(phantom.BootstrapTypes, ", ")+" (default iquidus)")
+	flags.UintVar(&bootstrapQuorum, "bootstrap_quorum", 0, "The number of explorers that must agree on the bootstrap hash (default a majority)")
+	flags.StringVar(&sentinelString, "sentinel_version", "", "The string to use for the sentinel version number (i.e. 1.20.0)")
+	flags.StringVar(&daemonString, "daemon_version", "", "The string to use for the sentinel version number (i.e. 1.20.0)")
+	flags.StringVar(&userAgent, "user_agent", defaultUserAgent, "The user agent string to connect to remote peers with.")
+	flags.BoolVar(&broadcastListen, "broadcast_listen", true, "If set to true, the phantom will listen for new broadcasts and cache them for 4 hours.")
+	flags.StringVar(&dbPath, "db_path", "./peers.db", "The destination for database storage.")
+	flags.StringVar(&keystorePath, "keystore", "", "Encrypted keystore holding the keys referenced as keystore:NAME. Disabled when empty.")
+	flags.StringVar(&keystorePassphraseFile, "keystore_passphrase_file", "", "File holding the keystore passphrase. Defaults to the "+passphraseEnv+" environment variable, then to a prompt.")
+	flags.StringVar(&proxyAddress, "proxy", "", "Proxy to reach the peers and explorers through, socks5://[user:password@]host:port or http://[user:password@]host:port (i.e. 127.0.0.1:9050 for a local Tor daemon). Overridden by the proxy of the coin configuration. The .onion peers are only used with a proxy.")
+	flags.StringVar(&listenAddress, "listen", "", "Address to accept inbound peer connections on (i.e. 0.0.0.0:9999). Disabled when empty.")
+	flags.UintVar(&maxInbound, "max_inbound", 16, "the maximum number of inbound peers, per coin")
+	flags.StringVar(&apiListen, "api_listen", "", "Address to serve the local status api on (i.e. 127.0.0.1:8089). Disabled when empty.")
+	flags.StringVar(&apiTokenFile, "api_token_file", "", "File holding the token required to import broadcasts and lift bans through the api. Defaults to the "+apiTokenEnv+" environment variable; without a token these requests are only accepted from the local host.")
+}
 
-		mnb := <-broadcastChannel
+// loadNetworkConfigs builds the configuration of every coin given on the
+// command line, unlocking the keystore when one is configured.
+func loadNetworkConfigs(flags *flag.FlagSet) []phantom.NetworkConfig {
+	coinConfs := strings.Split(coinConfString, ",")
+	masternodeConfs := strings.Split(masternodeConfString, ",")
 
-		broadcastSet[mnb.Vin.PreviousOutPoint.Hash.String()+
-			":"+strconv.Itoa(int(mnb.Vin.PreviousOutPoint.Index))] = mnb
+	if len(coinConfs) != len(masternodeConfs) {
+		log.Fatal("The number of coin_conf and masternode_conf entries must match.")
 	}
-}
 
-func processNewAddresses(addrChannel chan wire.NetAddress, peerSet map[string]wire.NetAddress) {
-	// Cache peers
-	db, err := storage.InitialiseDB(dbPath)
-	if err != nil {
-		log.Fatal(err)
+	if len(coinConfs) > 1 && coinFlagsSet(flags) {
+		log.Fatal("Coin specific flags can only be used with a single coin_conf.")
 	}
-	for {
-		addr := <-addrChannel
 
-		if addr.IP.To4() == nil {
-			continue
+	var keys phantom.KeyProvider
+	if keystorePath != "" {
+		store, err := keystore.Open(keystorePath)
+		if err != nil {
+			log.Fatal(err)
 		}
 
-		peerSet[addr.IP.String()] = addr
-		err = storage.CachePeerToDB(db, addr.IP.String())
-	}
-}
-
-func getNextPeer(connectionSet map[string]*phantom.PingerConnection, peerSet map[string]wire.NetAddress) (returnValue wire.NetAddress, err error) {
-	for peer := range peerSet {
-		if _, ok := connectionSet[peer]; !ok {
-			//we have a peer that isn't in the conncetion list return it
-			returnValue = peerSet[peer]
+		unlockKeystore(store, keystorePassphraseFile)
+		log.Println("Keystore unlocked:", keystorePath)
 
-			//remove the peer from the connection list
-			delete(peerSet, peer)
-			log.Println("New peer found: ", peer, " (", numberConnections, "/", maxConnections, ")")
-
-			return returnValue, nil
-		}
+		keys = store
 	}
-	return returnValue, errors.New("No peers found.")
-}
 
-func sendPings(connectionSet map[string]*phantom.PingerConnection, peerSet map[string]wire.NetAddress, pingChannel chan phantom.MasternodePing, addrChannel chan wire.NetAddress, hashChannel chan chainhash.Hash, broadcastChannel chan wire.MsgMNB, waitGroup sync.WaitGroup) {
+	var configs []phantom.NetworkConfig
 
-	time.Sleep(10 * time.Second) //hack to work around .Wait() race condition on fast start-ups
+	for i := range coinConfs {
+		config := loadNetworkConfig(strings.TrimSpace(coinConfs[i]), strings.TrimSpace(masternodeConfs[i]))
+		config.Keys = keys
 
-	for {
-		ping := <-pingChannel
+		for _, previous := range configs {
+			if previous.Name == config.Name {
+				log.Fatal("The coin ", config.Name, " has been configured more than once.")
+			}
+		}
 
-		sleepTime := ping.PingTime.Sub(time.Now())
+		configs = append(configs, config)
+	}
 
-		t := ping.PingTime.UTC()
+	return configs
+}
 
-		if sleepTime > 0 {
-			// log.Println(ping.Name, t.Format("15:04:05"), "sleeping for ", sleepTime.String())
-			time.Sleep(sleepTime)
-		} else {
-			log.Println(ping.Name, t.Format("15:04:05"), "awake")
-		}
+// reloadOnHangup reloads the masternode files of every network on SIGHUP.
+func reloadOnHangup(networks []*phantom.Network) {
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
 
-		//send the ping
-		// Iterate through list and print its contents.
-		var newConnectionSet = make(map[string]*phantom.PingerConnection)
-
-		for _, pinger := range connectionSet {
-			status := pinger.GetStatus()
-
-			if status < 0 || len(pinger.PingChannel) > 10 { //the pinger has had an error, close the channel
-				fmt.Println("There's been an error, closing connection to ", pinger.IpAddress)
-				pinger.SetStatus(-1)
-
-				log.Printf("%s : Closing down the ping channel.\n", pinger.IpAddress)
-				close(pinger.PingChannel) // don't add the closed pinger to the connectionArray
-
-				//remove the peer from the peerSet
-				delete(peerSet, pinger.IpAddress)
-			} else {
-				if status > 0 {
-					log.Printf("%s : Pinging.", pinger.IpAddress)
-					pinger.PingChannel <- ping //only ping on connected pingers (1)
-				}
-				// this filters out bad connections, re-add unconnected peers just to be safe
-				// log.Printf("Re-added %s to the queue (channel #: %d).\n", pinger.IpAddress, len(pinger.PingChannel))
-				newConnectionSet[pinger.IpAddress] = pinger
+	for range hangups {
+		for _, network := range networks {
+			network.Logger.Println("SIGHUP received, reloading masternodes.")
+			if err := network.ReloadMasternodes(); err != nil {
+				network.Logger.Println("Keeping the previous masternodes.", err)
 			}
 		}
+	}
+}
 
-		//replace the pointer
-		connectionSet = newConnectionSet
-		numberConnections = len(connectionSet)
-
-		//spawn off extra nodes here if we don't have enough
-		if len(connectionSet) < int(maxConnections) {
+// apiTokenEnv holds the api token when no token file is given.
+const apiTokenEnv = "PHANTOM_API_TOKEN"
 
-			//	log.Println("Under the max connection count, spawning new peer (", len(connectionSet), " / ", maxConnections, ")")
+// readAPIToken returns the api token read from the token file or the
+// environment, empty when neither is set.
+func readAPIToken(tokenFile string) string {
+	if tokenFile == "" {
+		return os.Getenv(apiTokenEnv)
+	}
 
-			for i := 0; i < int(maxConnections)-len(connectionSet); i++ {
+	data, err := ioutil.ReadFile(tokenFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return strings.TrimSpace(string(data))
+}
 
-				//spawn off a new connection
-				peer, err := getNextPeer(connectionSet, peerSet)
+// coinFlagsSet reports whether any of the flags that only make sense for a
+// single coin have been provided on the command line.
+func coinFlagsSet(flags *flag.FlagSet) bool {
+	coinFlags := map[string]bool{
+		"magicbytes":            true,
+		"port":                  true,
+		"protocol_number":       true,
+		"min_protocol":          true,
+		"magic_message":         true,
+		"magic_message_newline": true,
+		"bootstrap_ips":         true,
+		"bootstrap_hash":        true,
+		"bootstrap_url":         true,
+		"bootstrap_type":        true,
+		"bootstrap_quorum":      true,
+		"sentinel_version":      true,
+		"daemon_version":        true,
+		"listen":                true,
+	}
 
-				if err != nil {
-					//	log.Println("No new peers found.")
-					continue
-				}
+	found := false
+	flags.Visit(func(f *flag.Flag) {
+		if coinFlags[f.Name] {
+			found = true
+		}
+	})
+	return found
+}
 
-				newPingChannel := make(chan phantom.MasternodePing, 1500)
+// loadNetworkConfig merges the coin configuration file with the command line
+// flags. Flags only overwrite the values that have been set explicitly.
+func loadNetworkConfig(coinConfPath string, masternodeConfPath string) phantom.NetworkConfig {
+	coinMagicHex := magicHex
+	coinPort := defaultPort
+	coinProtocolNum := protocolNum
+	coinMinProtocol := minProtocol
+	coinMagicMessage := magicMessage
+	coinMagicMsgNewLine := magicMsgNewLine
+	coinBootstrapIPs := bootstrapIPs
+	coinBootstrapExplorer := bootstrapExplorer
+	coinBootstrapType := bootstrapType
+	coinBootstrapQuorum := bootstrapQuorum
+	coinSentinelString := sentinelString
+	coinDaemonString := daemonString
+	coinUserAgent := userAgent
+	coinWIFPrefix := ""
+	coinPowAlgorithm := ""
+	coinPingFormat := ""
+	coinProxy := proxyAddress
+	coinListen := listenAddress
+
+	name := strings.TrimSuffix(filepath.Base(coinConfPath), filepath.Ext(coinConfPath))
+
+	if coinConfPath != "" {
+		coinInfo, err := phantom.LoadCoinConf(coinConfPath)
+		if err != nil {
+			log.Println("Error reading coin configuration information from:", coinConfPath)
+		} else {
+			//load all the flags with the coin conf information
+			//only overwrite default values
+			if coinInfo.Name != "" {
+				name = coinInfo.Name
+			}
+			if coinMagicHex == "" {
+				coinMagicHex = coinInfo.Magicbytes
+			}
+			if coinPort == 0 {
+				coinPort = coinInfo.Port
+			}
+			if coinProtocolNum == 0 {
+				coinProtocolNum = coinInfo.ProtocolNumber
+			}
+			if coinMinProtocol == 0 {
+				coinMinProtocol = coinInfo.MinProtocol
+			}
+			if coinMagicMessage == "" {
+				coinMagicMessage = coinInfo.MagicMessage
+			}
+			if coinMagicMsgNewLine && !coinInfo.MagicMessageNewline {
+				coinMagicMsgNewLine = false
+			}
+			if coinBootstrapIPs == "" {
+				coinBootstrapIPs = coinInfo.BootstrapIPs
+			}
+			if coinBootstrapExplorer == "" {
+				coinBootstrapExplorer = coinInfo.BootstrapURL
+			}
+			if coinBootstrapType == "" {
+				coinBootstrapType = coinInfo.BootstrapType
+			}
+			if coinBootstrapQuorum == 0 {
+				coinBootstrapQuorum = coinInfo.BootstrapQuorum
+			}
+			if coinSentinelString == "" {
+				coinSentinelString = coinInfo.SentinelVersion
+			}
+			if coinDaemonString == "" {
+				coinDaemonString = coinInfo.DaemonVersion
+			}
+			if coinUserAgent == defaultUserAgent && coinInfo.UserAgent != "" {
+				coinUserAgent = coinInfo.UserAgent
+			}
+			coinWIFPrefix = coinInfo.WIFPrefix
+			coinPowAlgorithm = coinInfo.PowAlgorithm
+			coinPingFormat = coinInfo.PingFormat
+			if coinInfo.Proxy != "" {
+				coinProxy = coinInfo.Proxy
+			}
+			if coinListen == "" {
+				coinListen = coinInfo.Listen
+			}
+		}
+	}
 
-				// intentionally don't provide a bootstraphash to prevent
-				// duplicate data downloads for unneeded blocks
-				newPinger := phantom.PingerConnection{
-					MagicBytes:      magicBytes,
-					IpAddress:       peer.IP.String(),
-					Port:            peer.Port,
-					ProtocolNumber:  protocolNumber,
-					SentinelVersion: sentinelVersion,
-					DaemonVersion:   daemonVersion,
-					PingChannel:     newPingChannel,
-					AddrChannel:     addrChannel,
-					HashChannel:     hashChannel,
-					Status:          0,
-					WaitGroup:       &waitGroup,
-				}
+	coinMagicMsgNewLine = true
 
-				if broadcastChannel != nil {
-					newPinger.BroadcastChannel = broadcastChannel
-				}
+	//the peers must speak the protocol we ping with unless told otherwise
+	if coinMinProtocol == 0 {
+		coinMinProtocol = coinProtocolNum
+	}
+	if coinMinProtocol == 0 {
+		log.Fatal("No min_protocol nor protocol_number in ", coinConfPath, ", the peers protocol cannot be checked")
+	}
+	if coinMinProtocol > coinProtocolNum {
+		log.Fatal("The min_protocol ", coinMinProtocol, " of ", coinConfPath, " is above its protocol_number ", coinProtocolNum)
+	}
 
-				//make a client
-				newConnectionSet[newPinger.IpAddress] = &newPinger
-				//connectionList = nil //release for the GC
+	if _, err := powhash.Lookup(coinPowAlgorithm); err != nil {
+		log.Fatal("Unsupported pow_algorithm ", coinPowAlgorithm, " in ", coinConfPath,
+			", supported algorithms: ", strings.Join(powhash.Names(), ", "))
+	}
 
-				waitGroup.Add(1)
-				go newPinger.Start(userAgent)
+	if _, err := wire.ParsePingFormat(coinPingFormat); err != nil {
+		log.Fatal("Unsupported ping_format ", coinPingFormat, " in ", coinConfPath,
+			", supported formats: ", strings.Join(wire.PingFormats, ", "))
+	}
 
-				fmt.Println("Opened a new connection to ", newPinger.IpAddress, " (", numberConnections, "/", maxConnections, ")")
-			}
+	if coinProxy != "" && coinProxy != proxy.None {
+		if _, err := proxy.Parse(coinProxy); err != nil {
+			log.Fatal("Invalid proxy for ", coinConfPath, ": ", err)
 		}
+	}
 
-		if numberConnections > 0 && numberConnections < int(minConnections) && time.Now().Sub(StartTime).Seconds() > 300 {
-			var runningTime time.Duration = time.Now().Sub(StartTime)
+	if coinBootstrapExplorer != "" {
+		if _, err := phantom.NewBootstrapQuorum(coinBootstrapExplorer, coinBootstrapType, coinBootstrapQuorum, nil); err != nil {
+			log.Fatal("Invalid explorer settings in ", coinConfPath, ": ", err,
+				", supported types: ", strings.Join(phantom.BootstrapTypes, ", "))
+		}
+	}
 
-			log.Println("Minimum number of connections (", minConnections, ") not satisfied. Application has been running for ", runningTime)
-			log.Println("Closing Application now")
+	magicBytes64, _ := strconv.ParseUint(coinMagicHex, 16, 32)
+
+	config := phantom.NetworkConfig{
+		Name:              strings.ToUpper(name),
+		CoinConf:          coinConfPath,
+		MasternodeConf:    masternodeConfPath,
+		MagicBytes:        uint32(magicBytes64),
+		Port:              uint16(coinPort),
+		ProtocolNumber:    uint32(coinProtocolNum),
+		MinProtocol:       uint32(coinMinProtocol),
+		MagicMessage:      coinMagicMessage,
+		BootstrapIPs:      coinBootstrapIPs,
+		BootstrapExplorer: coinBootstrapExplorer,
+		BootstrapType:     coinBootstrapType,
+		BootstrapQuorum:   coinBootstrapQuorum,
+		UserAgent:         coinUserAgent,
+		BroadcastListen:   broadcastListen,
+		MinConnections:    minConnections,
+		MaxConnections:    maxConnections,
+		NoBlockMinutes:    noBlockMinutes,
+		WIFPrefix:         coinWIFPrefix,
+		PowAlgorithm:      coinPowAlgorithm,
+		PingFormat:        coinPingFormat,
+		Proxy:             coinProxy,
+		Listen:            coinListen,
+		MaxInbound:        maxInbound,
+	}
 
-			os.Exit(0)
-		}
+	if coinSentinelString != "" {
+		config.SentinelVersion = phantom.ConvertVersionStringToInt(coinSentinelString)
+	}
 
-		if noBlockMinutes > 0 && time.Now().Sub(phantom.LastBlockTime).Minutes() > float64(noBlockMinutes) {
-			var runningTime time.Duration = time.Now().Sub(StartTime)
+	if coinDaemonString != "" {
+		config.DaemonVersion = phantom.ConvertVersionStringToInt(coinDaemonString)
+	}
 
-			log.Println("More than ", noBlockMinutes, " minutes without receiving blocks from network. Application has been running for ", runningTime)
-			log.Println("Closing Application now")
+	if coinMagicMsgNewLine {
+		config.MagicMessage = config.MagicMessage + "\n"
+	}
 
-			os.Exit(0)
-		}
+	if coinBootstrapExplorer == "" {
+		chainhash.Decode(&config.BootstrapHash, bootstrapHashStr)
 	}
 
-	waitGroup.Done()
+	return config
 }
@@ -0,0 +1,250 @@
+/**
+*    Copyright (C) 2019-present C2CV Holdings, LLC.
+*
+*    This program is free software: you can redistribute it and/or modify
+*    it under the terms of the Server Side Public License, version 1,
+*    as published by C2CV Holdings, LLC.
+*
+*    This program is distributed in the hope that it will be useful,
+*    but WITHOUT ANY WARRANTY; without even the implied warranty of
+*    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*    Server Side Public License for more details.
+*
+*    You should have received a copy of the Server Side Public License
+*    along with this program. If not, see
+*    <http://www.mongodb.com/licensing/server-side-public-license>.
+*
+*    As a special exception, the copyright holders give permission to link the
+*    code of portions of this program with the OpenSSL library under certain
+*    conditions as described in each individual source file and distribute
+*    linked combinations including the program with the OpenSSL library. You
+*    must comply with the Server Side Public License in all respects for
+*    all of the code used other than as permitted herein. If you modify file(s)
+*    with this exception, you may extend this exception to your version of the
+*    file(s), but you are not obligated to do so. If you do not wish to do so,
+*    delete this exception statement from your version. If you delete this
+*    exception statement from all source files in the program, then also delete
+*    it in the license file.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"../../pkg/phantom"
+)
+
+// preparedBroadcast is the unsigned broadcast written by mnb prepare and
+// read back by mnb import.
+type preparedBroadcast struct {
+	Coin             string `json:"coin"`
+	Alias            string `json:"alias"`
+	Outpoint         string `json:"outpoint"`
+	Address          string `json:"address"`
+	CollateralPubKey string `json:"collateral_pubkey"`
+	MasternodePubKey string `json:"masternode_pubkey"`
+	SigTime          uint64 `json:"sig_time"`
+	ProtocolVersion  uint32 `json:"protocol_version"`
+	MagicMessage     string `json:"magic_message"`
+	Message          string `json:"message"`
+	Broadcast        string `json:"broadcast"`
+}
+
+// runMnb handles the offline signing of broadcasts: phantom mnb prepare|import.
+func runMnb(args []string) {
+	if len(args) < 1 {
+		fmt.Println("usage: phantom mnb prepare|import [flags]")
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "prepare":
+		runMnbPrepare(args[1:])
+	case "import":
+		runMnbImport(args[1:])
+	default:
+		fmt.Println("usage: phantom mnb prepare|import [flags]")
+		os.Exit(2)
+	}
+}
+
+// runMnbPrepare writes the unsigned broadcast of a masternode and prints the
+// message to sign with the collateral address. It accepts the same flags as
+// the daemon to load the masternodes.
+func runMnbPrepare(args []string) {
+	flags := flag.NewFlagSet("mnb prepare", flag.ExitOnError)
+	registerFlags(flags)
+	alias := flags.String("alias", "", "The masternode to prepare the broadcast of.")
+	collateralPubKey := flags.String("collateral_pubkey", "", "The public key of the collateral address in hex (validateaddress in the wallet).")
+	sigTime := flags.Int64("sig_time", 0, "The unix time of the broadcast signature (default now).")
+	output := flags.String("out", "", "The destination of the prepared broadcast (default ALIAS.mnb.json).")
+	flags.Parse(args)
+
+	if *alias == "" || *collateralPubKey == "" {
+		log.Fatal("-alias and -collateral_pubkey are required.")
+	}
+
+	pubKey, err := hex.DecodeString(*collateralPubKey)
+	if err != nil {
+		log.Fatal("Invalid collateral public key: ", err)
+	}
+
+	signTime := time.Now()
+	if *sigTime > 0 {
+		signTime = time.Unix(*sigTime, 0)
+	}
+
+	var prepared *preparedBroadcast
+	for _, config := range loadNetworkConfigs(flags) {
+		entries, err := phantom.NewNetwork(config, nil).LoadMasternodes()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		for _, entry := range entries {
+			if entry.Name != *alias {
+				continue
+			}
+			if prepared != nil {
+				log.Fatal("The masternode ", *alias, " is configured for several coins.")
+			}
+
+			mnb, message, err := phantom.PrepareMasternodeBroadcast(entry, pubKey, config.ProtocolNumber, signTime)
+			if err != nil {
+				log.Fatal(entry.Name, ": ", err)
+			}
+
+			encoded, err := phantom.EncodeBroadcast(&mnb, config.ProtocolNumber)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			prepared = &preparedBroadcast{
+				Coin:             config.Name,
+				Alias:            entry.Name,
+				Outpoint:         entry.Outpoint(),
+				Address:          entry.Address,
+				CollateralPubKey: hex.EncodeToString(mnb.PubKeyCollateralAddress),
+				MasternodePubKey: hex.EncodeToString(mnb.PubKeyMasternode),
+				SigTime:          mnb.SigTime,
+				ProtocolVersion:  mnb.ProtocolVersion,
+				MagicMessage:     config.MagicMessage,
+				Message:          message,
+				Broadcast:        encoded,
+			}
+		}
+	}
+
+	if prepared == nil {
+		log.Fatal("No masternode named ", *alias, " is configured.")
+	}
+
+	if *output == "" {
+		*output = prepared.Alias + ".mnb.json"
+	}
+
+	data, err := json.MarshalIndent(prepared, "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile(*output, append(data, '\n'), 0600); err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("Broadcast of %s prepared in %s, sign this message with the collateral address:\n\n", prepared.Alias, *output)
+	fmt.Println(prepared.Message)
+	fmt.Printf("\ni.e. signmessage \"<collateral address>\" \"%s\"\n", prepared.Message)
+	fmt.Printf("then run: phantom mnb import -prepared=%s -sig=<signature>\n", *output)
+}
+
+// runMnbImport adds the signature to a prepared broadcast, verifies it and
+// hands the broadcast to the running daemon through its api.
+func runMnbImport(args []string) {
+	flags := flag.NewFlagSet("mnb import", flag.ExitOnError)
+	input := flags.String("prepared", "", "The broadcast written by mnb prepare.")
+	signature := flags.String("sig", "", "The base64 signature returned by signmessage.")
+	apiURL := flags.String("api_url", "http://127.0.0.1:8089", "The status api of the running daemon (see -api_listen).")
+	tokenFile := flags.String("api_token_file", "", "File holding the api token of the daemon. Defaults to the "+apiTokenEnv+" environment variable.")
+	flags.Parse(args)
+
+	if *input == "" || *signature == "" {
+		log.Fatal("-prepared and -sig are required.")
+	}
+
+	data, err := ioutil.ReadFile(*input)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var prepared preparedBroadcast
+	if err := json.Unmarshal(data, &prepared); err != nil {
+		log.Fatal(*input, ": ", err)
+	}
+
+	mnb, err := phantom.DecodeBroadcast(prepared.Broadcast, prepared.ProtocolVersion)
+	if err != nil {
+		log.Fatal(*input, ": invalid broadcast: ", err)
+	}
+
+	mnb.Sig, err = base64.StdEncoding.DecodeString(strings.TrimSpace(*signature))
+	if err != nil {
+		log.Fatal("Invalid signature: ", err)
+	}
+
+	if err := phantom.VerifyBroadcastSignature(&mnb, prepared.MagicMessage); err != nil {
+		log.Fatal(prepared.Alias, ": ", err)
+	}
+
+	encoded, err := phantom.EncodeBroadcast(&mnb, prepared.ProtocolVersion)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	body, err := json.Marshal(struct {
+		Broadcast string `json:"broadcast"`
+	}{encoded})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	client := http.Client{Timeout: 15 * time.Second}
+	url := strings.TrimRight(*apiURL, "/") + "/networks/" + prepared.Coin + "/broadcasts"
+	request, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		log.Fatal(err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if token := readAPIToken(*tokenFile); token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		log.Fatal("Unable to reach the daemon: ", err)
+	}
+	defer response.Body.Close()
+
+	var result struct {
+		Outpoint string `json:"outpoint"`
+		Error    string `json:"error"`
+	}
+	json.NewDecoder(response.Body).Decode(&result)
+
+	if response.StatusCode != http.StatusOK {
+		log.Fatalf("The daemon refused the broadcast of %s: %s (%s)", prepared.Alias, result.Error, response.Status)
+	}
+
+	fmt.Printf("Broadcast of %s (%s) imported, it is relayed with the next ping.\n", prepared.Alias, result.Outpoint)
+}
@@ -0,0 +1,246 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"../phantom"
+)
+
+// Server exposes the state of the running networks as JSON over HTTP.
+type Server struct {
+	networks []*phantom.Network
+	mux      *http.ServeMux
+	token    string
+}
+
+type networkSummary struct {
+	Name          string    `json:"name"`
+	Connections   int       `json:"connections"`
+	Connected     int       `json:"connected"`
+	Peers         int       `json:"peers"`
+	Hashes        int       `json:"hashes"`
+	Broadcasts    int       `json:"broadcasts"`
+	Masternodes   int       `json:"masternodes"`
+	Height        int32     `json:"height"`
+	LastBlockTime time.Time `json:"last_block_time"`
+}
+
+func NewServer(networks []*phantom.Network) *Server {
+	server := &Server{
+		networks: networks,
+		mux:      http.NewServeMux(),
+	}
+
+	server.mux.HandleFunc("/networks", server.handleNetworks)
+	server.mux.HandleFunc("/networks/", server.handleNetwork)
+
+	return server
+}
+
+// RequireToken makes the requests changing the daemon state, POST and
+// DELETE, carry the token in an "Authorization: Bearer <token>" header.
+// Without a token they are only accepted from the loopback addresses.
+func (s *Server) RequireToken(token string) {
+	s.token = token
+}
+
+// authorized reports whether the request may change the daemon state.
+func (s *Server) authorized(r *http.Request) bool {
+	if s.token != "" {
+		const prefix = "Bearer "
+		header := r.Header.Get("Authorization")
+		if !strings.HasPrefix(header, prefix) {
+			return false
+		}
+		return subtle.ConstantTimeCompare([]byte(header[len(prefix):]), []byte(s.token)) == 1
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Handle registers an additional handler on the server.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// ListenAndServe blocks serving the api on the given address.
+func (s *Server) ListenAndServe(address string) error {
+	log.Println("API: Listening on", address)
+	return http.ListenAndServe(address, s)
+}
+
+// GET /networks
+func (s *Server) handleNetworks(w http.ResponseWriter, r *http.Request) {
+	summaries := make([]networkSummary, 0, len(s.networks))
+
+	for _, network := range s.networks {
+		status := network.Status()
+
+		connected := 0
+		for _, connection := range status.Connections {
+			if connection.Status > 0 {
+				connected++
+			}
+		}
+
+		summaries = append(summaries, networkSummary{
+			Name:          status.Name,
+			Connections:   len(status.Connections),
+			Connected:     connected,
+			Peers:         len(status.Peers),
+			Hashes:        len(status.Hashes),
+			Broadcasts:    len(status.Broadcasts),
+			Masternodes:   len(status.Masternodes),
+			Height:        status.Height,
+			LastBlockTime: status.LastBlockTime,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, summaries)
+}
+
+// GET /networks/{name}[/connections|/peers|/hashes|/broadcasts|/masternodes|/bans]
+// DELETE /networks/{name}/bans[/{ip}]
+// POST /networks/{name}/broadcasts
+func (s *Server) handleNetwork(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/networks/"), "/"), "/")
+
+	var network *phantom.Network
+	for _, candidate := range s.networks {
+		if strings.EqualFold(candidate.Config.Name, parts[0]) {
+			network = candidate
+			break
+		}
+	}
+
+	if network == nil || len(parts) > 3 || (len(parts) == 3 && parts[1] != "bans") {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead && !s.authorized(r) {
+		if s.token != "" {
+			writeError(w, http.StatusUnauthorized, "missing or invalid api token")
+		} else {
+			writeError(w, http.StatusForbidden, "changes are only accepted from the local host without an api token")
+		}
+		return
+	}
+
+	if len(parts) > 1 && parts[1] == "bans" {
+		s.handleBans(w, r, network, parts[2:])
+		return
+	}
+
+	if len(parts) == 2 && parts[1] == "broadcasts" && r.Method == http.MethodPost {
+		s.handleImportBroadcast(w, r, network)
+		return
+	}
+
+	status := network.Status()
+
+	if len(parts) == 1 {
+		writeJSON(w, http.StatusOK, status)
+		return
+	}
+
+	switch parts[1] {
+	case "connections":
+		writeJSON(w, http.StatusOK, status.Connections)
+	case "peers":
+		writeJSON(w, http.StatusOK, status.Peers)
+	case "hashes":
+		writeJSON(w, http.StatusOK, struct {
+			Hashes        []string  `json:"hashes"`
+			Tip           string    `json:"tip"`
+			Height        int32     `json:"height"`
+			LastBlockTime time.Time `json:"last_block_time"`
+		}{status.Hashes, status.Tip, status.Height, status.LastBlockTime})
+	case "broadcasts":
+		writeJSON(w, http.StatusOK, status.Broadcasts)
+	case "masternodes":
+		writeJSON(w, http.StatusOK, status.Masternodes)
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (s *Server) handleBans(w http.ResponseWriter, r *http.Request, network *phantom.Network, address []string) {
+	switch r.Method {
+	case http.MethodGet:
+		if len(address) > 0 {
+			writeError(w, http.StatusNotFound, "not found")
+			return
+		}
+		writeJSON(w, http.StatusOK, network.Bans())
+	case http.MethodDelete:
+		ip := ""
+		if len(address) > 0 {
+			ip = address[0]
+		}
+		writeJSON(w, http.StatusOK, struct {
+			Cleared int `json:"cleared"`
+		}{network.ClearBans(ip)})
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleImportBroadcast caches a broadcast signed offline, sent as
+// {"broadcast": "<hex>"}.
+func (s *Server) handleImportBroadcast(w http.ResponseWriter, r *http.Request, network *phantom.Network) {
+	var request struct {
+		Broadcast string `json:"broadcast"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	mnb, err := phantom.DecodeBroadcast(request.Broadcast, network.Config.ProtocolNumber)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid broadcast: "+err.Error())
+		return
+	}
+
+	if err := network.ImportBroadcast(mnb); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Outpoint string `json:"outpoint"`
+	}{mnb.Vin.PreviousOutPoint.String()})
+}
+
+func writeJSON(w http.ResponseWriter, code int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(value); err != nil {
+		log.Println("API:", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, message string) {
+	writeJSON(w, code, struct {
+		Error string `json:"error"`
+	}{message})
+}
@@ -0,0 +1,281 @@
+package keystore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const keystoreVersion = 1
+
+// scrypt parameters recommended for interactive logins as of 2017.
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// verifierData is encrypted with the derived key so a wrong passphrase is
+// detected even when the keystore holds no key.
+const verifierData = "phantom-keystore"
+
+var ErrLocked = errors.New("keystore: locked")
+var ErrWrongPassphrase = errors.New("keystore: wrong passphrase")
+
+type sealedValue struct {
+	Nonce      string `json:"nonce"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+type keystoreFile struct {
+	Version  int                    `json:"version"`
+	KDF      string                 `json:"kdf"`
+	Salt     string                 `json:"salt"`
+	N        int                    `json:"n"`
+	R        int                    `json:"r"`
+	P        int                    `json:"p"`
+	Verifier sealedValue            `json:"verifier"`
+	Keys     map[string]sealedValue `json:"keys"`
+}
+
+// Keystore holds masternode private keys encrypted with AES-GCM under a key
+// derived from a passphrase with scrypt. The aliases are stored in clear.
+type Keystore struct {
+	path  string
+	file  keystoreFile
+	aead  cipher.AEAD
+	mutex sync.Mutex
+}
+
+// Open loads the keystore at path. A missing file results in an empty
+// keystore that is created on the first Save.
+func Open(path string) (*Keystore, error) {
+	k := &Keystore{path: path}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		salt := make([]byte, 32)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+
+		k.file = keystoreFile{
+			Version: keystoreVersion,
+			KDF:     "scrypt",
+			Salt:    hex.EncodeToString(salt),
+			N:       scryptN,
+			R:       scryptR,
+			P:       scryptP,
+			Keys:    make(map[string]sealedValue),
+		}
+		return k, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &k.file); err != nil {
+		return nil, fmt.Errorf("keystore: %s: %v", path, err)
+	}
+
+	if k.file.Version != keystoreVersion || k.file.KDF != "scrypt" {
+		return nil, fmt.Errorf("keystore: %s: unsupported version %d (%s)", path, k.file.Version, k.file.KDF)
+	}
+
+	//weaker parameters come from a tampered or hand written file
+	if k.file.N < scryptN || k.file.R < scryptR || k.file.P < scryptP {
+		return nil, fmt.Errorf("keystore: %s: scrypt parameters N=%d r=%d p=%d below N=%d r=%d p=%d", path,
+			k.file.N, k.file.R, k.file.P, scryptN, scryptR, scryptP)
+	}
+
+	if k.file.Keys == nil {
+		k.file.Keys = make(map[string]sealedValue)
+	}
+
+	return k, nil
+}
+
+// Unlock derives the encryption key from the passphrase. The passphrase of a
+// new keystore becomes its passphrase.
+func (k *Keystore) Unlock(passphrase []byte) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	salt, err := hex.DecodeString(k.file.Salt)
+	if err != nil {
+		return fmt.Errorf("keystore: invalid salt: %v", err)
+	}
+
+	key, err := scrypt.Key(passphrase, salt, k.file.N, k.file.R, k.file.P, 32)
+	if err != nil {
+		return err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+
+	if k.file.Verifier.Ciphertext == "" {
+		verifier, err := seal(aead, []byte(verifierData), verifierData)
+		if err != nil {
+			return err
+		}
+		k.file.Verifier = verifier
+	} else if _, err := open(aead, k.file.Verifier, verifierData); err != nil {
+		return ErrWrongPassphrase
+	}
+
+	k.aead = aead
+	return nil
+}
+
+// Aliases returns the sorted aliases of the stored keys, the keystore does
+// not need to be unlocked.
+func (k *Keystore) Aliases() []string {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	aliases := make([]string, 0, len(k.file.Keys))
+	for alias := range k.file.Keys {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	return aliases
+}
+
+// PrivateKey returns the decrypted private key stored under alias.
+func (k *Keystore) PrivateKey(alias string) (string, error) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if k.aead == nil {
+		return "", ErrLocked
+	}
+
+	sealed, ok := k.file.Keys[alias]
+	if !ok {
+		return "", fmt.Errorf("keystore: no key stored for %s", alias)
+	}
+
+	plaintext, err := open(k.aead, sealed, alias)
+	if err != nil {
+		return "", fmt.Errorf("keystore: unable to decrypt the key of %s", alias)
+	}
+
+	return string(plaintext), nil
+}
+
+// Put encrypts and stores the private key under alias, replacing any
+// previous key.
+func (k *Keystore) Put(alias string, privateKey string) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if k.aead == nil {
+		return ErrLocked
+	}
+
+	sealed, err := seal(k.aead, []byte(privateKey), alias)
+	if err != nil {
+		return err
+	}
+
+	k.file.Keys[alias] = sealed
+	return nil
+}
+
+// Remove deletes the key stored under alias.
+func (k *Keystore) Remove(alias string) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if _, ok := k.file.Keys[alias]; !ok {
+		return fmt.Errorf("keystore: no key stored for %s", alias)
+	}
+
+	delete(k.file.Keys, alias)
+	return nil
+}
+
+// Save atomically writes the keystore to disk.
+func (k *Keystore) Save() error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	data, err := json.MarshalIndent(k.file, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(k.path), filepath.Base(k.path)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := os.Chmod(tmp.Name(), 0600); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), k.path)
+}
+
+func seal(aead cipher.AEAD, plaintext []byte, additionalData string) (sealedValue, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return sealedValue{}, err
+	}
+
+	ciphertext := aead.Seal(nil, nonce, plaintext, []byte(additionalData))
+
+	return sealedValue{
+		Nonce:      hex.EncodeToString(nonce),
+		Ciphertext: hex.EncodeToString(ciphertext),
+	}, nil
+}
+
+func open(aead cipher.AEAD, sealed sealedValue, additionalData string) ([]byte, error) {
+	nonce, err := hex.DecodeString(sealed.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	ciphertext, err := hex.DecodeString(sealed.Ciphertext)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(nonce) != aead.NonceSize() {
+		return nil, errors.New("keystore: invalid nonce")
+	}
+
+	return aead.Open(nil, nonce, ciphertext, []byte(additionalData))
+}
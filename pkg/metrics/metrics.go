@@ -0,0 +1,201 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Registry holds the metrics exposed by Handler. Metrics register themselves
+// in the default registry when created.
+type Registry struct {
+	mutex   sync.Mutex
+	metrics []metric
+}
+
+type metric interface {
+	write(buf *bytes.Buffer)
+}
+
+var defaultRegistry = &Registry{}
+
+func (r *Registry) register(m metric) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.metrics = append(r.metrics, m)
+}
+
+// vec is a set of samples sharing a name and a list of label names.
+type vec struct {
+	name       string
+	help       string
+	kind       string
+	labelNames []string
+	mutex      sync.Mutex
+	values     map[string]float64
+	funcs      map[string]func() float64
+	labels     map[string][]string
+}
+
+func newVec(name string, help string, kind string, labelNames []string) *vec {
+	v := &vec{
+		name:       name,
+		help:       help,
+		kind:       kind,
+		labelNames: labelNames,
+		values:     make(map[string]float64),
+		funcs:      make(map[string]func() float64),
+		labels:     make(map[string][]string),
+	}
+	defaultRegistry.register(v)
+	return v
+}
+
+func (v *vec) key(labelValues []string) string {
+	if len(labelValues) != len(v.labelNames) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.name, len(v.labelNames), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	if _, ok := v.labels[key]; !ok {
+		v.labels[key] = append([]string(nil), labelValues...)
+	}
+	return key
+}
+
+func (v *vec) add(value float64, labelValues []string) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	v.values[v.key(labelValues)] += value
+}
+
+func (v *vec) set(value float64, labelValues []string) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	v.values[v.key(labelValues)] = value
+}
+
+func (v *vec) setFunc(fn func() float64, labelValues []string) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	v.funcs[v.key(labelValues)] = fn
+}
+
+func (v *vec) write(buf *bytes.Buffer) {
+	v.mutex.Lock()
+	samples := make(map[string]float64, len(v.values)+len(v.funcs))
+	for key, value := range v.values {
+		samples[key] = value
+	}
+	funcs := make(map[string]func() float64, len(v.funcs))
+	for key, fn := range v.funcs {
+		funcs[key] = fn
+	}
+	labels := make(map[string][]string, len(v.labels))
+	for key, values := range v.labels {
+		labels[key] = values
+	}
+	v.mutex.Unlock()
+
+	//evaluate the functions outside of the lock, they may take other locks
+	for key, fn := range funcs {
+		samples[key] = fn()
+	}
+
+	fmt.Fprintf(buf, "# HELP %s %s\n", v.name, escapeHelp(v.help))
+	fmt.Fprintf(buf, "# TYPE %s %s\n", v.name, v.kind)
+
+	keys := make([]string, 0, len(samples))
+	for key := range samples {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		buf.WriteString(v.name)
+		if len(v.labelNames) > 0 {
+			buf.WriteByte('{')
+			for i, name := range v.labelNames {
+				if i > 0 {
+					buf.WriteByte(',')
+				}
+				fmt.Fprintf(buf, "%s=\"%s\"", name, escapeLabel(labels[key][i]))
+			}
+			buf.WriteByte('}')
+		}
+		buf.WriteByte(' ')
+		buf.WriteString(strconv.FormatFloat(samples[key], 'g', -1, 64))
+		buf.WriteByte('\n')
+	}
+}
+
+// CounterVec is a monotonically increasing value partitioned by labels.
+type CounterVec struct {
+	v *vec
+}
+
+func NewCounterVec(name string, help string, labelNames ...string) *CounterVec {
+	return &CounterVec{newVec(name, help, "counter", labelNames)}
+}
+
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.v.add(1, labelValues)
+}
+
+func (c *CounterVec) Add(value float64, labelValues ...string) {
+	if value < 0 {
+		panic("metrics: counters can not decrease")
+	}
+	c.v.add(value, labelValues)
+}
+
+// GaugeVec is a value that can go up and down partitioned by labels. The
+// value is either set directly or computed by a function on every scrape.
+type GaugeVec struct {
+	v *vec
+}
+
+func NewGaugeVec(name string, help string, labelNames ...string) *GaugeVec {
+	return &GaugeVec{newVec(name, help, "gauge", labelNames)}
+}
+
+func (g *GaugeVec) Set(value float64, labelValues ...string) {
+	g.v.set(value, labelValues)
+}
+
+// SetFunc makes the gauge call fn every time the metrics are collected.
+func (g *GaugeVec) SetFunc(fn func() float64, labelValues ...string) {
+	g.v.setFunc(fn, labelValues)
+}
+
+// Handler serves the registered metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defaultRegistry.mutex.Lock()
+		metrics := append([]metric(nil), defaultRegistry.metrics...)
+		defaultRegistry.mutex.Unlock()
+
+		var buf bytes.Buffer
+		for _, m := range metrics {
+			m.write(&buf)
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Write(buf.Bytes())
+	})
+}
+
+func escapeHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
+
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
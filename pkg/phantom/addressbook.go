@@ -0,0 +1,233 @@
+/**
+*    Copyright (C) 2019-present C2CV Holdings, LLC.
+*
+*    This program is free software: you can redistribute it and/or modify
+*    it under the terms of the Server Side Public License, version 1,
+*    as published by C2CV Holdings, LLC.
+*
+*    This program is distributed in the hope that it will be useful,
+*    but WITHOUT ANY WARRANTY; without even the implied warranty of
+*    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*    Server Side Public License for more details.
+*
+*    You should have received a copy of the Server Side Public License
+*    along with this program. If not, see
+*    <http://www.mongodb.com/licensing/server-side-public-license>.
+*
+*    As a special exception, the copyright holders give permission to link the
+*    code of portions of this program with the OpenSSL library under certain
+*    conditions as described in each individual source file and distribute
+*    linked combinations including the program with the OpenSSL library. You
+*    must comply with the Server Side Public License in all respects for
+*    all of the code used other than as permitted herein. If you modify file(s)
+*    with this exception, you may extend this exception to your version of the
+*    file(s), but you are not obligated to do so. If you do not wish to do so,
+*    delete this exception statement from your version. If you delete this
+*    exception statement from all source files in the program, then also delete
+*    it in the license file.
+ */
+
+package phantom
+
+import (
+	"context"
+	"math"
+	"net"
+	"strconv"
+	"time"
+
+	"../socket/wire"
+	"../storage"
+)
+
+const (
+	//peers that were neither seen nor reached for this long are evicted
+	addressBookMaxAge = 14 * 24 * time.Hour
+
+	//peers failing this many times in a row are evicted
+	addressBookMaxFailures = 10
+
+	addressBookEvictInterval = time.Hour
+
+	//like the addrman of the nodes, the worst peers make room for new ones
+	addressBookMaxPeers = 5000
+
+	//like the nodes, a peer may send addrBurst addresses at once, the answer
+	//to our getaddr, then addrRate addresses per second
+	addrBurst = 1000
+	addrRate  = 0.1
+)
+
+// addrLimiter is the token bucket limiting the addresses accepted from a
+// single connection.
+type addrLimiter struct {
+	tokens float64
+	last   time.Time
+}
+
+func newAddrLimiter() *addrLimiter {
+	return &addrLimiter{tokens: addrBurst, last: time.Now()}
+}
+
+// allow tells whether one more address of the peer is accepted.
+func (l *addrLimiter) allow() bool {
+	now := time.Now()
+	l.tokens = math.Min(addrBurst, l.tokens+now.Sub(l.last).Seconds()*addrRate)
+	l.last = now
+
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// loadAddressBook opens the address book of the network, evicts the stale
+// peers and seeds the peer set with the remaining ones.
+func (n *Network) loadAddressBook() error {
+	book, err := storage.NewAddressBook(n.db, n.Config.Name, addressBookMaxPeers)
+	if err != nil {
+		return err
+	}
+
+	evicted, err := book.Evict(addressBookMaxAge, addressBookMaxFailures)
+	if err != nil {
+		return err
+	}
+
+	records, err := book.Peers()
+	if err != nil {
+		return err
+	}
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	n.addressBook = book
+
+	loaded := 0
+	for _, record := range records {
+		address, ok := recordAddress(record)
+		if !ok || !n.reachable(address) {
+			continue
+		}
+
+		//the bootstrap peers take precedence
+		if _, ok := n.peerSet[address.Hostname()]; ok {
+			continue
+		}
+
+		n.peerSet[address.Hostname()] = address
+		loaded++
+	}
+
+	n.Logger.Printf("Address book: %d peers loaded, %d evicted.\n", loaded, evicted)
+
+	return nil
+}
+
+// maintainAddressBook periodically evicts the stale and failing peers.
+func (n *Network) maintainAddressBook(ctx context.Context) {
+	ticker := time.NewTicker(addressBookEvictInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		evicted, err := n.addressBook.Evict(addressBookMaxAge, addressBookMaxFailures)
+		if err != nil {
+			n.Logger.Println("Address book:", err)
+			continue
+		}
+
+		if evicted > 0 {
+			n.Logger.Printf("Address book: %d peers evicted.\n", evicted)
+		}
+	}
+}
+
+// noteAddrDropped logs the addresses of an addr message over the rate limit.
+func (pinger *PingerConnection) noteAddrDropped(dropped int) {
+	if dropped == 0 {
+		return
+	}
+
+	addressesDropped.Add(float64(dropped), pinger.Network.Config.Name)
+	pinger.Logger.Printf("%s : %d addresses over the rate limit dropped\n", pinger.IpAddress, dropped)
+}
+
+func recordAddress(record storage.PeerRecord) (wire.NetAddress, bool) {
+	host, portString, err := net.SplitHostPort(record.Address)
+	if err != nil {
+		return wire.NetAddress{}, false
+	}
+
+	port, err := strconv.ParseUint(portString, 10, 16)
+	if err != nil {
+		return wire.NetAddress{}, false
+	}
+
+	address, ok := hostAddress(host, uint16(port))
+	if !ok {
+		return wire.NetAddress{}, false
+	}
+	address.Timestamp = record.LastSeen
+	address.Services = wire.ServiceFlag(record.Services)
+
+	return address, true
+}
+
+func peerKey(ip string, port uint16) string {
+	return net.JoinHostPort(ip, strconv.Itoa(int(port)))
+}
+
+// notePeerSeen records an address advertised by a peer.
+func (n *Network) notePeerSeen(addr wire.NetAddress) {
+	if n.addressBook == nil {
+		return
+	}
+
+	err := n.addressBook.Seen(peerKey(addr.Hostname(), addr.Port), uint64(addr.Services), addr.Timestamp)
+	if err != nil {
+		n.Logger.Println("Address book:", err)
+	}
+}
+
+// notePeerAttempt records a connection attempt to the peer.
+func (n *Network) notePeerAttempt(ip string, port uint16) {
+	if n.addressBook == nil {
+		return
+	}
+
+	if err := n.addressBook.Attempt(peerKey(ip, port)); err != nil {
+		n.Logger.Println("Address book:", err)
+	}
+}
+
+// notePeerHandshake records a completed version handshake with the peer.
+func (n *Network) notePeerHandshake(ip string, port uint16, version *wire.MsgVersion) {
+	if n.addressBook == nil {
+		return
+	}
+
+	err := n.addressBook.Success(peerKey(ip, port), uint64(version.Services),
+		uint32(version.ProtocolVersion), version.UserAgent)
+	if err != nil {
+		n.Logger.Println("Address book:", err)
+	}
+}
+
+// notePeerFailure records a peer we were unable to connect to.
+func (n *Network) notePeerFailure(ip string, port uint16) {
+	if n.addressBook == nil {
+		return
+	}
+
+	if err := n.addressBook.Failure(peerKey(ip, port)); err != nil {
+		n.Logger.Println("Address book:", err)
+	}
+}
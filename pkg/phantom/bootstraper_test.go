@@ -0,0 +1,194 @@
+/**
+*    Copyright (C) 2019-present C2CV Holdings, LLC.
+*
+*    This program is free software: you can redistribute it and/or modify
+*    it under the terms of the Server Side Public License, version 1,
+*    as published by C2CV Holdings, LLC.
+*
+*    This program is distributed in the hope that it will be useful,
+*    but WITHOUT ANY WARRANTY; without even the implied warranty of
+*    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*    Server Side Public License for more details.
+*
+*    You should have received a copy of the Server Side Public License
+*    along with this program. If not, see
+*    <http://www.mongodb.com/licensing/server-side-public-license>.
+*
+*    As a special exception, the copyright holders give permission to link the
+*    code of portions of this program with the OpenSSL library under certain
+*    conditions as described in each individual source file and distribute
+*    linked combinations including the program with the OpenSSL library. You
+*    must comply with the Server Side Public License in all respects for
+*    all of the code used other than as permitted herein. If you modify file(s)
+*    with this exception, you may extend this exception to your version of the
+*    file(s), but you are not obligated to do so. If you do not wish to do so,
+*    delete this exception statement from your version. If you delete this
+*    exception statement from all source files in the program, then also delete
+*    it in the license file.
+ */
+
+package phantom
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const (
+	dashGenesisHash = "00000ffd590b1485b3caadc19b22e6379c733355108f107a430458cdf3407ab6"
+	dashBlockCount  = 1512345
+	dashPort        = 9999
+)
+
+// explorerFixtures holds the responses of each explorer API, keyed by the
+// request URI, shaped like the ones of the Dash explorers.
+var explorerFixtures = map[string]map[string]string{
+	"iquidus": {
+		"/api/getblockcount":        "1512345",
+		"/api/getblockhash?index=0": dashGenesisHash,
+		"/api/getpeerinfo": `[
+			{"id":12,"addr":"94.130.12.7:9999","addrlocal":"203.0.113.5:51274","services":"0000000000000005","version":70218,"subver":"/Dash Core:0.17.0.3/","inbound":false,"startingheight":1512300},
+			{"id":15,"addr":"[2a01:4f8:c17:1b3::2]:9999","services":"0000000000000005","version":70218,"subver":"/Dash Core:0.17.0.3/","inbound":false,"startingheight":1512301},
+			{"id":16,"addr":"185.62.151.170:19999","services":"0000000000000005","version":70218,"subver":"/Dash Core:0.17.0.3/","inbound":true,"startingheight":1512301},
+			{"id":17,"addr":"94.130.12.7:9999","services":"0000000000000005","version":70218,"subver":"/Dash Core:0.17.0.3/","inbound":true,"startingheight":1512302}
+		]`,
+	},
+	"eiquidus": {
+		"/api/getblockcount":        "1512345\n",
+		"/api/getblockhash?index=0": dashGenesisHash,
+		"/ext/getnetworkpeers": `[
+			{"address":"94.130.12.7","port":"9999","protocol":"70218","version":"0.17.0.3","country":"Germany","country_code":"DE"},
+			{"address":"2a01:4f8:c17:1b3::2","port":9999,"protocol":"70218","version":"0.17.0.3","country":"Germany","country_code":"DE"},
+			{"address":"185.62.151.170","port":"","protocol":"70218","version":"0.17.0.3","country":"Netherlands","country_code":"NL"},
+			{"address":"dash.example.org","port":"9999","protocol":"70218","version":"0.17.0.3","country":"","country_code":""}
+		]`,
+	},
+	"insight": {
+		"/insight-api/status?q=getInfo": `{"info":{"version":170003,"insightversion":"0.6.0","protocolversion":70218,"blocks":1512345,"timeoffset":0,"connections":8,"proxy":"","difficulty":102355642.8271449,"testnet":false,"relayfee":0.00001,"errors":"","network":"livenet"}}`,
+		"/insight-api/block-index/0":    `{"blockHash":"` + dashGenesisHash + `"}`,
+	},
+	"blockbook": {
+		"/api/v2":               `{"blockbook":{"coin":"Dash","host":"blockbook","version":"0.3.5","bestHeight":1512345,"inSync":true,"decimals":8},"backend":{"chain":"main","blocks":1512345,"headers":1512345,"version":"170003","subversion":"/Dash Core:0.17.0.3/","protocolVersion":"70218"}}`,
+		"/api/v2/block-index/0": `{"blockHash":"` + dashGenesisHash + `"}`,
+	},
+}
+
+// rpcFixtures holds the results of the RPC methods.
+var rpcFixtures = map[string]string{
+	"getblockcount": "1512345",
+	"getblockhash":  `"` + dashGenesisHash + `"`,
+	"getpeerinfo":   `[{"id":12,"addr":"94.130.12.7:9999","addrlocal":"203.0.113.5:51274","version":70218,"subver":"/Dash Core:0.17.0.3/","inbound":false}]`,
+}
+
+func explorerServer(responses map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response, ok := responses[r.URL.RequestURI()]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(response))
+	}))
+}
+
+// rpcServer answers the JSON-RPC calls like a coin daemon, errors included.
+func rpcServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Method string        `json:"method"`
+			Params []interface{} `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("invalid rpc request: %v", err)
+		}
+
+		result, ok := rpcFixtures[request.Method]
+		if request.Method == "getblockhash" && (len(request.Params) != 1 || request.Params[0] != 0.0) {
+			ok = false
+		}
+		if !ok {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"result":null,"error":{"code":-8,"message":"Block height out of range"},"id":"phantom"}`))
+			return
+		}
+		w.Write([]byte(`{"result":` + result + `,"error":null,"id":"phantom"}`))
+	}))
+}
+
+func TestBootstrappers(t *testing.T) {
+	peers := map[string][]string{
+		"iquidus":   {"94.130.12.7", "2a01:4f8:c17:1b3::2"},
+		"eiquidus":  {"94.130.12.7", "2a01:4f8:c17:1b3::2"},
+		"insight":   nil,
+		"blockbook": nil,
+		"rpc":       {"94.130.12.7"},
+	}
+
+	for _, bootstrapType := range BootstrapTypes {
+		var srv *httptest.Server
+		if bootstrapType == "rpc" {
+			srv = rpcServer(t)
+		} else {
+			srv = explorerServer(explorerFixtures[bootstrapType])
+		}
+
+		bootstrapper, err := NewBootstrapper(bootstrapType, srv.URL, srv.Client())
+		if err != nil {
+			t.Fatalf("%s: %v", bootstrapType, err)
+		}
+
+		if count, err := bootstrapper.LoadBlockCount(); err != nil || count != dashBlockCount {
+			t.Errorf("%s: block count %d, %v", bootstrapType, count, err)
+		}
+
+		if hash, err := bootstrapper.LoadBlockHashAt(0); err != nil || hash.String() != dashGenesisHash {
+			t.Errorf("%s: block hash %s, %v", bootstrapType, hash, err)
+		}
+
+		if _, err := bootstrapper.LoadBlockHashAt(1); err == nil {
+			t.Errorf("%s: a missing block should fail", bootstrapType)
+		}
+
+		possiblePeers, err := bootstrapper.LoadPossiblePeers(dashPort)
+		if err != nil {
+			t.Errorf("%s: %v", bootstrapType, err)
+		}
+		if len(possiblePeers) != len(peers[bootstrapType]) {
+			t.Errorf("%s: %d peers, want %d", bootstrapType, len(possiblePeers), len(peers[bootstrapType]))
+		} else {
+			for i, peer := range possiblePeers {
+				if peer.Hostname() != peers[bootstrapType][i] || peer.Port != dashPort {
+					t.Errorf("%s: peer %s:%d, want %s", bootstrapType, peer.Hostname(), peer.Port, peers[bootstrapType][i])
+				}
+			}
+		}
+
+		srv.Close()
+	}
+}
+
+func TestBootstrapperInvalidResponses(t *testing.T) {
+	srv := explorerServer(map[string]string{
+		"/api/getblockcount":        "There was an error. Check your console.",
+		"/api/getblockhash?index=0": "There was an error. Check your console.",
+		"/api/getpeerinfo":          "<html>Bad Gateway</html>",
+	})
+	defer srv.Close()
+
+	bootstrapper, _ := NewBootstrapper("iquidus", srv.URL+"/", srv.Client())
+	if _, err := bootstrapper.LoadBlockCount(); err == nil {
+		t.Error("an invalid block count should fail")
+	}
+	if _, err := bootstrapper.LoadBlockHashAt(0); err == nil {
+		t.Error("an invalid block hash should fail")
+	}
+	if _, err := bootstrapper.LoadPossiblePeers(dashPort); err == nil {
+		t.Error("an invalid peer list should fail")
+	}
+
+	if _, err := NewBootstrapper("chainz", srv.URL, nil); err != ErrUnknownBootstrapType {
+		t.Errorf("unknown type gave %v", err)
+	}
+}
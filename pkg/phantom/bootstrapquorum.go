@@ -0,0 +1,215 @@
+/**
+*    Copyright (C) 2019-present C2CV Holdings, LLC.
+*
+*    This program is free software: you can redistribute it and/or modify
+*    it under the terms of the Server Side Public License, version 1,
+*    as published by C2CV Holdings, LLC.
+*
+*    This program is distributed in the hope that it will be useful,
+*    but WITHOUT ANY WARRANTY; without even the implied warranty of
+*    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*    Server Side Public License for more details.
+*
+*    You should have received a copy of the Server Side Public License
+*    along with this program. If not, see
+*    <http://www.mongodb.com/licensing/server-side-public-license>.
+*
+*    As a special exception, the copyright holders give permission to link the
+*    code of portions of this program with the OpenSSL library under certain
+*    conditions as described in each individual source file and distribute
+*    linked combinations including the program with the OpenSSL library. You
+*    must comply with the Server Side Public License in all respects for
+*    all of the code used other than as permitted herein. If you modify file(s)
+*    with this exception, you may extend this exception to your version of the
+*    file(s), but you are not obligated to do so. If you do not wish to do so,
+*    delete this exception statement from your version. If you delete this
+*    exception statement from all source files in the program, then also delete
+*    it in the license file.
+ */
+
+package phantom
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"../socket/wire"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// ErrNoQuorum is returned when too few explorers agree on the bootstrap block.
+var ErrNoQuorum = errors.New("the explorers did not reach a quorum")
+
+// BootstrapQuorum queries several explorers concurrently and only trusts the
+// block a quorum of them agree on.
+type BootstrapQuorum struct {
+	URLs          []string
+	Bootstrappers []Bootstrapper
+	Quorum        int
+}
+
+// NewBootstrapQuorum creates the bootstrappers of the comma separated urls.
+// types holds either one type for every url or one type per url. A quorum of
+// 0 requires a majority of the explorers.
+func NewBootstrapQuorum(urls string, types string, quorum uint, client *http.Client) (*BootstrapQuorum, error) {
+	q := &BootstrapQuorum{}
+
+	for _, u := range strings.Split(urls, ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			q.URLs = append(q.URLs, u)
+		}
+	}
+	if len(q.URLs) == 0 {
+		return nil, errors.New("no explorer url provided")
+	}
+
+	typeList := strings.Split(types, ",")
+	if len(typeList) != 1 && len(typeList) != len(q.URLs) {
+		return nil, fmt.Errorf("%d bootstrap types given for %d explorers", len(typeList), len(q.URLs))
+	}
+
+	for i, u := range q.URLs {
+		bootstrapType := typeList[0]
+		if len(typeList) > 1 {
+			bootstrapType = typeList[i]
+		}
+
+		bootstrapper, err := NewBootstrapper(strings.TrimSpace(bootstrapType), u, client)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %q", err, bootstrapType)
+		}
+		q.Bootstrappers = append(q.Bootstrappers, bootstrapper)
+	}
+
+	q.Quorum = int(quorum)
+	if q.Quorum == 0 {
+		q.Quorum = len(q.URLs)/2 + 1
+	}
+	if q.Quorum > len(q.URLs) {
+		return nil, fmt.Errorf("a quorum of %d needs as many explorers, %d given", q.Quorum, len(q.URLs))
+	}
+
+	return q, nil
+}
+
+// displayURL hides the credentials of an explorer url in the logs.
+func displayURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	u.User = nil
+	return u.String()
+}
+
+// LoadBlockHash returns the hash pingDepth blocks below the highest block
+// count reached by a quorum of the explorers, provided a quorum of them
+// return the same hash at that height, along with its height.
+func (q *BootstrapQuorum) LoadBlockHash(logger *log.Logger) (chainhash.Hash, int, error) {
+	counts := make([]int, len(q.Bootstrappers))
+	var waitGroup sync.WaitGroup
+
+	for i, bootstrapper := range q.Bootstrappers {
+		waitGroup.Add(1)
+		go func(i int, bootstrapper Bootstrapper) {
+			defer waitGroup.Done()
+
+			count, err := bootstrapper.LoadBlockCount()
+			if err == nil && count < pingDepth {
+				err = fmt.Errorf("invalid block count %d", count)
+			}
+			if err != nil {
+				logger.Println("Explorer", displayURL(q.URLs[i]), "failed:", err)
+				count = -1
+			}
+			counts[i] = count
+		}(i, bootstrapper)
+	}
+	waitGroup.Wait()
+
+	//the height a quorum of explorers has at least reached
+	sorted := append([]int(nil), counts...)
+	sort.Sort(sort.Reverse(sort.IntSlice(sorted)))
+	target := sorted[q.Quorum-1]
+	if target < 0 {
+		return chainhash.Hash{}, 0, fmt.Errorf("%w, only %d of %d explorers answered", ErrNoQuorum, answered(counts), len(counts))
+	}
+	height := target - pingDepth
+
+	hashes := make([]chainhash.Hash, len(q.Bootstrappers))
+	for i, bootstrapper := range q.Bootstrappers {
+		if counts[i] < target {
+			continue
+		}
+
+		waitGroup.Add(1)
+		go func(i int, bootstrapper Bootstrapper) {
+			defer waitGroup.Done()
+
+			hash, err := bootstrapper.LoadBlockHashAt(height)
+			if err != nil {
+				logger.Println("Explorer", displayURL(q.URLs[i]), "failed:", err)
+				return
+			}
+			hashes[i] = hash
+		}(i, bootstrapper)
+	}
+	waitGroup.Wait()
+
+	votes := make(map[chainhash.Hash]int)
+	for i, hash := range hashes {
+		if hash == (chainhash.Hash{}) {
+			continue
+		}
+		votes[hash]++
+		logger.Printf("Explorer %s: block %d is %s\n", displayURL(q.URLs[i]), height, hash)
+	}
+
+	for hash, count := range votes {
+		if count >= q.Quorum {
+			return hash, height, nil
+		}
+	}
+
+	return chainhash.Hash{}, 0, fmt.Errorf("%w, no hash of block %d is shared by %d explorers", ErrNoQuorum, height, q.Quorum)
+}
+
+func answered(counts []int) int {
+	n := 0
+	for _, count := range counts {
+		if count >= 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// LoadPossiblePeers merges the peers listed by every explorer.
+func (q *BootstrapQuorum) LoadPossiblePeers(portFilter uint16) []wire.NetAddress {
+	results := make([][]wire.NetAddress, len(q.Bootstrappers))
+	var waitGroup sync.WaitGroup
+
+	for i, bootstrapper := range q.Bootstrappers {
+		waitGroup.Add(1)
+		go func(i int, bootstrapper Bootstrapper) {
+			defer waitGroup.Done()
+			results[i], _ = bootstrapper.LoadPossiblePeers(portFilter)
+		}(i, bootstrapper)
+	}
+	waitGroup.Wait()
+
+	var peers []wire.NetAddress
+	for _, result := range results {
+		for _, peer := range result {
+			peers = addPossiblePeer(peer, peers, portFilter)
+		}
+	}
+	return peers
+}
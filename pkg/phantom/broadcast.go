@@ -0,0 +1,370 @@
+/**
+*    Copyright (C) 2019-present C2CV Holdings, LLC.
+*
+*    This program is free software: you can redistribute it and/or modify
+*    it under the terms of the Server Side Public License, version 1,
+*    as published by C2CV Holdings, LLC.
+*
+*    This program is distributed in the hope that it will be useful,
+*    but WITHOUT ANY WARRANTY; without even the implied warranty of
+*    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*    Server Side Public License for more details.
+*
+*    You should have received a copy of the Server Side Public License
+*    along with this program. If not, see
+*    <http://www.mongodb.com/licensing/server-side-public-license>.
+*
+*    As a special exception, the copyright holders give permission to link the
+*    code of portions of this program with the OpenSSL library under certain
+*    conditions as described in each individual source file and distribute
+*    linked combinations including the program with the OpenSSL library. You
+*    must comply with the Server Side Public License in all respects for
+*    all of the code used other than as permitted herein. If you modify file(s)
+*    with this exception, you may extend this exception to your version of the
+*    file(s), but you are not obligated to do so. If you do not wish to do so,
+*    delete this exception statement from your version. If you delete this
+*    exception statement from all source files in the program, then also delete
+*    it in the license file.
+ */
+
+package phantom
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"../socket/wire"
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/btcec/ecdsa"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// ErrNoCollateralKey is returned when a broadcast is requested for a
+// masternode that has neither the collateral key nor an offline signature.
+var ErrNoCollateralKey = errors.New("no collateral key or broadcast signature")
+
+// ErrBroadcastSignature is returned when a broadcast is not signed by the key
+// of its collateral address.
+var ErrBroadcastSignature = errors.New("the broadcast is not signed by the collateral key")
+
+// CanBroadcast reports whether a broadcast can be created for the entry.
+func (entry MasternodeEntry) CanBroadcast() bool {
+	return entry.CollateralKey != "" || entry.BroadcastSig != ""
+}
+
+// ParseService converts an ip:port address into the service announced by a
+// broadcast.
+func ParseService(address string) (wire.CService, error) {
+	var service wire.CService
+
+	host, portString, err := net.SplitHostPort(address)
+	if err != nil {
+		return service, err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return service, fmt.Errorf("invalid ip %q", host)
+	}
+
+	port, err := strconv.ParseUint(portString, 10, 16)
+	if err != nil || port == 0 {
+		return service, fmt.Errorf("invalid port %q", portString)
+	}
+
+	copy(service.IpAddress[:], ip.To16())
+	service.Port = uint16(port)
+
+	return service, nil
+}
+
+// GenerateMNBMessage returns the message signed by the collateral key. The
+// public keys are written as their key ids, the reversed hash160 in hex.
+func GenerateMNBMessage(service wire.CService, sigTime uint64, pubKeyCollateral []byte, pubKeyMasternode []byte, protocolVersion uint32) string {
+	address := net.JoinHostPort(net.IP(service.IpAddress[:]).String(), strconv.Itoa(int(service.Port)))
+
+	return address + strconv.FormatUint(sigTime, 10) + keyID(pubKeyCollateral) + keyID(pubKeyMasternode) +
+		strconv.FormatUint(uint64(protocolVersion), 10)
+}
+
+func keyID(pubKey []byte) string {
+	id := btcutil.Hash160(pubKey)
+	for i, j := 0, len(id)-1; i < j; i, j = i+1, j-1 {
+		id[i], id[j] = id[j], id[i]
+	}
+
+	return hex.EncodeToString(id)
+}
+
+// signedMessageHash returns the hash the wallets sign for signmessage.
+func signedMessageHash(magicMessage string, message string) []byte {
+	var buf bytes.Buffer
+	wire.WriteVarString(&buf, 0, magicMessage)
+	wire.WriteVarString(&buf, 0, message)
+
+	return chainhash.DoubleHashB(buf.Bytes())
+}
+
+// unsignedBroadcast returns the broadcast of the entry without the
+// collateral key, its signature and its time.
+func unsignedBroadcast(entry MasternodeEntry, protocolVersion uint32) (wire.MsgMNB, error) {
+	mnb := wire.MsgMNB{ProtocolVersion: protocolVersion}
+
+	service, err := ParseService(entry.Address)
+	if err != nil {
+		return wire.MsgMNB{}, fmt.Errorf("masternode address: %v", err)
+	}
+	mnb.Addr = service
+
+	var outpointHash chainhash.Hash
+	if err := chainhash.Decode(&outpointHash, entry.OutpointHash); err != nil {
+		return wire.MsgMNB{}, fmt.Errorf("collateral txid: %v", err)
+	}
+	mnb.Vin = *wire.NewTxIn(wire.NewOutPoint(&outpointHash, entry.OutpointIndex), nil, nil)
+
+	wif, err := btcutil.DecodeWIF(entry.PrivateKey)
+	if err != nil {
+		return wire.MsgMNB{}, err
+	}
+	//announced as the wif says, the pings are signed for the same serialization
+	mnb.PubKeyMasternode = wif.SerializePubKey()
+
+	return mnb, nil
+}
+
+// GenerateMasternodeBroadcast creates the broadcast of the entry, signed at
+// sigTime with the collateral key or carrying the signature made offline.
+// The last ping is set when the broadcast is relayed.
+func GenerateMasternodeBroadcast(entry MasternodeEntry, magicMessage string, protocolVersion uint32, sigTime time.Time) (wire.MsgMNB, error) {
+	mnb, err := unsignedBroadcast(entry, protocolVersion)
+	if err != nil {
+		return wire.MsgMNB{}, err
+	}
+
+	switch {
+	case entry.CollateralKey != "":
+		collateral, err := btcutil.DecodeWIF(entry.CollateralKey)
+		if err != nil {
+			return wire.MsgMNB{}, fmt.Errorf("collateral key: %v", err)
+		}
+
+		mnb.PubKeyCollateralAddress = collateral.SerializePubKey()
+		mnb.SigTime = uint64(sigTime.UTC().Unix())
+
+		message := GenerateMNBMessage(mnb.Addr, mnb.SigTime, mnb.PubKeyCollateralAddress, mnb.PubKeyMasternode, mnb.ProtocolVersion)
+		mnb.Sig, err = ecdsa.SignCompact(collateral.PrivKey, signedMessageHash(magicMessage, message), collateral.CompressPubKey)
+		if err != nil {
+			return wire.MsgMNB{}, fmt.Errorf("unable to sign the broadcast: %v", err)
+		}
+
+	case entry.BroadcastSig != "":
+		mnb.PubKeyCollateralAddress, err = hex.DecodeString(entry.CollateralPubKey)
+		if err != nil {
+			return wire.MsgMNB{}, fmt.Errorf("collateral public key: %v", err)
+		}
+
+		mnb.Sig, err = base64.StdEncoding.DecodeString(entry.BroadcastSig)
+		if err != nil {
+			return wire.MsgMNB{}, fmt.Errorf("broadcast signature: %v", err)
+		}
+		mnb.SigTime = uint64(entry.BroadcastSigTime)
+
+	default:
+		return wire.MsgMNB{}, ErrNoCollateralKey
+	}
+
+	return mnb, nil
+}
+
+// PrepareMasternodeBroadcast returns the broadcast of the entry without its
+// signature, along with the message the collateral key has to sign with
+// signmessage.
+func PrepareMasternodeBroadcast(entry MasternodeEntry, pubKeyCollateral []byte, protocolVersion uint32, sigTime time.Time) (wire.MsgMNB, string, error) {
+	if _, err := btcec.ParsePubKey(pubKeyCollateral); err != nil {
+		return wire.MsgMNB{}, "", fmt.Errorf("collateral public key: %v", err)
+	}
+
+	mnb, err := unsignedBroadcast(entry, protocolVersion)
+	if err != nil {
+		return wire.MsgMNB{}, "", err
+	}
+
+	mnb.PubKeyCollateralAddress = pubKeyCollateral
+	mnb.SigTime = uint64(sigTime.UTC().Unix())
+
+	message := GenerateMNBMessage(mnb.Addr, mnb.SigTime, mnb.PubKeyCollateralAddress, mnb.PubKeyMasternode, mnb.ProtocolVersion)
+
+	return mnb, message, nil
+}
+
+// VerifyBroadcastSignature checks that the broadcast is signed by the key of
+// its collateral address.
+func VerifyBroadcastSignature(mnb *wire.MsgMNB, magicMessage string) error {
+	message := GenerateMNBMessage(mnb.Addr, mnb.SigTime, mnb.PubKeyCollateralAddress, mnb.PubKeyMasternode, mnb.ProtocolVersion)
+
+	pubKey, compressed, err := ecdsa.RecoverCompact(mnb.Sig, signedMessageHash(magicMessage, message))
+	if err != nil {
+		return fmt.Errorf("invalid broadcast signature: %v", err)
+	}
+
+	recovered := pubKey.SerializeUncompressed()
+	if compressed {
+		recovered = pubKey.SerializeCompressed()
+	}
+
+	if !bytes.Equal(recovered, mnb.PubKeyCollateralAddress) {
+		return ErrBroadcastSignature
+	}
+
+	return nil
+}
+
+// ImportBroadcast verifies a broadcast signed offline and caches it, it is
+// then relayed along with the pings of its masternode.
+func (n *Network) ImportBroadcast(mnb wire.MsgMNB) error {
+	if err := VerifyBroadcastSignature(&mnb, n.Config.MagicMessage); err != nil {
+		return err
+	}
+
+	sigTime := time.Unix(int64(mnb.SigTime), 0)
+	if sigTime.Add(time.Hour * 24).Before(time.Now().UTC()) {
+		return errors.New("the broadcast was signed more than 24 hours ago")
+	}
+	if sigTime.After(time.Now().UTC().Add(time.Hour)) {
+		return errors.New("the broadcast is signed in the future")
+	}
+
+	outpoint := mnb.Vin.PreviousOutPoint.String()
+
+	n.mutex.Lock()
+	n.broadcastSet[outpoint] = mnb
+	n.mutex.Unlock()
+
+	n.Logger.Printf("Broadcast imported for %s, signed at %d\n", outpoint, mnb.SigTime)
+
+	return nil
+}
+
+// masternodeBroadcast returns the broadcast relayed along with the pings of
+// the entry. When the entry can sign its own broadcast, the cached one is
+// only kept while it announces the same keys and address, otherwise a new
+// broadcast is created and cached.
+func (n *Network) masternodeBroadcast(entry MasternodeEntry) *wire.MsgMNB {
+	template := n.broadcastTemplate(entry.Outpoint())
+	if !entry.CanBroadcast() {
+		return template
+	}
+
+	mnb, err := GenerateMasternodeBroadcast(entry, n.Config.MagicMessage, n.Config.ProtocolNumber, time.Now())
+	if err != nil {
+		n.Logger.Printf("%s : Unable to create the broadcast: %s\n", entry.Name, err)
+		return template
+	}
+
+	if template != nil && template.Addr == mnb.Addr &&
+		bytes.Equal(template.PubKeyMasternode, mnb.PubKeyMasternode) &&
+		bytes.Equal(template.PubKeyCollateralAddress, mnb.PubKeyCollateralAddress) {
+		return template
+	}
+
+	n.mutex.Lock()
+	n.broadcastSet[entry.Outpoint()] = mnb
+	n.mutex.Unlock()
+
+	n.Logger.Printf("%s : Created a masternode broadcast for %s signed at %d\n", entry.Name, entry.Address, mnb.SigTime)
+
+	return &mnb
+}
+
+// verifyPing signs the ping and checks it, and its broadcast template,
+// before they are relayed. A template that would be refused by the network
+// is dropped from the ping and reported. The signed ping is returned, it is
+// the message relayed to every peer.
+//
+// The ping is signed here with the magic message it is verified with, so its
+// check only catches a key that does not match the announced masternode key.
+// A wrong magic message or newline setting is only revealed by the signature
+// of the template, made by the wallet.
+func (n *Network) verifyPing(ping *MasternodePing) (wire.MsgMNP, error) {
+	wif, err := btcutil.DecodeWIF(ping.PrivateKey)
+	if err != nil {
+		return wire.MsgMNP{}, err
+	}
+
+	template := ping.BroadcastTemplate
+	if template != nil {
+		if err := VerifyBroadcastSignature(template, ping.MagicMessage); err != nil {
+			n.Logger.Printf("%s : Not relaying the broadcast, %v: it does not verify with the magic message %q, check magic_message and magic_message_newline.\n",
+				ping.Name, err, ping.MagicMessage)
+			ping.BroadcastTemplate = nil
+		} else if !samePubKey(template.PubKeyMasternode, wif.PrivKey.PubKey()) {
+			n.Logger.Printf("%s : Not relaying the broadcast, it announces the masternode key %x which does not belong to the configured private key.\n",
+				ping.Name, template.PubKeyMasternode)
+			ping.BroadcastTemplate = nil
+		}
+	}
+
+	mnp, err := ping.GenerateMasternodePing(ping.SentinelVersion, ping.DaemonVersion)
+	if err != nil {
+		return wire.MsgMNP{}, err
+	}
+
+	//the nodes verify the ping against the key the broadcast announces
+	pubKey := wif.PrivKey.PubKey().SerializeUncompressed()
+	if pingKeyCompressed(wif, ping.BroadcastTemplate) {
+		pubKey = wif.PrivKey.PubKey().SerializeCompressed()
+	}
+	if ping.BroadcastTemplate != nil {
+		pubKey = ping.BroadcastTemplate.PubKeyMasternode
+	}
+
+	if err := VerifyMasternodePing(&mnp, ping.MagicMessage, pubKey); err != nil {
+		return wire.MsgMNP{}, err
+	}
+
+	return mnp, nil
+}
+
+// samePubKey reports whether serialized is a serialization, compressed or
+// not, of pubKey.
+func samePubKey(serialized []byte, pubKey *btcec.PublicKey) bool {
+	parsed, err := btcec.ParsePubKey(serialized)
+	if err != nil {
+		return false
+	}
+	return parsed.IsEqual(pubKey)
+}
+
+// EncodeBroadcast returns the broadcast serialized in hex.
+func EncodeBroadcast(mnb *wire.MsgMNB, protocolVersion uint32) (string, error) {
+	var buf bytes.Buffer
+	if err := mnb.BtcEncode(&buf, protocolVersion, wire.BaseEncoding); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(buf.Bytes()), nil
+}
+
+// DecodeBroadcast parses a broadcast serialized in hex.
+func DecodeBroadcast(encoded string, protocolVersion uint32) (wire.MsgMNB, error) {
+	var mnb wire.MsgMNB
+
+	raw, err := hex.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return mnb, err
+	}
+
+	if err := mnb.BtcDecode(bytes.NewReader(raw), protocolVersion, wire.BaseEncoding); err != nil {
+		return mnb, err
+	}
+
+	return mnb, nil
+}
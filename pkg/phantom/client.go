@@ -32,6 +32,9 @@ package phantom
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"errors"
+	"io"
 	"log"
 	"net"
 	"strconv"
@@ -44,6 +47,16 @@ import (
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 )
 
+// SignedPing is a ping signed and verified once by the network, every
+// connection relays the same message.
+type SignedPing struct {
+	Name string
+	Ping wire.MsgMNP
+
+	//the broadcast built from the template of the masternode, if any
+	Broadcast *wire.MsgMNB
+}
+
 type PingerConnection struct {
 	MagicBytes       uint32
 	IpAddress        string
@@ -52,317 +65,646 @@ type PingerConnection struct {
 	SentinelVersion  uint32
 	DaemonVersion    uint32
 	BootstrapHash    chainhash.Hash
-	PingChannel      chan MasternodePing
+	PingChannel      chan SignedPing
 	AddrChannel      chan wire.NetAddress
 	HashChannel      chan chainhash.Hash
 	BroadcastChannel chan wire.MsgMNB
 	Status           int8
 	WaitGroup        *sync.WaitGroup
 	Mutex            sync.Mutex
+	Network          *Network
+	Logger           *log.Logger
+
+	//set for the connections accepted by the listener, they are never
+	//redialed nor recorded in the address book
+	Inbound bool
+	conn    net.Conn
+
+	//what the peer told about itself in its version
+	PeerUserAgent   string
+	PeerServices    wire.ServiceFlag
+	PeerProtocol    uint32
+	PeerStartHeight int32
 }
 
-var currentBlockHash = ""
-var currentMnBroadcast = ""
-var currentMnRelaying = ""
-var LastBlockTime time.Time = time.Now().Add(time.Minute * 5)
-var lastConnectionError error
-
-func (pinger *PingerConnection) Start(userAgent string) {
+// Start connects to the peer and relays the pings until the pinger is reaped
+// or the context is cancelled, the pending pings are relayed before the
+// connection is closed.
+func (pinger *PingerConnection) Start(ctx context.Context, userAgent string) {
 
-	log.Printf("%s : STARTING CLIENT\n", pinger.IpAddress)
+	pinger.Logger.Printf("%s : STARTING CLIENT\n", pinger.IpAddress)
 
 	//make sure we close out the waitGroup
 	defer pinger.WaitGroup.Done()
 
 	var connectionAttempts uint8 = 0
 
-	var messageMap map[string]wire.Message
+	//the host is not resolved here, a proxy resolves the .onion names
+	address := net.JoinHostPort(pinger.IpAddress, strconv.Itoa(int(pinger.Port)))
 
-	var magic = wire.BitcoinNet(pinger.MagicBytes)
-
-	me := wire.NetAddress{
-		Timestamp: time.Time{},
-		Services:  0,
-		IP:        net.ParseIP("8.8.8.8"),
-		Port:      pinger.Port,
+	if !pinger.Inbound {
+		pinger.Network.notePeerAttempt(pinger.IpAddress, pinger.Port)
 	}
 
-	you := wire.NetAddress{
-		Timestamp: time.Time{},
-		Services:  0,
-		IP:        net.ParseIP(pinger.IpAddress),
-		Port:      pinger.Port,
-	}
+	for {
+
+		if ctx.Err() != nil {
+			pinger.SetStatus(-1)
+			return
+		}
+
+		if connectionAttempts >= 10 || len(pinger.PingChannel) > 10 {
+			pinger.Logger.Println("Unable to connect -- closing connection / channel too full.")
+			if connectionAttempts >= 10 && !pinger.Inbound {
+				pinger.Network.notePeerFailure(pinger.IpAddress, pinger.Port)
+			}
+			pinger.SetStatus(-1)
+			return
+		}
+
+		var err error
+		conn := pinger.conn
+		if !pinger.Inbound {
+			conn, err = pinger.Network.dialer.DialContext(ctx, "tcp", address)
+		}
+		if err != nil {
+			if pinger.Network.noteConnectionError(err) {
+				pinger.Logger.Println(err)
+			}
+			connectionAttempts++
+			reconnectAttempts.Inc(pinger.Network.Config.Name)
+			continue
+		}
 
-	version := wire.MsgVersion{
-		ProtocolVersion: int32(pinger.ProtocolNumber),
-		Services:        0,
-		Timestamp:       time.Unix(time.Now().Unix(), 0),
-		AddrYou:         you,
-		AddrMe:          me,
-		Nonce:           0xDEADBEEF,
-		UserAgent:       userAgent,
-		LastBlock:       0,
-		DisableRelayTx:  true,
+		pinger.serve(ctx, conn, userAgent)
+
+		//inbound peers are not redialed, closed pingers are reaped
+		if pinger.Inbound || pinger.GetStatus() < 0 {
+			pinger.SetStatus(-1)
+			return
+		}
+
+		//we've disconnected, so try again
+		connectionAttempts++
+		pinger.Logger.Printf("%s : There's been an error, attempting to reconnect.\n", pinger.IpAddress)
+		time.Sleep(1 * time.Minute)
 	}
+}
+
+// serve runs the handshake and the message loop of a single connection, the
+// connection is closed when it returns.
+func (pinger *PingerConnection) serve(ctx context.Context, conn net.Conn, userAgent string) {
+	var connectionAttempts uint8 = 0
+
+	var magic = wire.BitcoinNet(pinger.MagicBytes)
+
+	defer conn.Close()
 
-	tcpAddr, err := net.ResolveTCPAddr("tcp4", pinger.IpAddress+":"+strconv.Itoa(int(pinger.Port)))
+	//a fresh nonce for every connection, to recognize our own version
+	nonce, err := localNonces.add(pinger)
 	if err != nil {
-		if err != lastConnectionError {
-			lastConnectionError = err
-			log.Println(err)
-		}
+		pinger.Logger.Printf("%s : Unable to generate the version nonce: %s\n", pinger.IpAddress, err)
 		pinger.SetStatus(-1)
 		return
 	}
+	defer localNonces.remove(nonce)
+
+	version := pinger.newVersion(userAgent, nonce)
+
+	addrs := newAddrLimiter()
+
+	stopWatching := make(chan struct{})
+	defer close(stopWatching)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			//wake up the reader, the pending pings are relayed before closing
+			conn.SetReadDeadline(time.Now())
+		case <-stopWatching:
+		}
+	}()
+
+	draining := false
+	peerAddrV2 := false
+	handshake := handshakeNone
+	var peerVersion *wire.MsgVersion
+
+	//the start height of the peer is only valid for its tip at version time,
+	//it is used once and never after the peer announced a new block
+	startHeightUsed := false
+
+	//inbound peers speak first
+	if !pinger.Inbound {
+		var buf bytes.Buffer
+		wire.WriteMessageN(&buf, &version, pinger.ProtocolNumber, magic)
+		conn.Write(buf.Bytes())
+		handshake = handshakeVersionSent
+	}
 
-	//setup the ping inv map
-	messageMap = make(map[string]wire.Message)
+	bufReader := bufio.NewReader(conn)
 
 	for {
 
+		if pinger.GetStatus() < 0 {
+			return
+		}
+
+		//connection failed, set the status to -1 and let it be reaped
 		if connectionAttempts >= 10 || len(pinger.PingChannel) > 10 {
-			log.Println("Unable to connect -- closing connection / channel too full.")
+			pinger.Logger.Println("Unable to connect -- closing connection / channel too full (inside).")
+			if connectionAttempts >= 10 && !pinger.Inbound {
+				pinger.Network.notePeerFailure(pinger.IpAddress, pinger.Port)
+			}
 			pinger.SetStatus(-1)
 			return
 		}
 
-		conn, err := net.DialTCP("tcp", nil, tcpAddr)
-		if err != nil {
-			if err != lastConnectionError {
-				lastConnectionError = err
-				log.Println(err)
+		//a silent peer is dropped, the handshake gets less time
+		if !draining {
+			readTimeout := peerReadTimeout
+			if pinger.GetStatus() == 0 {
+				readTimeout = handshakeTimeout
+			}
+			conn.SetReadDeadline(time.Now().Add(readTimeout))
+			if ctx.Err() != nil {
+				conn.SetReadDeadline(time.Now())
 			}
-			connectionAttempts++
-			continue
 		}
 
-		var buf bytes.Buffer
-		wire.WriteMessageN(&buf, &version, pinger.ProtocolNumber, magic)
-		conn.Write(buf.Bytes())
+		_, msg, payload, err := wire.ReadMessageN(bufReader, pinger.ProtocolNumber, magic)
+
+		if err != nil {
+			if ctx.Err() != nil {
+				if draining || pinger.GetStatus() <= 0 {
+					pinger.SetStatus(-1)
+					return
+				}
+				draining = true
+
+				if pinger.relayPendingPings(conn, magic) == 0 {
+					pinger.SetStatus(-1)
+					return
+				}
 
-		bufReader := bufio.NewReader(conn)
+				//keep answering the getdata requests for a while
+				conn.SetReadDeadline(time.Now().Add(drainTimeout))
+				continue
+			}
 
-		for {
+			if strings.Contains(err.Error(), "unhandled command") {
+				//	log.Println(err)
+				continue
+			}
 
-			if pinger.GetStatus() < 0 {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				pinger.Logger.Printf("%s : no message received in time, disconnecting\n", pinger.IpAddress)
+				if pinger.Inbound {
+					//nothing to record
+				} else if pinger.GetStatus() > 0 {
+					pinger.Network.notePeerDisconnect(pinger.IpAddress)
+				} else {
+					pinger.Network.notePeerFailure(pinger.IpAddress, pinger.Port)
+				}
+				conn.Close()
+				pinger.SetStatus(-1)
 				return
 			}
+			pinger.Logger.Printf("%s : %s\n", pinger.IpAddress, err)
 
-			//connection failed, set the status to -1 and let it be reaped
-			if connectionAttempts >= 10 || len(pinger.PingChannel) > 10 {
-				log.Println("Unable to connect -- closing connection / channel too full (inside).")
+			if strings.Contains(err.Error(), "message from other network") {
+				pinger.Network.banPeer(pinger.IpAddress, "wrong magic bytes")
+				conn.Close()
 				pinger.SetStatus(-1)
 				return
 			}
 
-			_, msg, _, err := wire.ReadMessageN(bufReader, pinger.ProtocolNumber, magic)
+			//a malformed payload was read in full, only that message is lost
+			var payloadErr *wire.PayloadError
+			if errors.As(err, &payloadErr) {
+				continue
+			}
+
+			//an oversized payload is left unread, the stream is lost
+			var msgErr *wire.MessageError
+			if errors.As(err, &msgErr) {
+				pinger.Network.banPeer(pinger.IpAddress, "sent an oversized message")
+				conn.Close()
+				pinger.SetStatus(-1)
+				return
+			}
+
+			//the peer closed the connection, before the handshake a full node
+			//does so when its slots are taken or it banned us
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				if pinger.Inbound {
+					//nothing to record
+				} else if pinger.GetStatus() > 0 {
+					pinger.Network.notePeerDisconnect(pinger.IpAddress)
+				} else if pinger.GetStatus() == 0 {
+					pinger.Network.notePeerFailure(pinger.IpAddress, pinger.Port)
+				}
+				conn.Close()
+				pinger.SetStatus(-1)
+				return
+			}
+
+			connectionAttempts++
+			continue
+		} else {
+
+			// log.Println("COMMAND: ", msg.Command())
 
-			if err != nil {
-				if strings.Contains(err.Error(), "unhandled command") {
-					//	log.Println(err)
+			connectionAttempts = 0
+
+			if msg.Command() == "version" {
+				//a single version, after ours for the outbound peers
+				if handshake != handshakeNone && handshake != handshakeVersionSent {
+					pinger.Logger.Printf("%s : Duplicate version ignored\n", pinger.IpAddress)
 					continue
 				}
-				log.Printf("%s : %s\n", pinger.IpAddress, err)
-				connectionAttempts++
-				continue
-			} else {
-
-				// log.Println("COMMAND: ", msg.Command())
-
-				connectionAttempts = 0
-
-				if msg.Command() == "inv" {
-					inv := msg.(*wire.MsgInv)
-					for _, inventory := range inv.InvList {
-						if inventory.Type.String() == "MSG_BLOCK" {
-							if inventory.Hash.String() != currentBlockHash {
-								currentBlockHash = inventory.Hash.String()
-								LastBlockTime = time.Now()
-								log.Println("New block:", inventory.Hash.String())
-							}
-							pinger.HashChannel <- inventory.Hash
-						}
 
-						if inventory.Type.String() == "Unknown InvType (14)" {
-							//MNANNOUNCE RECEIVED FOR OUR NODE
-							getdata := wire.MsgGetData{}
-							getdata.AddInvVect(inventory)
+				peerVersion = msg.(*wire.MsgVersion)
 
-							var buf bytes.Buffer
-							wire.WriteMessageN(&buf, &getdata, pinger.ProtocolNumber, magic)
-							conn.Write(buf.Bytes())
+				if owner, ok := localNonces.owner(peerVersion.Nonce); ok {
+					pinger.Logger.Printf("%s : Connected to ourselves, disconnecting\n", pinger.IpAddress)
+					//the outbound side of the loop is not dialed again
+					for _, side := range []*PingerConnection{pinger, owner} {
+						if !side.Inbound {
+							side.Network.banPeer(side.IpAddress, "connection to ourselves")
 						}
 					}
+					owner.SetStatus(-1)
+					conn.Close()
+					pinger.SetStatus(-1)
+					return
 				}
 
-				if msg.Command() == "version" {
-					verack := wire.MsgVerAck{}
+				//the ban is temporary, the peer is tried again once it may have upgraded
+				if uint32(peerVersion.ProtocolVersion) < pinger.Network.Config.MinProtocol {
+					pinger.Logger.Printf("%s : Protocol version %d below the minimum %d\n",
+						pinger.IpAddress, peerVersion.ProtocolVersion, pinger.Network.Config.MinProtocol)
+					pinger.Network.banPeer(pinger.IpAddress, "outdated protocol version")
+					conn.Close()
+					pinger.SetStatus(-1)
+					return
+				}
 
-					var buf bytes.Buffer
-					wire.WriteMessageN(&buf, &verack, pinger.ProtocolNumber, magic)
-					conn.Write(buf.Bytes())
+				pinger.notePeerVersion(peerVersion)
 
-					pinger.SetStatus(1) //we're connected and ready to start pinging
+				//ask for addrv2 so the peer can share its Tor v3 addresses, BIP155
+				//requires it before the verack
+				sendAddrV2 := wire.MsgSendAddrV2{}
+				verack := wire.MsgVerAck{}
 
-					//ignore the request but relay our own 'getaddr' request
-					getaddr := wire.MsgGetAddr{}
+				var buf bytes.Buffer
+				if pinger.Inbound {
+					//answer the version of the peer with ours
+					wire.WriteMessageN(&buf, &version, pinger.ProtocolNumber, magic)
+				}
+				wire.WriteMessageN(&buf, &sendAddrV2, pinger.ProtocolNumber, magic)
+				wire.WriteMessageN(&buf, &verack, pinger.ProtocolNumber, magic)
+				conn.Write(buf.Bytes())
 
-					var bufAddr bytes.Buffer
-					wire.WriteMessageN(&bufAddr, &getaddr, pinger.ProtocolNumber, magic)
-					conn.Write(bufAddr.Bytes())
+				handshake = handshakeVersionReceived
+				continue
+			}
 
-					log.Println("Sending getaddr")
+			if msg.Command() == "verack" {
+				if handshake != handshakeVersionReceived {
+					pinger.Logger.Printf("%s : Verack ignored, handshake state: %s\n", pinger.IpAddress, handshake)
+					continue
+				}
+				handshake = handshakeVerackReceived
 
-					defaultHash := chainhash.Hash{}
-					if pinger.BootstrapHash != defaultHash {
-						getblocks := wire.MsgGetBlocks{}
+				if !pinger.Inbound {
+					pinger.Network.notePeerHandshake(pinger.IpAddress, pinger.Port, peerVersion)
+				}
 
-						getblocks.BlockLocatorHashes = []*chainhash.Hash{&pinger.BootstrapHash}
-						getblocks.ProtocolVersion = pinger.ProtocolNumber
+				pinger.SetStatus(1) //we're connected and ready to start pinging
 
-						var bufBlocks bytes.Buffer
-						wire.WriteMessageN(&bufBlocks, &getblocks, pinger.ProtocolNumber, magic)
-						conn.Write(bufBlocks.Bytes())
+				//ignore the request but relay our own 'getaddr' request
+				getaddr := wire.MsgGetAddr{}
 
-						log.Println("Sending getblocks to bootstrap")
-					}
-				}
+				var bufAddr bytes.Buffer
+				wire.WriteMessageN(&bufAddr, &getaddr, pinger.ProtocolNumber, magic)
+				conn.Write(bufAddr.Bytes())
 
-				if msg.Command() == "ping" {
+				pinger.Logger.Println("Sending getaddr")
 
-					ping := msg.(*wire.MsgPing)
+				defaultHash := chainhash.Hash{}
+				if pinger.BootstrapHash != defaultHash {
+					getblocks := wire.MsgGetBlocks{}
 
-					pong := wire.MsgPong{Nonce: ping.Nonce}
+					getblocks.BlockLocatorHashes = []*chainhash.Hash{&pinger.BootstrapHash}
+					getblocks.ProtocolVersion = pinger.ProtocolNumber
 
-					var buf bytes.Buffer
-					wire.WriteMessageN(&buf, &pong, pinger.ProtocolNumber, magic)
-					conn.Write(buf.Bytes())
+					var bufBlocks bytes.Buffer
+					wire.WriteMessageN(&bufBlocks, &getblocks, pinger.ProtocolNumber, magic)
+					conn.Write(bufBlocks.Bytes())
 
-					log.Printf("%s: pong!\n", pinger.IpAddress)
-
-					//clear out the message map
-					for hash, message := range messageMap {
-						if message.Command() == "mnp" {
-							ping := message.(*wire.MsgMNP)
-							pingTime := time.Unix(int64(ping.SigTime), 0)
-							//if the ping is more than 5 minutes old, delete it
-							if pingTime.Add(time.Minute * 5).Before(time.Now().UTC()) {
-								delete(messageMap, hash)
-							}
+					pinger.Logger.Println("Sending getblocks to bootstrap")
+				}
+
+				pinger.sendGetHeaders(conn, magic)
+				continue
+			}
+
+			//nothing else is expected before the handshake completes
+			if handshake != handshakeVerackReceived {
+				continue
+			}
+
+			if msg.Command() == "inv" {
+				inv := msg.(*wire.MsgInv)
+				unknownBlock := false
+				for _, inventory := range inv.InvList {
+					if inventory.Type.String() == "MSG_BLOCK" {
+						invBlocksSeen.Inc(pinger.Network.Config.Name)
+						if pinger.Network.headers != nil && !pinger.Network.headers.Has(inventory.Hash) {
+							unknownBlock = true
+						}
+						if pinger.Network.noteBlock(inventory.Hash) {
+							pinger.Logger.Println("New block:", inventory.Hash.String())
 						}
+						select {
+						case pinger.HashChannel <- inventory.Hash:
+						case <-ctx.Done():
+						}
+					}
 
-						if message.Command() == "mnb" {
-							mnb := message.(*wire.MsgMNB)
-							pingTime := time.Unix(int64(mnb.LastPing.SigTime), 0)
-							//if the ping is more than 5 minutes old, delete it
-							if pingTime.Add(time.Minute * 5).Before(time.Now().UTC()) {
-								delete(messageMap, hash)
-							}
+					if inventory.Type.String() == "Unknown InvType (15)" {
+						//one of our pings coming back from another peer
+						if name, first := pinger.Network.notePingSeen(inventory.Hash, pinger.IpAddress); first {
+							pinger.Logger.Printf("%s : Ping seen on the network, announced by %s\n", name, pinger.IpAddress)
 						}
 					}
-				}
 
-				if msg.Command() == "addr" {
-					msgAddr := msg.(*wire.MsgAddr)
-					for _, addr := range msgAddr.AddrList {
-						log.Println("PEER: ", addr.IP, ":", addr.Port)
-						pinger.AddrChannel <- *addr
+					if inventory.Type.String() == "Unknown InvType (14)" {
+						//MNANNOUNCE RECEIVED FOR OUR NODE
+						getdata := wire.MsgGetData{}
+						getdata.AddInvVect(inventory)
+
+						var buf bytes.Buffer
+						wire.WriteMessageN(&buf, &getdata, pinger.ProtocolNumber, magic)
+						conn.Write(buf.Bytes())
 					}
 				}
 
-				//let broadcast channels relay back broadcasts
-				if msg.Command() == "mnb" {
-					mnb := msg.(*wire.MsgMNB)
-					if pinger.BroadcastChannel != nil {
-						if mnb.Vin.PreviousOutPoint.String() != currentMnBroadcast {
-							currentMnBroadcast = mnb.Vin.PreviousOutPoint.String()
-							log.Println("MASTERNODE BROADCAST:", mnb.Vin.PreviousOutPoint.String())
-						}
-						pinger.BroadcastChannel <- *mnb
-					}
+				//fetch the headers leading to the announced blocks
+				if unknownBlock {
+					startHeightUsed = true
+					pinger.sendGetHeaders(conn, magic)
 				}
+			}
 
-				//non-blocking select
-				select {
-				case ping := <-pinger.PingChannel:
-					if ping.Name != currentMnRelaying {
-						currentMnRelaying = ping.Name
-						log.Printf("REQUEST RECEIVED, RELAYING: %s\n", ping.Name)
-					}
+			//headers are only requested with a header chain
+			if msg.Command() == "headers" && pinger.Network.headers != nil {
+				headers := msg.(*wire.MsgHeaders)
 
-					mnp := ping.GenerateMasternodePing(pinger.SentinelVersion, pinger.DaemonVersion)
+				last, tipChanged, err := pinger.Network.headers.AddHeaders(headers.Headers)
+				if tipChanged {
+					pinger.Network.noteTip()
+				}
+				if err != nil {
+					pinger.Network.banPeer(pinger.IpAddress, "sent a header with an invalid proof of work")
+					conn.Close()
+					pinger.SetStatus(-1)
+					return
+				}
+
+				if len(headers.Headers) == wire.MaxBlockHeadersPerMsg {
+					pinger.sendGetHeaders(conn, magic)
+				} else if last != (chainhash.Hash{}) && !startHeightUsed {
+					//caught up with the peer, its tip is the one of its version
+					pinger.Network.headers.NoteHeight(pinger.IpAddress, last, peerVersion.LastBlock)
+					startHeightUsed = true
+				}
+			}
+
+			if msg.Command() == "sendaddrv2" {
+				peerAddrV2 = true
+			}
 
-					//check to see if this is a broadcast relay
-					if ping.BroadcastTemplate != nil {
-						//USING BROADCAST TEMPLATE
+			//only the inbound peers are answered, like the nodes do to avoid
+			//fingerprinting
+			if msg.Command() == "getaddr" && pinger.Inbound {
+				pinger.sendAddresses(conn, magic, peerAddrV2)
+			}
 
-						mnb := *ping.BroadcastTemplate
-						mnb.LastPing = mnp
+			if msg.Command() == "ping" {
 
-						inv := wire.MsgInv{}
-						invVec := wire.InvVect{}
-						invVec.Type = 14
-						invVec.Hash = mnb.GetHash()
-						inv.AddInvVect(&invVec)
+				ping := msg.(*wire.MsgPing)
 
-						var buf bytes.Buffer
-						wire.WriteMessageN(&buf, &inv, pinger.ProtocolNumber, magic)
+				pong := wire.MsgPong{Nonce: ping.Nonce}
 
-						byteData := buf.Bytes()
+				var buf bytes.Buffer
+				wire.WriteMessageN(&buf, &pong, pinger.ProtocolNumber, magic)
+				conn.Write(buf.Bytes())
 
-						conn.Write(byteData)
+				pinger.Logger.Printf("%s: pong!\n", pinger.IpAddress)
+			}
 
-						messageMap[invVec.Hash.String()] = &mnb
+			if msg.Command() == "addr" {
+				msgAddr := msg.(*wire.MsgAddr)
+				dropped := 0
+				for _, addr := range msgAddr.AddrList {
+					if !addrs.allow() {
+						dropped++
+						continue
 					}
 
-					//ALWAYS SEND THE PINGS
-					//serialize to a []byte
-					w := new(bytes.Buffer)
-					mnp.Serialize(w)
-					mnpBytes := w.Bytes()
+					pinger.Logger.Println("PEER: ", addr.IP, ":", addr.Port)
+					select {
+					case pinger.AddrChannel <- *addr:
+					case <-ctx.Done():
+					}
+				}
+				pinger.noteAddrDropped(dropped)
+			}
 
-					inv := wire.MsgInv{}
-					invVec := wire.InvVect{}
-					invVec.Type = 15
-					invVec.Hash = chainhash.DoubleHashH(mnpBytes)
-					inv.AddInvVect(&invVec)
+			if msg.Command() == "addrv2" {
+				msgAddr := msg.(*wire.MsgAddrV2)
+				dropped := 0
+				for _, addrV2 := range msgAddr.AddrList {
+					//I2P and CJDNS peers cannot be dialed
+					addr, ok := addrV2.NetAddress()
+					if !ok {
+						continue
+					}
 
-					//send the ping inv
-					var buf bytes.Buffer
-					wire.WriteMessageN(&buf, &inv, pinger.ProtocolNumber, magic)
-					conn.Write(buf.Bytes())
+					if !addrs.allow() {
+						dropped++
+						continue
+					}
 
-					//store the ping
-					messageMap[invVec.Hash.String()] = &mnp
+					pinger.Logger.Println("PEER: ", addr.Hostname(), ":", addr.Port)
+					select {
+					case pinger.AddrChannel <- *addr:
+					case <-ctx.Done():
+					}
+				}
+				pinger.noteAddrDropped(dropped)
+			}
 
-				default:
-					//fmt.Println("no message received")
+			if msg.Command() == "mnp" {
+				//the sentinel fields depend on the payload length and the coin
+				mnp, err := wire.DecodeMNP(payload, pinger.ProtocolNumber, pinger.Network.pingFormat)
+				if err != nil {
+					pinger.Logger.Printf("%s : Malformed %s ping skipped: %s\n", pinger.IpAddress, pinger.Network.pingFormat, err)
+				} else if name, other := pinger.Network.noteNetworkPing(mnp); other {
+					pinger.Logger.Printf("%s : The network has a newer ping signed at %d, the masternode is pinged from somewhere else too\n", name, mnp.SigTime)
 				}
+			}
 
-				//this should really be a hashMap with expiring entries
-				if msg.Command() == "getdata" {
+			//let broadcast channels relay back broadcasts
+			if msg.Command() == "mnb" {
+				mnb := msg.(*wire.MsgMNB)
+				if name, first := pinger.Network.noteNetworkBroadcast(mnb); first {
+					pinger.Logger.Printf("%s : Broadcast seen on the network, signed at %d\n", name, mnb.SigTime)
+				}
+				if pinger.BroadcastChannel != nil {
+					if pinger.Network.noteBroadcast(mnb.Vin.PreviousOutPoint.String()) {
+						pinger.Logger.Println("MASTERNODE BROADCAST:", mnb.Vin.PreviousOutPoint.String())
+					}
+					select {
+					case pinger.BroadcastChannel <- *mnb:
+					case <-ctx.Done():
+					}
+				}
+			}
+
+			//non-blocking select
+			select {
+			case ping, ok := <-pinger.PingChannel:
+				if ok {
+					pinger.relayPing(conn, magic, ping)
+				}
+
+			default:
+				//fmt.Println("no message received")
+			}
 
-					getData := msg.(*wire.MsgGetData)
+			//the pings and broadcasts are served from the relay store shared
+			//by every connection
+			if msg.Command() == "getdata" {
 
-					for _, inv := range getData.InvList {
-						//check the map
-						str := inv.Hash.String()
-						if val, ok := messageMap[str]; ok {
-							//do something here
-							var buf bytes.Buffer
-							wire.WriteMessageN(&buf, val, pinger.ProtocolNumber, magic)
-							conn.Write(buf.Bytes())
+				getData := msg.(*wire.MsgGetData)
+				notFound := wire.NewMsgNotFound()
+
+				for _, inv := range getData.InvList {
+					val, ok := pinger.Network.relay.Get(inv.Hash)
+					if !ok {
+						//expired or never announced, tell the peer so it asks someone else
+						if inv.Type == invTypeMasternodeBroadcast || inv.Type == invTypeMasternodePing {
+							notFound.AddInvVect(inv)
 						}
+						continue
 					}
+
+					var buf bytes.Buffer
+					wire.WriteMessageN(&buf, val, pinger.ProtocolNumber, magic)
+					conn.Write(buf.Bytes())
+
+					getdataServed.Inc(pinger.Network.Config.Name)
+				}
+
+				if len(notFound.InvList) > 0 {
+					var buf bytes.Buffer
+					wire.WriteMessageN(&buf, notFound, pinger.ProtocolNumber, magic)
+					conn.Write(buf.Bytes())
+
+					getdataNotFound.Add(float64(len(notFound.InvList)), pinger.Network.Config.Name)
 				}
 			}
 		}
+	}
+}
 
-		//we've disconnected, so try again
-		connectionAttempts++
-		log.Printf("%s : There's been an error, attempting to reconnect.\n", pinger.IpAddress)
-		time.Sleep(1 * time.Minute)
+// relayPing announces the ping, and its broadcast when there is one, to the
+// peer.
+func (pinger *PingerConnection) relayPing(conn net.Conn, magic wire.BitcoinNet, ping SignedPing) {
+	if pinger.Network.noteRelay(ping.Name) {
+		pinger.Logger.Printf("REQUEST RECEIVED, RELAYING: %s\n", ping.Name)
+	}
+
+	mnp := ping.Ping
+
+	//check to see if this is a broadcast relay
+	if ping.Broadcast != nil {
+		inv := wire.MsgInv{}
+		invVec := wire.InvVect{}
+		invVec.Type = invTypeMasternodeBroadcast
+		invVec.Hash = ping.Broadcast.GetHash()
+		inv.AddInvVect(&invVec)
+
+		var buf bytes.Buffer
+		wire.WriteMessageN(&buf, &inv, pinger.ProtocolNumber, magic)
+
+		byteData := buf.Bytes()
+
+		conn.Write(byteData)
+
+		pinger.Network.relay.Put(invVec.Hash, ping.Broadcast)
+	}
+
+	//ALWAYS SEND THE PINGS
+	inv := wire.MsgInv{}
+	invVec := wire.InvVect{}
+	invVec.Type = invTypeMasternodePing
+	invVec.Hash = mnp.InvHash()
+	inv.AddInvVect(&invVec)
+
+	//send the ping inv
+	var buf bytes.Buffer
+	wire.WriteMessageN(&buf, &inv, pinger.ProtocolNumber, magic)
+	conn.Write(buf.Bytes())
+
+	//store the ping
+	pinger.Network.relay.Put(invVec.Hash, &mnp)
+
+	pinger.Network.notePingRelayed(ping.Name, mnp.SigTime, mnp.BlockHash, invVec.Hash)
+	pingsRelayed.Inc(pinger.Network.Config.Name, ping.Name)
+}
+
+// sendGetHeaders requests the headers following the best tip of the network,
+// if it has a header chain.
+func (pinger *PingerConnection) sendGetHeaders(conn net.Conn, magic wire.BitcoinNet) {
+	if pinger.Network.headers == nil {
+		return
+	}
+
+	locator := pinger.Network.headers.Locator()
+	if len(locator) == 0 {
+		return //nothing to start from yet
+	}
+
+	getheaders := wire.MsgGetHeaders{
+		ProtocolVersion:    pinger.ProtocolNumber,
+		BlockLocatorHashes: locator,
+	}
+
+	var buf bytes.Buffer
+	wire.WriteMessageN(&buf, &getheaders, pinger.ProtocolNumber, magic)
+	conn.Write(buf.Bytes())
+}
+
+// relayPendingPings relays the pings waiting in the channel and returns how
+// many were relayed.
+func (pinger *PingerConnection) relayPendingPings(conn net.Conn, magic wire.BitcoinNet) int {
+	relayed := 0
+	for {
+		select {
+		case ping, ok := <-pinger.PingChannel:
+			if !ok {
+				return relayed
+			}
+			pinger.relayPing(conn, magic, ping)
+			relayed++
+		default:
+			return relayed
+		}
 	}
 }
 
@@ -12,13 +12,21 @@ type CoinConf struct {
 	Magicbytes          string `json:"magicbytes"`
 	Port                uint   `json:"port"`
 	ProtocolNumber      uint   `json:"protocol_number"`
+	MinProtocol         uint   `json:"min_protocol,omitempty"`
 	MagicMessage        string `json:"magic_message"`
 	MagicMessageNewline bool   `json:"magic_message_newline,omitempty"`
 	BootstrapURL        string `json:"bootstrap_url,omitempty"`
-	SentinelVersion     string `json:"sentinel_version,omitempty""`
-	DaemonVersion       string `json:"daemon_version,omitempty""`
-	BootstrapIPs        string `json:"bootstrap_ips,omitempty""`
-	UserAgent           string `json:"user_agent,omitempty""`
+	BootstrapType       string `json:"bootstrap_type,omitempty"`
+	BootstrapQuorum     uint   `json:"bootstrap_quorum,omitempty"`
+	SentinelVersion     string `json:"sentinel_version,omitempty"`
+	DaemonVersion       string `json:"daemon_version,omitempty"`
+	BootstrapIPs        string `json:"bootstrap_ips,omitempty"`
+	UserAgent           string `json:"user_agent,omitempty"`
+	WIFPrefix           string `json:"wif_prefix,omitempty"`
+	PowAlgorithm        string `json:"pow_algorithm,omitempty"`
+	PingFormat          string `json:"ping_format,omitempty"`
+	Proxy               string `json:"proxy,omitempty"`
+	Listen              string `json:"listen,omitempty"`
 }
 
 func LoadCoinConf(path string) (CoinConf, error) {
@@ -7,6 +7,7 @@ import (
 	"strings"
 	"time"
 
+	"../proxy"
 	"../socket/wire"
 )
 
@@ -21,17 +22,39 @@ func ConvertVersionStringToInt(str string) uint32 {
 	return uint32(version)
 }
 
+// SplitAddress parses an ip:port pair, IPv6 addresses are given in brackets
+// (i.e. "[2001:db8::1]:1234") and Tor peers by their .onion name.
 func SplitAddress(pair string) (wire.NetAddress, error) {
-	ipPort := strings.Split(pair, ":")
-	if len(ipPort) != 2 {
+	host, portString, err := net.SplitHostPort(strings.TrimSpace(pair))
+	if err != nil {
 		return wire.NetAddress{}, errors.New("invalid ip:port pair")
 	}
-	ip := ipPort[0]
-	port, _ := strconv.Atoi(ipPort[1])
-	return wire.NetAddress{time.Now(),
-		0,
-		net.ParseIP(ip),
-		uint16(port)}, nil
+
+	port, err := strconv.ParseUint(portString, 10, 16)
+	if err != nil {
+		return wire.NetAddress{}, errors.New("invalid ip:port pair")
+	}
+
+	address, ok := hostAddress(host, uint16(port))
+	if !ok {
+		return wire.NetAddress{}, errors.New("invalid ip:port pair")
+	}
+	address.Timestamp = time.Now()
+
+	return address, nil
+}
+
+// hostAddress returns the address of a peer given by IP or .onion name.
+func hostAddress(host string, port uint16) (wire.NetAddress, bool) {
+	if ip := net.ParseIP(host); ip != nil {
+		return wire.NetAddress{IP: ip, Port: port}, true
+	}
+
+	if proxy.IsOnion(host) {
+		return wire.NetAddress{Host: strings.ToLower(host), Port: port}, true
+	}
+
+	return wire.NetAddress{}, false
 }
 
 func SplitAddressList(bootstraps string) (addresses []wire.NetAddress) {
@@ -33,10 +33,9 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/hex"
+	"errors"
 	"fmt"
-	"log"
 	"os"
-	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -48,6 +47,10 @@ import (
 	"github.com/btcsuite/btcd/btcutil"
 )
 
+// ErrPingSignature is returned when a ping is not signed by the masternode
+// key.
+var ErrPingSignature = errors.New("the ping is not signed by the masternode key")
+
 type MasternodePing struct {
 	Name              string
 	OutpointHash      string
@@ -57,31 +60,49 @@ type MasternodePing struct {
 	MagicMessage      string
 	SentinelVersion   uint32
 	DaemonVersion     uint32
-	HashQueue         *Queue
+	BlockHash         chainhash.Hash
+	PingFormat        wire.PingFormat
 	BroadcastTemplate *wire.MsgMNB
 }
 
-type pingSlice []MasternodePing
-
-func (p pingSlice) Len() int {
-	return len(p)
+// MasternodeEntry is a single line of the masternode file.
+type MasternodeEntry struct {
+	Name          string
+	Address       string
+	PrivateKey    string
+	OutpointHash  string
+	OutpointIndex uint32
+	Epoch         int64
+	EpochAssumed  bool
+	Tags          []string
+	Location      string
+
+	//optional, a broadcast is created for the masternode with either the
+	//collateral key or the collateral public key and an offline signature
+	CollateralKey    string
+	CollateralPubKey string
+	BroadcastSig     string
+	BroadcastSigTime int64
 }
 
-func (p pingSlice) Less(i, j int) bool {
-	return p[i].PingTime.Before(p[j].PingTime)
+// Outpoint returns the collateral outpoint in the txid:index form.
+func (entry MasternodeEntry) Outpoint() string {
+	return entry.OutpointHash + ":" + strconv.Itoa(int(entry.OutpointIndex))
 }
 
-func (p pingSlice) Swap(i, j int) {
-	p[i], p[j] = p[j], p[i]
+// MasternodeConfError lists every problem found while loading a masternode
+// file so they can be fixed in one go.
+type MasternodeConfError struct {
+	Path     string
+	Problems []string
 }
 
-func determinePingTime(unixTime string) time.Time {
+func (e *MasternodeConfError) Error() string {
+	return fmt.Sprintf("%s: %d problem(s) found:\n\t%s", e.Path, len(e.Problems), strings.Join(e.Problems, "\n\t"))
+}
 
-	i, err := strconv.ParseInt(unixTime, 10, 64)
-	if err != nil {
-		panic(err)
-	}
-	base := time.Unix(i, 0)
+func determinePingTime(epoch int64) time.Time {
+	base := time.Unix(epoch, 0)
 
 	difference := time.Now().UTC().Sub(base)
 
@@ -92,98 +113,106 @@ func determinePingTime(unixTime string) time.Time {
 	return base.Add(result)
 }
 
-func GeneratePingsFromMasternodeFile(filePath string, pingChannel chan MasternodePing, queue *Queue,
-	magicMessage string, sentinelVersion uint32, daemonVersion uint32, broadcastSet map[string]wire.MsgMNB) {
-
+// LoadMasternodeFile parses the whole masternode file. When a line is invalid
+// a *MasternodeConfError listing every problem is returned along with the
+// entries that could be parsed.
+func LoadMasternodeFile(filePath string) ([]MasternodeEntry, error) {
 	currentTime := time.Now().UTC()
 
 	file, err := os.Open(filePath)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	defer file.Close()
 
-	pings := make(pingSlice, 0)
+	entries := make([]MasternodeEntry, 0)
+	confError := &MasternodeConfError{Path: filePath}
+	aliases := make(map[string]string)
 
 	scanner := bufio.NewScanner(file)
 
 	i := 0
+	lineNumber := 0
 	for scanner.Scan() {
-		line := scanner.Text()
+		lineNumber++
+
+		line := strings.TrimSpace(scanner.Text())
 		if len(line) < 1 || line[0] == '#' {
 			continue
 		}
 
 		fields := strings.Fields(line)
 
+		location := "line " + strconv.Itoa(lineNumber)
+		entry := MasternodeEntry{Location: location}
+
 		//add an epoch if missing and alert
 		if len(fields) == 5 {
 			// log.Println("No epoch time found for: ", fields[0], " assuming one.")
 			fields = append(fields, strconv.FormatInt(currentTime.Add(time.Duration(i)*time.Second).Unix()-540, 10))
+			entry.EpochAssumed = true
 			i++
 		}
 
 		if len(fields) != 6 {
-			log.Println("Error processing: ", line)
+			confError.Problems = append(confError.Problems,
+				fmt.Sprintf("%s: expected 6 fields (alias ip:port privkey txid index epoch), found %d", location, len(fields)))
 			continue
 		}
 
-		outputIndex, err := strconv.Atoi(fields[4])
+		entry.Name = fields[0]
+		entry.Address = fields[1]
+		entry.PrivateKey = fields[2]
+		entry.OutpointHash = fields[3]
+
+		valid := true
+
+		outputIndex, err := strconv.ParseUint(fields[4], 10, 32)
 		if err != nil {
-			log.Println("Error reading masternode index value.")
+			confError.Problems = append(confError.Problems,
+				fmt.Sprintf("%s (%s): invalid masternode index value %q", location, entry.Name, fields[4]))
+			valid = false
 		}
+		entry.OutpointIndex = uint32(outputIndex)
 
-		ping := MasternodePing{fields[0],
-			fields[3],
-			uint32(outputIndex),
-			fields[2],
-			determinePingTime(fields[5]),
-			magicMessage,
-			sentinelVersion,
-			daemonVersion,
-			queue,
-			nil,
+		entry.Epoch, err = strconv.ParseInt(fields[5], 10, 64)
+		if err != nil {
+			confError.Problems = append(confError.Problems,
+				fmt.Sprintf("%s (%s): invalid epoch value %q", location, entry.Name, fields[5]))
+			valid = false
 		}
 
-		if broadcastSet != nil {
-			//check for a broadcast template
-			broadcast, ok := broadcastSet[ping.OutpointHash+
-				":"+strconv.Itoa(int(ping.OutpointIndex))]
-
-			//provide the template
-			if ok {
-				ping.BroadcastTemplate = &broadcast
-
-				//remove the broadcast after 24 hours
-				sigTime := time.Unix(int64(broadcast.SigTime), 0)
-				if sigTime.Add(time.Hour * 24).Before(time.Now().UTC()) {
-					delete(broadcastSet, ping.OutpointHash+
-						":"+strconv.Itoa(int(ping.OutpointIndex)))
-				}
-			}
+		if previous, ok := aliases[entry.Name]; ok {
+			confError.Problems = append(confError.Problems,
+				fmt.Sprintf("%s: alias %s already used on %s", location, entry.Name, previous))
+			valid = false
+		} else {
+			aliases[entry.Name] = location
 		}
 
-		pings = append(pings, ping)
+		if valid {
+			entries = append(entries, entry)
+		}
 	}
 
-	//sort the pings by time
-	sort.Sort(pings)
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
 
-	//we have a sorted list of pings -- add them to the channel
-	for _, ping := range pings {
-		//fmt.Println("Enabling: ", ping.Name)
-		log.Printf("%s : Enabling.\n", ping.Name)
-		pingChannel <- ping
+	if len(confError.Problems) > 0 {
+		return entries, confError
 	}
 
+	return entries, nil
 }
 
-func (ping *MasternodePing) GenerateMasternodePing(sentinelVersion uint32, daemonVersion uint32) wire.MsgMNP {
-	mnp := wire.MsgMNP{}
+func (ping *MasternodePing) GenerateMasternodePing(sentinelVersion uint32, daemonVersion uint32) (wire.MsgMNP, error) {
+	mnp := wire.MsgMNP{Format: ping.PingFormat}
 
 	//add sentinel support
 	if sentinelVersion > 0 {
 		mnp.SentinelEnabled = true
+		mnp.SentinelIsCurrent = true
 		mnp.SentinelVersion = sentinelVersion
 	}
 
@@ -193,7 +222,11 @@ func (ping *MasternodePing) GenerateMasternodePing(sentinelVersion uint32, daemo
 		mnp.DaemonVersion = daemonVersion
 	}
 
-	mnp.BlockHash = *ping.HashQueue.Peek()
+	//never sign a ping with a missing or stale block hash
+	if ping.BlockHash == (chainhash.Hash{}) {
+		return mnp, ErrNoRecentHash
+	}
+	mnp.BlockHash = ping.BlockHash
 
 	//setup the outpoint
 	var outpointHash chainhash.Hash
@@ -209,27 +242,99 @@ func (ping *MasternodePing) GenerateMasternodePing(sentinelVersion uint32, daemo
 	//sign the ping
 	wif, err := btcutil.DecodeWIF(ping.PrivateKey)
 	if err != nil {
-		log.Println(err)
+		return wire.MsgMNP{}, err
 	}
 
-	signatureHash := GenerateMNPSignature(ping.MagicMessage, mnp.Vin.PreviousOutPoint.Hash.String(), mnp.Vin.PreviousOutPoint.Index, mnp.Vin.SignatureScript, mnp.BlockHash.String(), mnp.SigTime, *wif.PrivKey)
+	compressed := pingKeyCompressed(wif, ping.BroadcastTemplate)
+
+	var signature []byte
+	switch mnp.Format {
+	case wire.PingFormatLegacy:
+		signature, err = GenerateMNPSignature(ping.MagicMessage, mnp.Vin.PreviousOutPoint.Hash.String(), mnp.Vin.PreviousOutPoint.Index, mnp.Vin.SignatureScript, mnp.BlockHash.String(), mnp.SigTime, *wif.PrivKey, compressed)
+	default:
+		if mnp.Format == wire.PingFormatPIVX {
+			mnp.MessageVersion = wire.PingMessageVersionHash
+		}
+		signature, err = GenerateMNPHashSignature(&mnp, *wif.PrivKey, compressed)
+	}
 	if err != nil {
-		log.Println(err)
+		return wire.MsgMNP{}, err
 	}
 
 	//push the bytes to the mnp
-	mnp.VchSig = signatureHash
+	mnp.VchSig = signature
 
-	return mnp
+	return mnp, nil
 }
 
-func GenerateMNPSignature(magicMessage string, hash string, n uint32, scriptSig []byte, blockHash string, sigTime uint64, privKey btcec.PrivateKey) []byte {
-	var buf bytes.Buffer
-	wire.WriteVarString(&buf, 0, magicMessage) //"DarkCoin Signed Message:\n" - $PAC || "ProtonCoin Signed Message:\n" - ANDS
-	wire.WriteVarString(&buf, 0, fmt.Sprintf("CTxIn(COutPoint(%s, %d), scriptSig=%s)%s%s", hash, n, hex.EncodeToString(scriptSig), blockHash, strconv.FormatInt(int64(sigTime), 10)))
-	expectedMessageHash := chainhash.DoubleHashB(buf.Bytes())
+// pingKeyCompressed reports whether the pings are signed for the compressed
+// masternode key. The nodes compare the key id of the recovered key with the
+// announced masternode key, so the key announced by the broadcast wins over
+// the compression of the wif.
+func pingKeyCompressed(wif *btcutil.WIF, template *wire.MsgMNB) bool {
+	if template != nil {
+		return len(template.PubKeyMasternode) == btcec.PubKeyBytesLenCompressed
+	}
+	return wif.CompressPubKey
+}
+
+// GenerateMNPMessage returns the message signed by the masternode key.
+func GenerateMNPMessage(hash string, n uint32, scriptSig []byte, blockHash string, sigTime uint64) string {
+	return fmt.Sprintf("CTxIn(COutPoint(%s, %d), scriptSig=%s)%s%s", hash, n, hex.EncodeToString(scriptSig), blockHash, strconv.FormatInt(int64(sigTime), 10))
+}
 
-	sig, _ := ecdsa.SignCompact(&privKey, expectedMessageHash, false)
+func GenerateMNPSignature(magicMessage string, hash string, n uint32, scriptSig []byte, blockHash string, sigTime uint64, privKey btcec.PrivateKey, compressed bool) ([]byte, error) {
+	//"DarkCoin Signed Message:\n" - $PAC || "ProtonCoin Signed Message:\n" - ANDS
+	message := GenerateMNPMessage(hash, n, scriptSig, blockHash, sigTime)
+
+	sig, err := ecdsa.SignCompact(&privKey, signedMessageHash(magicMessage, message), compressed)
+	if err != nil {
+		return nil, fmt.Errorf("unable to sign the ping: %v", err)
+	}
+
+	return sig, nil
+}
+
+// GenerateMNPHashSignature signs the hash of the ping, used by the
+// hash-based and PIVX formats. The hash is signed as is, without the magic
+// message.
+func GenerateMNPHashSignature(mnp *wire.MsgMNP, privKey btcec.PrivateKey, compressed bool) ([]byte, error) {
+	hash := mnp.SignatureHash()
+
+	sig, err := ecdsa.SignCompact(&privKey, hash[:], compressed)
+	if err != nil {
+		return nil, fmt.Errorf("unable to sign the ping: %v", err)
+	}
+
+	return sig, nil
+}
+
+// VerifyMasternodePing checks that the ping is signed by the masternode key,
+// the magic message only applies to the legacy format and to the PIVX pings
+// without a message version.
+func VerifyMasternodePing(mnp *wire.MsgMNP, magicMessage string, pubKeyMasternode []byte) error {
+	var signedHash []byte
+	if mnp.Format == wire.PingFormatLegacy || (mnp.Format == wire.PingFormatPIVX && mnp.MessageVersion != wire.PingMessageVersionHash) {
+		message := GenerateMNPMessage(mnp.Vin.PreviousOutPoint.Hash.String(), mnp.Vin.PreviousOutPoint.Index, mnp.Vin.SignatureScript, mnp.BlockHash.String(), mnp.SigTime)
+		signedHash = signedMessageHash(magicMessage, message)
+	} else {
+		hash := mnp.SignatureHash()
+		signedHash = hash[:]
+	}
+
+	pubKey, compressed, err := ecdsa.RecoverCompact(mnp.VchSig, signedHash)
+	if err != nil {
+		return fmt.Errorf("invalid ping signature: %v", err)
+	}
+
+	recovered := pubKey.SerializeUncompressed()
+	if compressed {
+		recovered = pubKey.SerializeCompressed()
+	}
+
+	if !bytes.Equal(recovered, pubKeyMasternode) {
+		return ErrPingSignature
+	}
 
-	return sig
+	return nil
 }
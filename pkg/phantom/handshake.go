@@ -0,0 +1,168 @@
+/**
+*    Copyright (C) 2019-present C2CV Holdings, LLC.
+*
+*    This program is free software: you can redistribute it and/or modify
+*    it under the terms of the Server Side Public License, version 1,
+*    as published by C2CV Holdings, LLC.
+*
+*    This program is distributed in the hope that it will be useful,
+*    but WITHOUT ANY WARRANTY; without even the implied warranty of
+*    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*    Server Side Public License for more details.
+*
+*    You should have received a copy of the Server Side Public License
+*    along with this program. If not, see
+*    <http://www.mongodb.com/licensing/server-side-public-license>.
+*
+*    As a special exception, the copyright holders give permission to link the
+*    code of portions of this program with the OpenSSL library under certain
+*    conditions as described in each individual source file and distribute
+*    linked combinations including the program with the OpenSSL library. You
+*    must comply with the Server Side Public License in all respects for
+*    all of the code used other than as permitted herein. If you modify file(s)
+*    with this exception, you may extend this exception to your version of the
+*    file(s), but you are not obligated to do so. If you do not wish to do so,
+*    delete this exception statement from your version. If you delete this
+*    exception statement from all source files in the program, then also delete
+*    it in the license file.
+ */
+
+package phantom
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"../socket/wire"
+)
+
+// the phantom serves no blocks nor transactions, it advertises no service
+const localServices wire.ServiceFlag = 0
+
+// handshakeState tracks the version handshake of a connection. The peer is
+// ready once both versions were exchanged and its verack received.
+type handshakeState uint8
+
+const (
+	handshakeNone handshakeState = iota
+	handshakeVersionSent
+	handshakeVersionReceived
+	handshakeVerackReceived
+)
+
+func (s handshakeState) String() string {
+	switch s {
+	case handshakeVersionSent:
+		return "version sent"
+	case handshakeVersionReceived:
+		return "version received"
+	case handshakeVerackReceived:
+		return "verack received"
+	}
+	return "none"
+}
+
+// nonceSet holds the nonces of the versions sent by every network of the
+// process, a version coming back with one of them is a connection to
+// ourselves.
+type nonceSet struct {
+	mutex  sync.Mutex
+	owners map[uint64]*PingerConnection
+}
+
+var localNonces = &nonceSet{owners: make(map[uint64]*PingerConnection)}
+
+// add returns a new random nonce for the version sent by pinger.
+func (s *nonceSet) add(pinger *PingerConnection) (uint64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for {
+		nonce, err := wire.RandomUint64()
+		if err != nil {
+			return 0, err
+		}
+		if _, ok := s.owners[nonce]; !ok && nonce != 0 {
+			s.owners[nonce] = pinger
+			return nonce, nil
+		}
+	}
+}
+
+func (s *nonceSet) remove(nonce uint64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.owners, nonce)
+}
+
+// owner returns the connection which sent a version with nonce.
+func (s *nonceSet) owner(nonce uint64) (*PingerConnection, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	pinger, ok := s.owners[nonce]
+	return pinger, ok
+}
+
+// newVersion builds the version sent to the peer, the start height is the
+// tip of the header chain.
+func (pinger *PingerConnection) newVersion(userAgent string, nonce uint64) wire.MsgVersion {
+	//like the nodes, our own address is left unspecified
+	me := wire.NetAddress{
+		Services: localServices,
+		IP:       net.IPv4zero,
+	}
+
+	//a .onion peer has no ip, the address is sent as zeros
+	you := wire.NetAddress{
+		IP:   net.ParseIP(pinger.IpAddress),
+		Port: pinger.Port,
+	}
+
+	_, height := pinger.Network.chainTip()
+	if height < 0 {
+		height = 0 //unknown yet
+	}
+
+	return wire.MsgVersion{
+		ProtocolVersion: int32(pinger.ProtocolNumber),
+		Services:        localServices,
+		Timestamp:       time.Unix(time.Now().Unix(), 0),
+		AddrYou:         you,
+		AddrMe:          me,
+		Nonce:           nonce,
+		UserAgent:       userAgent,
+		LastBlock:       height,
+		DisableRelayTx:  true,
+	}
+}
+
+// notePeerVersion records what the peer told about itself in its version.
+func (pinger *PingerConnection) notePeerVersion(version *wire.MsgVersion) {
+	pinger.Mutex.Lock()
+	defer pinger.Mutex.Unlock()
+
+	pinger.PeerUserAgent = version.UserAgent
+	pinger.PeerServices = version.Services
+	pinger.PeerProtocol = uint32(version.ProtocolVersion)
+	pinger.PeerStartHeight = version.LastBlock
+}
+
+// connectionStatus describes the connection and the peer on the other end.
+func (pinger *PingerConnection) connectionStatus() ConnectionStatus {
+	pinger.Mutex.Lock()
+	defer pinger.Mutex.Unlock()
+
+	return ConnectionStatus{
+		Address:     pinger.IpAddress,
+		Port:        pinger.Port,
+		Status:      pinger.Status,
+		Inbound:     pinger.Inbound,
+		UserAgent:   pinger.PeerUserAgent,
+		Services:    uint64(pinger.PeerServices),
+		Protocol:    pinger.PeerProtocol,
+		StartHeight: pinger.PeerStartHeight,
+	}
+}
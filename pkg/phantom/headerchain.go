@@ -0,0 +1,339 @@
+/**
+*    Copyright (C) 2019-present C2CV Holdings, LLC.
+*
+*    This program is free software: you can redistribute it and/or modify
+*    it under the terms of the Server Side Public License, version 1,
+*    as published by C2CV Holdings, LLC.
+*
+*    This program is distributed in the hope that it will be useful,
+*    but WITHOUT ANY WARRANTY; without even the implied warranty of
+*    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*    Server Side Public License for more details.
+*
+*    You should have received a copy of the Server Side Public License
+*    along with this program. If not, see
+*    <http://www.mongodb.com/licensing/server-side-public-license>.
+*
+*    As a special exception, the copyright holders give permission to link the
+*    code of portions of this program with the OpenSSL library under certain
+*    conditions as described in each individual source file and distribute
+*    linked combinations including the program with the OpenSSL library. You
+*    must comply with the Server Side Public License in all respects for
+*    all of the code used other than as permitted herein. If you modify file(s)
+*    with this exception, you may extend this exception to your version of the
+*    file(s), but you are not obligated to do so. If you do not wish to do so,
+*    delete this exception statement from your version. If you delete this
+*    exception statement from all source files in the program, then also delete
+*    it in the license file.
+ */
+
+package phantom
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"sync"
+	"time"
+
+	"../powhash"
+	"../socket/wire"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+const (
+	//the ping signs the hash of the block pingDepth blocks below the tip
+	pingDepth = 12
+
+	//headers further than this below the tip are pruned
+	headerKeepDepth = 1000
+)
+
+// ErrInvalidProofOfWork is returned for headers whose proof of work hash
+// does not meet their own difficulty target.
+var ErrInvalidProofOfWork = errors.New("header proof of work does not meet its target")
+
+type headerNode struct {
+	hash   chainhash.Hash
+	parent *headerNode
+	height int32
+	work   *big.Int
+}
+
+// HeaderChain is a lightweight header tree shared by the connections of a
+// network. It is anchored on a known hash rather than the genesis block, so
+// heights are relative to the anchor until a peer reports its height, and
+// follows the tip with the most cumulative work.
+type HeaderChain struct {
+	mutex        sync.Mutex
+	algorithm    powhash.Algorithm
+	nodes        map[chainhash.Hash]*headerNode
+	tip          *headerNode
+	tipTime      time.Time
+	heightOffset int32
+	heightKnown  bool
+	heightVotes  []heightVote
+}
+
+// maxHeightVotes is the number of height reports the offset is derived
+// from, the oldest are dropped first.
+const maxHeightVotes = 16
+
+// heightVote is the offset between the heights of the chain and the height
+// reported by a source, a peer or the explorers.
+type heightVote struct {
+	source string
+	offset int32
+}
+
+func NewHeaderChain(algorithm powhash.Algorithm) *HeaderChain {
+	return &HeaderChain{
+		algorithm: algorithm,
+		nodes:     make(map[chainhash.Hash]*headerNode),
+	}
+}
+
+// Anchor roots the chain on a hash whose header is unknown. It has no effect
+// once the chain has a tip.
+func (c *HeaderChain) Anchor(hash chainhash.Hash) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.tip != nil {
+		return
+	}
+
+	c.tip = &headerNode{hash: hash, work: new(big.Int)}
+	c.nodes[hash] = c.tip
+	c.tipTime = time.Now()
+}
+
+// Has reports whether the hash is part of the chain.
+func (c *HeaderChain) Has(hash chainhash.Hash) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	_, ok := c.nodes[hash]
+	return ok
+}
+
+// AddHeaders connects the headers to the chain. Headers whose parent is
+// unknown are skipped. It returns the hash of the last header connected and
+// whether the tip changed, or ErrInvalidProofOfWork once a header fails its
+// proof of work, the headers before it staying connected.
+func (c *HeaderChain) AddHeaders(headers []*wire.BlockHeader) (chainhash.Hash, bool, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var last chainhash.Hash
+	var err error
+	tipChanged := false
+
+	for _, header := range headers {
+		var buf bytes.Buffer
+		header.Serialize(&buf)
+		hash := c.algorithm.BlockHash(buf.Bytes())
+
+		if node, ok := c.nodes[hash]; ok {
+			last = node.hash
+			continue
+		}
+
+		parent, ok := c.nodes[header.PrevBlock]
+		if !ok {
+			continue
+		}
+
+		if !checkProofOfWork(c.algorithm.PowHash(buf.Bytes()), header.Bits) {
+			err = ErrInvalidProofOfWork
+			break
+		}
+
+		node := &headerNode{
+			hash:   hash,
+			parent: parent,
+			height: parent.height + 1,
+			work:   new(big.Int).Add(parent.work, blockWork(header.Bits)),
+		}
+		c.nodes[hash] = node
+		last = hash
+
+		if node.work.Cmp(c.tip.work) > 0 {
+			c.tip = node
+			c.tipTime = time.Now()
+			tipChanged = true
+		}
+	}
+
+	if tipChanged {
+		c.prune()
+	}
+
+	return last, tipChanged, err
+}
+
+// prune drops the headers too deep below the tip to matter. The caller holds
+// the mutex.
+func (c *HeaderChain) prune() {
+	cutoff := c.tip.height - headerKeepDepth
+	if len(c.nodes) < 2*headerKeepDepth {
+		return
+	}
+
+	for hash, node := range c.nodes {
+		if node.height < cutoff {
+			delete(c.nodes, hash)
+		} else if node.height == cutoff {
+			node.parent = nil
+		}
+	}
+}
+
+// Locator returns the block locator of the tip, the 10 last hashes followed
+// by exponentially spaced ones.
+func (c *HeaderChain) Locator() []*chainhash.Hash {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var locator []*chainhash.Hash
+
+	step := 1
+	for node := c.tip; node != nil; {
+		hash := node.hash
+		locator = append(locator, &hash)
+
+		if len(locator) >= 10 {
+			step *= 2
+		}
+
+		for i := 0; i < step && node != nil; i++ {
+			node = node.parent
+		}
+	}
+
+	return locator
+}
+
+// Tip returns the hash and height of the best tip, the height is -1 until a
+// peer reported its height.
+func (c *HeaderChain) Tip() (chainhash.Hash, int32) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.tip == nil {
+		return chainhash.Hash{}, -1
+	}
+
+	if !c.heightKnown {
+		return c.tip.hash, -1
+	}
+	return c.tip.hash, c.tip.height + c.heightOffset
+}
+
+// NoteHeight records the height source reported for a hash of the chain.
+// The heights of every header are derived from the offset reported by the
+// most sources, the higher one on a tie as a peer whose chain advanced since
+// it reported its height can only give a lower one.
+func (c *HeaderChain) NoteHeight(source string, hash chainhash.Hash, height int32) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	node, ok := c.nodes[hash]
+	if !ok || height <= 0 {
+		return
+	}
+
+	vote := heightVote{source: source, offset: height - node.height}
+	for i, previous := range c.heightVotes {
+		if previous.source == source {
+			c.heightVotes = append(c.heightVotes[:i], c.heightVotes[i+1:]...)
+			break
+		}
+	}
+	c.heightVotes = append(c.heightVotes, vote)
+	if len(c.heightVotes) > maxHeightVotes {
+		c.heightVotes = c.heightVotes[1:]
+	}
+
+	counts := make(map[int32]int)
+	best := 0
+	for _, v := range c.heightVotes {
+		counts[v.offset]++
+		if count := counts[v.offset]; count > best || (count == best && v.offset > c.heightOffset) {
+			best = count
+			c.heightOffset = v.offset
+		}
+	}
+	c.heightKnown = true
+}
+
+// PingHash returns the hash exactly pingDepth blocks below the best tip,
+// provided the tip changed within maxAge and the chain is deep enough.
+func (c *HeaderChain) PingHash(maxAge time.Duration) (chainhash.Hash, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.tip == nil || time.Since(c.tipTime) > maxAge {
+		return chainhash.Hash{}, false
+	}
+
+	node := c.tip
+	for i := 0; i < pingDepth; i++ {
+		if node.parent == nil {
+			return chainhash.Hash{}, false
+		}
+		node = node.parent
+	}
+
+	return node.hash, true
+}
+
+// checkProofOfWork reports whether the proof of work hash, read as a little
+// endian number, is at most the compact difficulty target.
+func checkProofOfWork(hash chainhash.Hash, bits uint32) bool {
+	target := compactToBig(bits)
+	if target.Sign() <= 0 {
+		return false
+	}
+
+	for i, j := 0, len(hash)-1; i < j; i, j = i+1, j-1 {
+		hash[i], hash[j] = hash[j], hash[i]
+	}
+	return new(big.Int).SetBytes(hash[:]).Cmp(target) <= 0
+}
+
+// blockWork returns the work represented by the compact difficulty target,
+// 2^256 / (target + 1).
+func blockWork(bits uint32) *big.Int {
+	target := compactToBig(bits)
+	if target.Sign() <= 0 {
+		return new(big.Int)
+	}
+
+	denominator := new(big.Int).Add(target, big.NewInt(1))
+	return new(big.Int).Div(new(big.Int).Lsh(big.NewInt(1), 256), denominator)
+}
+
+// compactToBig converts the compact representation of a difficulty target to
+// a big integer, see CompactToBig in btcd.
+func compactToBig(compact uint32) *big.Int {
+	mantissa := compact & 0x007fffff
+	isNegative := compact&0x00800000 != 0
+	exponent := uint(compact >> 24)
+
+	var bn *big.Int
+	if exponent <= 3 {
+		mantissa >>= 8 * (3 - exponent)
+		bn = big.NewInt(int64(mantissa))
+	} else {
+		bn = big.NewInt(int64(mantissa))
+		bn.Lsh(bn, 8*(exponent-3))
+	}
+
+	if isNegative {
+		bn = bn.Neg(bn)
+	}
+
+	return bn
+}
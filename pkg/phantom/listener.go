@@ -0,0 +1,225 @@
+/**
+*    Copyright (C) 2019-present C2CV Holdings, LLC.
+*
+*    This program is free software: you can redistribute it and/or modify
+*    it under the terms of the Server Side Public License, version 1,
+*    as published by C2CV Holdings, LLC.
+*
+*    This program is distributed in the hope that it will be useful,
+*    but WITHOUT ANY WARRANTY; without even the implied warranty of
+*    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*    Server Side Public License for more details.
+*
+*    You should have received a copy of the Server Side Public License
+*    along with this program. If not, see
+*    <http://www.mongodb.com/licensing/server-side-public-license>.
+*
+*    As a special exception, the copyright holders give permission to link the
+*    code of portions of this program with the OpenSSL library under certain
+*    conditions as described in each individual source file and distribute
+*    linked combinations including the program with the OpenSSL library. You
+*    must comply with the Server Side Public License in all respects for
+*    all of the code used other than as permitted herein. If you modify file(s)
+*    with this exception, you may extend this exception to your version of the
+*    file(s), but you are not obligated to do so. If you do not wish to do so,
+*    delete this exception statement from your version. If you delete this
+*    exception statement from all source files in the program, then also delete
+*    it in the license file.
+ */
+
+package phantom
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"time"
+
+	"../socket/wire"
+)
+
+//inbound connections accepted from a single ip
+const inboundPerHost = 2
+
+//the addresses given to a getaddr, like the nodes only recent ones are shared
+const (
+	getaddrMaxAge    = 3 * time.Hour
+	getaddrMaxCount  = 1000
+	acceptRetryDelay = time.Second
+)
+
+// listen accepts the inbound connections on the listen address until ctx is
+// cancelled, the accepted connections run on connectionCtx like the outbound
+// ones.
+func (n *Network) listen(ctx context.Context, connectionCtx context.Context) error {
+	listener, err := net.Listen("tcp", n.Config.Listen)
+	if err != nil {
+		return err
+	}
+
+	n.Logger.Println("Accepting inbound connections on", listener.Addr().String())
+
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	go n.acceptInbound(connectionCtx, listener)
+
+	return nil
+}
+
+func (n *Network) acceptInbound(ctx context.Context, listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			n.Logger.Println("Listener:", err)
+			time.Sleep(acceptRetryDelay)
+			continue
+		}
+
+		pinger, reason := n.newInboundPinger(conn)
+		if pinger == nil {
+			inboundRejected.Inc(n.Config.Name)
+			n.Logger.Printf("%s : Inbound connection refused: %s\n", conn.RemoteAddr().String(), reason)
+			conn.Close()
+			continue
+		}
+
+		key := conn.RemoteAddr().String()
+		n.waitGroup.Add(1)
+		go func() {
+			pinger.Start(ctx, n.Config.UserAgent)
+
+			n.mutex.Lock()
+			delete(n.inboundSet, key)
+			n.mutex.Unlock()
+		}()
+	}
+}
+
+// newInboundPinger registers the connection in the inbound set, nil and the
+// reason are returned when the peer is banned or the slots are used.
+func (n *Network) newInboundPinger(conn net.Conn) (*PingerConnection, string) {
+	host, portString, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return nil, err.Error()
+	}
+	port, _ := strconv.ParseUint(portString, 10, 16)
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if n.isBanned(host) {
+		return nil, "banned"
+	}
+
+	if len(n.inboundSet) >= int(n.Config.MaxInbound) {
+		return nil, "no inbound slot left"
+	}
+
+	fromHost := 0
+	for _, pinger := range n.inboundSet {
+		if pinger.IpAddress == host {
+			fromHost++
+		}
+	}
+	if fromHost >= inboundPerHost {
+		return nil, "too many connections from the same ip"
+	}
+
+	pinger := n.newPinger(wire.NetAddress{IP: net.ParseIP(host), Port: uint16(port)})
+	pinger.Inbound = true
+	pinger.conn = conn
+
+	n.inboundSet[conn.RemoteAddr().String()] = pinger
+
+	return pinger, ""
+}
+
+// inboundPingers returns the inbound connections that completed the
+// handshake.
+func (n *Network) inboundPingers() []*PingerConnection {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	pingers := make([]*PingerConnection, 0, len(n.inboundSet))
+	for _, pinger := range n.inboundSet {
+		if pinger.GetStatus() > 0 {
+			pingers = append(pingers, pinger)
+		}
+	}
+	return pingers
+}
+
+// knownAddresses returns the recently seen peers of the address book, the
+// .onion ones only when the peer understands addrv2.
+func (n *Network) knownAddresses(onion bool) []wire.NetAddress {
+	if n.addressBook == nil {
+		return nil
+	}
+
+	records, err := n.addressBook.Peers()
+	if err != nil {
+		n.Logger.Println("Address book:", err)
+		return nil
+	}
+
+	cutoff := time.Now().Add(-getaddrMaxAge)
+
+	var addresses []wire.NetAddress
+	for _, record := range records {
+		address, ok := recordAddress(record)
+		if !ok || (address.Host != "" && !onion) {
+			continue
+		}
+
+		if record.LastSuccess.After(address.Timestamp) {
+			address.Timestamp = record.LastSuccess
+		}
+		if address.Timestamp.Before(cutoff) || record.Failures > 0 {
+			continue
+		}
+
+		addresses = append(addresses, address)
+		if len(addresses) == getaddrMaxCount {
+			break
+		}
+	}
+	return addresses
+}
+
+// sendAddresses answers a getaddr with the recently seen peers, in an addrv2
+// message when the peer asked for it.
+func (pinger *PingerConnection) sendAddresses(conn net.Conn, magic wire.BitcoinNet, addrV2 bool) {
+	addresses := pinger.Network.knownAddresses(addrV2)
+
+	var msg wire.Message
+	if addrV2 {
+		msgAddr := wire.NewMsgAddrV2()
+		for i := range addresses {
+			entry, err := wire.NewNetAddressV2(&addresses[i])
+			if err == nil {
+				msgAddr.AddAddress(entry)
+			}
+		}
+		msg = msgAddr
+	} else {
+		msgAddr := wire.NewMsgAddr()
+		for i := range addresses {
+			msgAddr.AddAddress(&addresses[i])
+		}
+		msg = msgAddr
+	}
+
+	var buf bytes.Buffer
+	wire.WriteMessageN(&buf, msg, pinger.ProtocolNumber, magic)
+	conn.Write(buf.Bytes())
+
+	pinger.Logger.Printf("%s : Sent %d addresses\n", pinger.IpAddress, len(addresses))
+}
@@ -0,0 +1,301 @@
+/**
+*    Copyright (C) 2019-present C2CV Holdings, LLC.
+*
+*    This program is free software: you can redistribute it and/or modify
+*    it under the terms of the Server Side Public License, version 1,
+*    as published by C2CV Holdings, LLC.
+*
+*    This program is distributed in the hope that it will be useful,
+*    but WITHOUT ANY WARRANTY; without even the implied warranty of
+*    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*    Server Side Public License for more details.
+*
+*    You should have received a copy of the Server Side Public License
+*    along with this program. If not, see
+*    <http://www.mongodb.com/licensing/server-side-public-license>.
+*
+*    As a special exception, the copyright holders give permission to link the
+*    code of portions of this program with the OpenSSL library under certain
+*    conditions as described in each individual source file and distribute
+*    linked combinations including the program with the OpenSSL library. You
+*    must comply with the Server Side Public License in all respects for
+*    all of the code used other than as permitted herein. If you modify file(s)
+*    with this exception, you may extend this exception to your version of the
+*    file(s), but you are not obligated to do so. If you do not wish to do so,
+*    delete this exception statement from your version. If you delete this
+*    exception statement from all source files in the program, then also delete
+*    it in the license file.
+ */
+
+package phantom
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// KeyProvider returns the private keys stored outside of the masternode
+// configuration, referenced as keystore:NAME.
+type KeyProvider interface {
+	PrivateKey(name string) (string, error)
+}
+
+// MasternodeConf is the structured masternode configuration (masternodeconf.json).
+type MasternodeConf struct {
+	Masternodes []MasternodeConfEntry `json:"masternodes"`
+}
+
+// MasternodeConfEntry describes a single masternode. The private key is either
+// given inline or through a key reference (env:NAME, file:/path/to/key or
+// keystore:NAME). A masternode broadcast is created when the collateral key,
+// inline or referenced as well, or the collateral public key along with a
+// broadcast signature made offline are given.
+type MasternodeConfEntry struct {
+	Alias           string   `json:"alias"`
+	Address         string   `json:"address,omitempty"`
+	PrivateKey      string   `json:"private_key,omitempty"`
+	KeyRef          string   `json:"key_ref,omitempty"`
+	CollateralTxid  string   `json:"collateral_txid"`
+	CollateralIndex uint32   `json:"collateral_index"`
+	Epoch           int64    `json:"epoch"`
+	Coin            string   `json:"coin,omitempty"`
+	Enabled         *bool    `json:"enabled,omitempty"`
+	Tags            []string `json:"tags,omitempty"`
+
+	CollateralKey    string `json:"collateral_key,omitempty"`
+	CollateralPubKey string `json:"collateral_pubkey,omitempty"`
+	BroadcastSig     string `json:"broadcast_sig,omitempty"`
+	BroadcastSigTime int64  `json:"broadcast_sig_time,omitempty"`
+}
+
+// LoadMasternodeConf loads the masternodes of a coin from either the
+// structured json format or the legacy masternode.txt format, based on the
+// file extension. Entries of the json format that are disabled or that
+// belong to another coin are skipped.
+// As with LoadMasternodeFile, the valid entries are returned along with a
+// *MasternodeConfError.
+func LoadMasternodeConf(filePath string, coin string, keys KeyProvider) ([]MasternodeEntry, error) {
+	if strings.ToLower(filepath.Ext(filePath)) != ".json" {
+		parsed, err := LoadMasternodeFile(filePath)
+
+		confError, ok := err.(*MasternodeConfError)
+		if err != nil && !ok {
+			return nil, err
+		}
+		if !ok {
+			confError = &MasternodeConfError{Path: filePath}
+		}
+
+		//the private key column may reference the keystore as well
+		entries := make([]MasternodeEntry, 0, len(parsed))
+		for _, entry := range parsed {
+			if strings.HasPrefix(entry.PrivateKey, "keystore:") {
+				entry.PrivateKey, err = resolveKeyRef(entry.PrivateKey, keys)
+				if err != nil {
+					confError.Problems = append(confError.Problems,
+						fmt.Sprintf("%s (%s): %v", entry.Location, entry.Name, err))
+					continue
+				}
+			}
+			entries = append(entries, entry)
+		}
+
+		if len(confError.Problems) > 0 {
+			return entries, confError
+		}
+
+		return entries, nil
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var conf MasternodeConf
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&conf); err != nil {
+		return nil, fmt.Errorf("%s: %v", filePath, err)
+	}
+
+	entries := make([]MasternodeEntry, 0, len(conf.Masternodes))
+	confError := &MasternodeConfError{Path: filePath}
+	aliases := make(map[string]string)
+
+	for i, node := range conf.Masternodes {
+		number := i + 1
+
+		if node.Enabled != nil && !*node.Enabled {
+			continue
+		}
+
+		if node.Coin != "" && !strings.EqualFold(node.Coin, coin) {
+			continue
+		}
+
+		location := fmt.Sprintf("masternode %d", number)
+		if node.Alias == "" {
+			confError.Problems = append(confError.Problems, location+": missing alias")
+			continue
+		}
+
+		problems := len(confError.Problems)
+
+		privateKey, err := resolvePrivateKey(node, keys)
+		if err != nil {
+			confError.Problems = append(confError.Problems,
+				fmt.Sprintf("%s (%s): %v", location, node.Alias, err))
+		}
+
+		collateralKey, err := resolveCollateralKey(node, keys)
+		if err != nil {
+			confError.Problems = append(confError.Problems,
+				fmt.Sprintf("%s (%s): %v", location, node.Alias, err))
+		}
+
+		if node.CollateralTxid == "" {
+			confError.Problems = append(confError.Problems,
+				fmt.Sprintf("%s (%s): missing collateral_txid", location, node.Alias))
+		}
+
+		if node.Epoch <= 0 {
+			confError.Problems = append(confError.Problems,
+				fmt.Sprintf("%s (%s): missing epoch", location, node.Alias))
+		}
+
+		if previous, ok := aliases[node.Alias]; ok {
+			confError.Problems = append(confError.Problems,
+				fmt.Sprintf("%s: alias %s already used by %s", location, node.Alias, previous))
+		} else {
+			aliases[node.Alias] = location
+		}
+
+		if len(confError.Problems) > problems {
+			continue
+		}
+
+		entries = append(entries, MasternodeEntry{
+			Name:          node.Alias,
+			Address:       node.Address,
+			PrivateKey:    privateKey,
+			OutpointHash:  node.CollateralTxid,
+			OutpointIndex: node.CollateralIndex,
+			Epoch:         node.Epoch,
+			Tags:          node.Tags,
+			Location:      location,
+
+			CollateralKey:    collateralKey,
+			CollateralPubKey: node.CollateralPubKey,
+			BroadcastSig:     node.BroadcastSig,
+			BroadcastSigTime: node.BroadcastSigTime,
+		})
+	}
+
+	if len(confError.Problems) > 0 {
+		return entries, confError
+	}
+
+	return entries, nil
+}
+
+// resolvePrivateKey returns the inline private key or loads the referenced one.
+func resolvePrivateKey(node MasternodeConfEntry, keys KeyProvider) (string, error) {
+	if node.PrivateKey != "" && node.KeyRef != "" {
+		return "", errors.New("private_key and key_ref are mutually exclusive")
+	}
+
+	if node.KeyRef == "" {
+		if node.PrivateKey == "" {
+			return "", errors.New("missing private_key or key_ref")
+		}
+		return node.PrivateKey, nil
+	}
+
+	return resolveKeyRef(node.KeyRef, keys)
+}
+
+// resolveCollateralKey returns the inline collateral key or loads the
+// referenced one, a wif never contains a colon.
+func resolveCollateralKey(node MasternodeConfEntry, keys KeyProvider) (string, error) {
+	if node.CollateralKey != "" && node.BroadcastSig != "" {
+		return "", errors.New("collateral_key and broadcast_sig are mutually exclusive")
+	}
+
+	if !strings.Contains(node.CollateralKey, ":") {
+		return node.CollateralKey, nil
+	}
+
+	key, err := resolveKeyRef(node.CollateralKey, keys)
+	if err != nil {
+		return "", fmt.Errorf("collateral_key: %v", err)
+	}
+	return key, nil
+}
+
+// resolveKeyRef loads the private key referenced by env:NAME,
+// file:/path/to/key or keystore:NAME.
+func resolveKeyRef(keyRef string, keys KeyProvider) (string, error) {
+	parts := strings.SplitN(keyRef, ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return "", fmt.Errorf("invalid key reference %q", keyRef)
+	}
+
+	switch parts[0] {
+	case "env":
+		value := strings.TrimSpace(os.Getenv(parts[1]))
+		if value == "" {
+			return "", fmt.Errorf("environment variable %s is empty", parts[1])
+		}
+		return value, nil
+	case "file":
+		value, err := ioutil.ReadFile(parts[1])
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(value)), nil
+	case "keystore":
+		if keys == nil {
+			return "", errors.New("no keystore configured, use -keystore")
+		}
+		return keys.PrivateKey(parts[1])
+	default:
+		return "", fmt.Errorf("unsupported key reference type %q", parts[0])
+	}
+}
+
+// WriteMasternodeConf stores the entries in the structured json format.
+func WriteMasternodeConf(filePath string, entries []MasternodeEntry, coin string) error {
+	conf := MasternodeConf{Masternodes: make([]MasternodeConfEntry, 0, len(entries))}
+
+	for _, entry := range entries {
+		conf.Masternodes = append(conf.Masternodes, MasternodeConfEntry{
+			Alias:           entry.Name,
+			Address:         entry.Address,
+			PrivateKey:      entry.PrivateKey,
+			CollateralTxid:  entry.OutpointHash,
+			CollateralIndex: entry.OutpointIndex,
+			Epoch:           entry.Epoch,
+			Coin:            coin,
+			Tags:            entry.Tags,
+
+			CollateralKey:    entry.CollateralKey,
+			CollateralPubKey: entry.CollateralPubKey,
+			BroadcastSig:     entry.BroadcastSig,
+			BroadcastSigTime: entry.BroadcastSigTime,
+		})
+	}
+
+	bytes, err := json.MarshalIndent(conf, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filePath, append(bytes, '\n'), 0600)
+}
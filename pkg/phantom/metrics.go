@@ -0,0 +1,122 @@
+/**
+*    Copyright (C) 2019-present C2CV Holdings, LLC.
+*
+*    This program is free software: you can redistribute it and/or modify
+*    it under the terms of the Server Side Public License, version 1,
+*    as published by C2CV Holdings, LLC.
+*
+*    This program is distributed in the hope that it will be useful,
+*    but WITHOUT ANY WARRANTY; without even the implied warranty of
+*    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*    Server Side Public License for more details.
+*
+*    You should have received a copy of the Server Side Public License
+*    along with this program. If not, see
+*    <http://www.mongodb.com/licensing/server-side-public-license>.
+*
+*    As a special exception, the copyright holders give permission to link the
+*    code of portions of this program with the OpenSSL library under certain
+*    conditions as described in each individual source file and distribute
+*    linked combinations including the program with the OpenSSL library. You
+*    must comply with the Server Side Public License in all respects for
+*    all of the code used other than as permitted herein. If you modify file(s)
+*    with this exception, you may extend this exception to your version of the
+*    file(s), but you are not obligated to do so. If you do not wish to do so,
+*    delete this exception statement from your version. If you delete this
+*    exception statement from all source files in the program, then also delete
+*    it in the license file.
+ */
+
+package phantom
+
+import (
+	"time"
+
+	"../metrics"
+)
+
+var (
+	connectedPeers = metrics.NewGaugeVec("phantom_connected_peers",
+		"Number of pinger connections that completed the handshake (status 1).", "network")
+	inboundPeers = metrics.NewGaugeVec("phantom_inbound_peers",
+		"Number of inbound connections that completed the handshake.", "network")
+	inboundRejected = metrics.NewCounterVec("phantom_inbound_rejected_total",
+		"Number of inbound connections refused, banned peers or no slot left.", "network")
+	knownPeers = metrics.NewGaugeVec("phantom_known_peers",
+		"Number of known peers waiting for a connection.", "network")
+	addressesDropped = metrics.NewCounterVec("phantom_addresses_dropped_total",
+		"Number of advertised addresses dropped by the per peer rate limit.", "network")
+	reconnectAttempts = metrics.NewCounterVec("phantom_reconnect_attempts_total",
+		"Number of failed connection attempts and reconnects.", "network")
+	pingsGenerated = metrics.NewCounterVec("phantom_pings_generated_total",
+		"Number of pings handed to the connections by the ping generator.", "network", "alias")
+	pingsRelayed = metrics.NewCounterVec("phantom_pings_relayed_total",
+		"Number of pings announced to peers.", "network", "alias")
+	pingsSeen = metrics.NewCounterVec("phantom_pings_seen_total",
+		"Number of peers announcing a relayed ping back, a sign it spreads over the network.", "network", "alias")
+	getdataServed = metrics.NewCounterVec("phantom_getdata_served_total",
+		"Number of getdata requests answered with a cached ping or broadcast.", "network")
+	getdataNotFound = metrics.NewCounterVec("phantom_getdata_notfound_total",
+		"Number of requested pings and broadcasts answered with notfound, expired or never announced.", "network")
+	relayMessages = metrics.NewGaugeVec("phantom_relay_messages",
+		"Number of pings and broadcasts in the relay store shared by all the networks.")
+	invBlocksSeen = metrics.NewCounterVec("phantom_inv_blocks_total",
+		"Number of block inventory announcements received.", "network")
+	secondsSinceLastBlock = metrics.NewGaugeVec("phantom_seconds_since_last_block",
+		"Seconds since the last new block was announced.", "network")
+	peersBanned = metrics.NewCounterVec("phantom_peers_banned_total",
+		"Number of peers banned for misbehaving or being on another network.", "network")
+	chainHeight = metrics.NewGaugeVec("phantom_chain_height",
+		"Height of the best tip of the header chain, -1 while unknown.", "network")
+	broadcastsCached = metrics.NewGaugeVec("phantom_broadcasts_cached",
+		"Number of masternode broadcasts in the broadcast cache.", "network")
+)
+
+// registerMetrics exposes the gauges computed from the network state.
+func (n *Network) registerMetrics() {
+	name := n.Config.Name
+
+	connectedPeers.SetFunc(func() float64 {
+		n.mutex.Lock()
+		defer n.mutex.Unlock()
+
+		connected := 0
+		for _, pinger := range n.connectionSet {
+			if pinger.GetStatus() == 1 {
+				connected++
+			}
+		}
+		return float64(connected)
+	}, name)
+
+	inboundPeers.SetFunc(func() float64 {
+		return float64(len(n.inboundPingers()))
+	}, name)
+
+	chainHeight.SetFunc(func() float64 {
+		_, height := n.chainTip()
+		return float64(height)
+	}, name)
+
+	knownPeers.SetFunc(func() float64 {
+		n.mutex.Lock()
+		defer n.mutex.Unlock()
+
+		return float64(len(n.peerSet))
+	}, name)
+
+	secondsSinceLastBlock.SetFunc(func() float64 {
+		return time.Since(n.LastBlockTime()).Seconds()
+	}, name)
+
+	broadcastsCached.SetFunc(func() float64 {
+		n.mutex.Lock()
+		defer n.mutex.Unlock()
+
+		return float64(len(n.broadcastSet))
+	}, name)
+
+	relayMessages.SetFunc(func() float64 {
+		return float64(n.relay.Len())
+	})
+}
@@ -0,0 +1,834 @@
+/**
+*    Copyright (C) 2019-present C2CV Holdings, LLC.
+*
+*    This program is free software: you can redistribute it and/or modify
+*    it under the terms of the Server Side Public License, version 1,
+*    as published by C2CV Holdings, LLC.
+*
+*    This program is distributed in the hope that it will be useful,
+*    but WITHOUT ANY WARRANTY; without even the implied warranty of
+*    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*    Server Side Public License for more details.
+*
+*    You should have received a copy of the Server Side Public License
+*    along with this program. If not, see
+*    <http://www.mongodb.com/licensing/server-side-public-license>.
+*
+*    As a special exception, the copyright holders give permission to link the
+*    code of portions of this program with the OpenSSL library under certain
+*    conditions as described in each individual source file and distribute
+*    linked combinations including the program with the OpenSSL library. You
+*    must comply with the Server Side Public License in all respects for
+*    all of the code used other than as permitted herein. If you modify file(s)
+*    with this exception, you may extend this exception to your version of the
+*    file(s), but you are not obligated to do so. If you do not wish to do so,
+*    delete this exception statement from your version. If you delete this
+*    exception statement from all source files in the program, then also delete
+*    it in the license file.
+ */
+
+package phantom
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"../powhash"
+	"../proxy"
+	"../socket/wire"
+	"../storage"
+
+	"github.com/TrueNodes/bbolt"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// ErrMinConnections and ErrNoBlocks are the health failures that stop a
+// network, see Network.Err.
+var (
+	ErrMinConnections = errors.New("minimum number of connections not satisfied")
+	ErrNoBlocks       = errors.New("no blocks received from the network")
+)
+
+//time given to the connections to serve the pending pings on shut down
+const drainTimeout = 10 * time.Second
+
+//time given to a peer to accept the connection, proxy negotiation included
+const dialTimeout = 30 * time.Second
+
+//a connection is dropped when the peer sends nothing for peerReadTimeout, or
+//does not complete the handshake within handshakeTimeout
+const (
+	peerReadTimeout  = 10 * time.Minute
+	handshakeTimeout = time.Minute
+)
+
+//pings are only signed when a block was seen within hashMaxAge, the saved
+//hashes are only restored when as recent
+const hashMaxAge = 2 * time.Hour
+
+// NetworkConfig holds the settings required to run the phantom daemon against
+// a single coin network.
+type NetworkConfig struct {
+	Name              string
+	CoinConf          string
+	MasternodeConf    string
+	MagicBytes        uint32
+	Port              uint16
+	ProtocolNumber    uint32
+	MinProtocol       uint32
+	MagicMessage      string
+	BootstrapIPs      string
+	BootstrapHash     chainhash.Hash
+	BootstrapExplorer string
+	BootstrapType     string
+	BootstrapQuorum   uint
+	SentinelVersion   uint32
+	DaemonVersion     uint32
+	UserAgent         string
+	BroadcastListen   bool
+	MinConnections    uint
+	MaxConnections    uint
+	NoBlockMinutes    uint
+	WIFPrefix         string
+	PowAlgorithm      string
+	PingFormat        string
+	Proxy             string
+	Listen            string
+	MaxInbound        uint
+	Keys              KeyProvider
+}
+
+// Network is a self contained phantom instance for a single coin. Every
+// network owns its peers, connections, hash queue and broadcast cache so
+// several coins can be served from the same process.
+type Network struct {
+	Config NetworkConfig
+	Logger *log.Logger
+
+	db            *bbolt.DB
+	addressBook   *storage.AddressBook
+	connectionSet map[string]*PingerConnection
+	inboundSet    map[string]*PingerConnection
+	peerSet       map[string]wire.NetAddress
+	broadcastSet  map[string]wire.MsgMNB
+	masternodeSet map[string]*MasternodeStatus
+	pingInvs      map[chainhash.Hash]string
+	schedules     map[string]*pingSchedule
+	bans          map[string]PeerBan
+	disconnects   map[string][]time.Time
+	hashQueue     *Queue
+	headers       *HeaderChain
+	relay         *RelayStore
+	pingFormat    wire.PingFormat
+	dialer        proxy.Dialer
+	httpClient    *http.Client
+
+	addrChannel      chan wire.NetAddress
+	hashChannel      chan chainhash.Hash
+	broadcastChannel chan wire.MsgMNB
+	pingChannel      chan MasternodePing
+
+	waitGroup         *sync.WaitGroup
+	ctx               context.Context
+	cancelConnections context.CancelFunc
+	done              chan struct{}
+	err               error
+	startTime         time.Time
+	mutex             sync.Mutex
+
+	lastBlockTime       time.Time
+	currentBlockHash    string
+	currentMnBroadcast  string
+	currentMnRelaying   string
+	lastConnectionError error
+}
+
+func NewNetwork(config NetworkConfig, db *bbolt.DB) *Network {
+	network := &Network{
+		Config:        config,
+		Logger:        log.New(log.Writer(), "["+config.Name+"] ", log.Flags()),
+		db:            db,
+		connectionSet: make(map[string]*PingerConnection),
+		inboundSet:    make(map[string]*PingerConnection),
+		peerSet:       make(map[string]wire.NetAddress),
+		broadcastSet:  make(map[string]wire.MsgMNB),
+		masternodeSet: make(map[string]*MasternodeStatus),
+		pingInvs:      make(map[chainhash.Hash]string),
+		schedules:     make(map[string]*pingSchedule),
+		bans:          make(map[string]PeerBan),
+		disconnects:   make(map[string][]time.Time),
+		hashQueue:     NewQueue(12),
+		relay:         sharedRelayStore,
+		addrChannel:   make(chan wire.NetAddress, 1500),
+		hashChannel:   make(chan chainhash.Hash, 1500),
+		pingChannel:   make(chan MasternodePing, 1500),
+		lastBlockTime: time.Now().Add(time.Minute * 5),
+		done:          make(chan struct{}),
+	}
+
+	//headers of an unknown algorithm can be neither identified nor checked,
+	//the pings then sign the announced blocks only
+	algorithm, err := powhash.Lookup(config.PowAlgorithm)
+	if err != nil {
+		network.Logger.Println("Warning: unsupported pow_algorithm", config.PowAlgorithm+", the header chain is disabled and the block hash signed by the pings is unverified")
+	} else if config.PowAlgorithm != "" {
+		network.headers = NewHeaderChain(algorithm)
+	} else {
+		network.Logger.Println("Warning: no pow_algorithm, the header chain is disabled and the block hash signed by the pings is unverified")
+	}
+
+	network.pingFormat, err = wire.ParsePingFormat(config.PingFormat)
+	if err != nil {
+		network.Logger.Println("Unsupported ping_format", config.PingFormat+", using", network.pingFormat)
+	}
+
+	//with a proxy every peer and explorer is reached through it, never directly
+	network.dialer, err = proxy.New(config.Proxy, dialTimeout)
+	if err == nil {
+		network.httpClient, err = proxy.HTTPClient(config.Proxy, bootstrapTimeout)
+	}
+	if err != nil {
+		network.Logger.Println("Unusable proxy, the peers and explorers cannot be reached.", err)
+		network.dialer = &proxy.SOCKS5{Address: config.Proxy, Timeout: dialTimeout}
+		network.httpClient = &http.Client{Transport: &http.Transport{DialContext: network.dialer.DialContext}}
+	}
+
+	if config.BroadcastListen {
+		network.broadcastChannel = make(chan wire.MsgMNB, 1500)
+	}
+
+	return network
+}
+
+// Bootstrap seeds the peer set and the hash queue, either from the explorers
+// or from the bootstrap ips and hash provided in the configuration. Recent
+// hashes saved by a previous run take precedence over both. When neither is
+// available the hashes are learned from the blocks announced by the peers.
+func (n *Network) Bootstrap() error {
+	restored := 0
+	if n.db != nil {
+		var err error
+		if restored, err = n.loadHashes(); err != nil {
+			n.Logger.Println("Unable to restore the hashes:", err)
+		}
+	}
+
+	if restored > 0 {
+		n.Logger.Printf("Block hashes restored: %d\n", restored)
+	}
+
+	if n.Config.BootstrapIPs != "" {
+		addresses := SplitAddressList(n.Config.BootstrapIPs)
+
+		if uint(len(addresses)) > n.Config.MaxConnections {
+			addresses = addresses[:n.Config.MaxConnections-1]
+		}
+
+		for _, address := range addresses {
+			if n.reachable(address) {
+				n.peerSet[address.Hostname()] = address
+			}
+		}
+	}
+
+	bootstrapHeight := 0
+	if n.Config.BootstrapExplorer != "" {
+		explorers, err := NewBootstrapQuorum(n.Config.BootstrapExplorer, n.Config.BootstrapType, n.Config.BootstrapQuorum, n.httpClient)
+		if err != nil {
+			return fmt.Errorf("Unable to bootstrap using the explorer url provided. %s", err)
+		}
+
+		bootstrapHash, height, err := explorers.LoadBlockHash(n.Logger)
+		if err != nil {
+			if restored == 0 {
+				n.Logger.Println("Unable to bootstrap using the explorer url provided, waiting for the peers to announce blocks.", err)
+			} else {
+				n.Logger.Println("Unable to bootstrap using the explorer url provided, using the restored hashes.", err)
+			}
+		} else {
+			n.Config.BootstrapHash = bootstrapHash
+			bootstrapHeight = height
+		}
+
+		peers := explorers.LoadPossiblePeers(n.Config.Port)
+
+		for _, peer := range peers {
+			if len(n.peerSet) < int(n.Config.MaxConnections) {
+				if n.reachable(peer) {
+					n.peerSet[peer.Hostname()] = peer
+				}
+			} else {
+				break //exit early
+			}
+		}
+	} else if restored == 0 && n.Config.BootstrapHash != (chainhash.Hash{}) {
+		bootstrapHash := n.Config.BootstrapHash
+		n.hashQueue.Push(&bootstrapHash)
+	}
+
+	//request the blocks missed since the restored hashes
+	if restored > 0 && n.Config.BootstrapHash == (chainhash.Hash{}) {
+		entries := n.hashQueue.Entries()
+		n.Config.BootstrapHash = entries[len(entries)-1].Hash
+	}
+
+	//the header chain starts at the oldest known hash, top - 12 at best
+	if n.headers == nil {
+		return nil
+	}
+	if entries := n.hashQueue.Entries(); len(entries) > 0 {
+		n.headers.Anchor(entries[0].Hash)
+	} else if n.Config.BootstrapHash != (chainhash.Hash{}) {
+		n.headers.Anchor(n.Config.BootstrapHash)
+		n.headers.NoteHeight("explorers", n.Config.BootstrapHash, int32(bootstrapHeight))
+	}
+
+	return nil
+}
+
+func (n *Network) PrintSettings() {
+	fmt.Println("--USING THE FOLLOWING SETTINGS FOR", n.Config.Name, "--")
+	fmt.Println("Coin configuration: ", n.Config.CoinConf)
+	fmt.Println("Masternode configuration: ", n.Config.MasternodeConf)
+	fmt.Println("Magic Bytes: ", strconv.FormatUint(uint64(n.Config.MagicBytes), 16))
+	fmt.Println("Magic Message: ", n.Config.MagicMessage)
+	fmt.Println("Protocol Number: ", n.Config.ProtocolNumber)
+	fmt.Println("Minimum Peer Protocol: ", n.Config.MinProtocol)
+	fmt.Println("Bootstrap IPs: ", n.Config.BootstrapIPs)
+	fmt.Println("Default Port: ", n.Config.Port)
+	fmt.Println("Hash: ", n.Config.BootstrapHash)
+	if n.Config.BootstrapExplorer != "" {
+		var explorers []string
+		for _, explorer := range strings.Split(n.Config.BootstrapExplorer, ",") {
+			explorers = append(explorers, displayURL(strings.TrimSpace(explorer)))
+		}
+		fmt.Println("Explorers: ", strings.Join(explorers, ","), n.Config.BootstrapType)
+		if n.Config.BootstrapQuorum == 0 {
+			fmt.Println("Explorer quorum:  majority")
+		} else {
+			fmt.Println("Explorer quorum: ", n.Config.BootstrapQuorum)
+		}
+	}
+	fmt.Println("Ping Format: ", n.pingFormat)
+	fmt.Println("Sentinel Version: ", n.Config.SentinelVersion)
+	fmt.Println("Daemon Version: ", n.Config.DaemonVersion)
+	fmt.Println("Listen for broadcasts: ", n.Config.BroadcastListen)
+	if n.Config.Proxy != "" {
+		fmt.Println("Proxy: ", proxy.Redact(n.Config.Proxy))
+	}
+	fmt.Println()
+	fmt.Println("Minimum connections: ", n.Config.MinConnections)
+	fmt.Println("Maximum connections: ", n.Config.MaxConnections)
+	if n.Config.Listen != "" {
+		fmt.Println("Listen: ", n.Config.Listen)
+		fmt.Println("Maximum inbound connections: ", n.Config.MaxInbound)
+	}
+	fmt.Println("Maximum time without blocks: ", n.Config.NoBlockMinutes, " minutes")
+	fmt.Println()
+}
+
+// Start connects to the bootstrap peers and spawns the processing goroutines
+// of the network. The network stops when the context is cancelled or a health
+// check fails: the pending pings are relayed, the state is saved and the wait
+// group is released once every connection is closed.
+func (n *Network) Start(ctx context.Context, waitGroup *sync.WaitGroup) error {
+	n.waitGroup = waitGroup
+	n.ctx = ctx
+	n.startTime = time.Now()
+
+	entries, err := n.LoadMasternodes()
+	if err != nil {
+		return err
+	}
+
+	//the bootstrap peers are connected before the address book is loaded
+	bootstrapPeers := make([]wire.NetAddress, 0, len(n.peerSet))
+	for _, peer := range n.peerSet {
+		bootstrapPeers = append(bootstrapPeers, peer)
+	}
+
+	if err := n.loadAddressBook(); err != nil {
+		return err
+	}
+
+	if err := n.loadBroadcasts(); err != nil {
+		n.Logger.Println("Unable to restore the broadcasts:", err)
+	}
+
+	n.registerMetrics()
+
+	//the connections outlive the context until the pending pings are relayed
+	var connectionCtx context.Context
+	connectionCtx, n.cancelConnections = context.WithCancel(context.Background())
+
+	if n.Config.Listen != "" {
+		if err := n.listen(ctx, connectionCtx); err != nil {
+			n.cancelConnections()
+			return err
+		}
+	}
+
+	for _, peer := range bootstrapPeers {
+		pinger := n.newPinger(peer)
+
+		//only the bootstrap peers request the missing blocks
+		pinger.BootstrapHash = n.Config.BootstrapHash
+
+		//make a client
+		n.connectionSet[pinger.IpAddress] = pinger
+		delete(n.peerSet, pinger.IpAddress)
+
+		n.waitGroup.Add(1)
+		go pinger.Start(connectionCtx, n.Config.UserAgent)
+	}
+
+	history := n.peerHistory()
+	for len(n.connectionSet) < int(n.Config.MaxConnections) {
+		peer, err := n.getNextPeer(n.connectionSet, history)
+		if err != nil {
+			break
+		}
+
+		pinger := n.newPinger(peer)
+		n.connectionSet[pinger.IpAddress] = pinger
+
+		n.waitGroup.Add(1)
+		go pinger.Start(connectionCtx, n.Config.UserAgent)
+	}
+
+	n.waitGroup.Add(1)
+
+	if n.broadcastChannel != nil {
+		go n.processNewBroadcasts(connectionCtx)
+	}
+
+	go n.processNewAddresses(connectionCtx)
+	go n.processNewHashes(connectionCtx)
+	go n.sendPings(connectionCtx)
+	go n.maintainAddressBook(ctx)
+
+	n.applyMasternodes(entries)
+	go n.watchMasternodeFile(ctx)
+
+	return nil
+}
+
+// Done is closed once the network has stopped.
+func (n *Network) Done() <-chan struct{} {
+	return n.done
+}
+
+// Err returns why the network stopped, ErrMinConnections or ErrNoBlocks when
+// a health check failed and nil when the context was cancelled.
+func (n *Network) Err() error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	return n.err
+}
+
+// LastBlockTime returns the time the last new block was announced to us.
+func (n *Network) LastBlockTime() time.Time {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	return n.lastBlockTime
+}
+
+func (n *Network) newPinger(peer wire.NetAddress) *PingerConnection {
+	return &PingerConnection{
+		MagicBytes:       n.Config.MagicBytes,
+		IpAddress:        peer.Hostname(),
+		Port:             peer.Port,
+		ProtocolNumber:   n.Config.ProtocolNumber,
+		SentinelVersion:  n.Config.SentinelVersion,
+		DaemonVersion:    n.Config.DaemonVersion,
+		PingChannel:      make(chan SignedPing, 1500),
+		AddrChannel:      n.addrChannel,
+		HashChannel:      n.hashChannel,
+		BroadcastChannel: n.broadcastChannel,
+		Status:           0,
+		WaitGroup:        n.waitGroup,
+		Network:          n,
+		Logger:           n.Logger,
+	}
+}
+
+// noteBlock records a block announcement and reports whether the block is
+// new to this network.
+func (n *Network) noteBlock(hash chainhash.Hash) bool {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if hash.String() == n.currentBlockHash {
+		return false
+	}
+
+	n.currentBlockHash = hash.String()
+	n.lastBlockTime = time.Now()
+	return true
+}
+
+// noteBroadcast reports whether the broadcast differs from the last one seen.
+func (n *Network) noteBroadcast(outpoint string) bool {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if outpoint == n.currentMnBroadcast {
+		return false
+	}
+
+	n.currentMnBroadcast = outpoint
+	return true
+}
+
+// noteRelay reports whether the masternode differs from the last one relayed.
+func (n *Network) noteRelay(name string) bool {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if name == n.currentMnRelaying {
+		return false
+	}
+
+	n.currentMnRelaying = name
+	return true
+}
+
+// noteConnectionError reports whether err differs from the last connection
+// error so repeated failures are only logged once.
+func (n *Network) noteConnectionError(err error) bool {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if err == n.lastConnectionError {
+		return false
+	}
+
+	n.lastConnectionError = err
+	return true
+}
+
+// broadcastTemplate returns the cached broadcast of the outpoint, broadcasts
+// older than 24 hours are dropped from the cache.
+func (n *Network) broadcastTemplate(outpoint string) *wire.MsgMNB {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	broadcast, ok := n.broadcastSet[outpoint]
+	if !ok {
+		return nil
+	}
+
+	sigTime := time.Unix(int64(broadcast.SigTime), 0)
+	if sigTime.Add(time.Hour * 24).Before(time.Now().UTC()) {
+		delete(n.broadcastSet, outpoint)
+	}
+
+	return &broadcast
+}
+
+func (n *Network) processNewHashes(ctx context.Context) {
+	for {
+		var hash chainhash.Hash
+		select {
+		case <-ctx.Done():
+			return
+		case hash = <-n.hashChannel:
+		}
+
+		if !n.hashQueue.PushSeen(&hash, time.Now().UTC()) {
+			continue
+		}
+
+		//without a bootstrap hash the header chain starts at the first block announced
+		if n.headers != nil {
+			n.headers.Anchor(hash)
+		}
+
+		for n.hashQueue.Len() > 12 { //clear the queue until we're at 12 entries
+			n.hashQueue.Pop()
+		}
+
+		//keep the hashes so a restart does not need to bootstrap again
+		if err := n.saveHashes(); err != nil {
+			n.Logger.Println("Unable to save the hashes:", err)
+		}
+	}
+}
+
+func (n *Network) processNewBroadcasts(ctx context.Context) {
+	for {
+		var mnb wire.MsgMNB
+		select {
+		case <-ctx.Done():
+			return
+		case mnb = <-n.broadcastChannel:
+		}
+
+		n.mutex.Lock()
+		n.broadcastSet[mnb.Vin.PreviousOutPoint.Hash.String()+
+			":"+strconv.Itoa(int(mnb.Vin.PreviousOutPoint.Index))] = mnb
+		n.mutex.Unlock()
+	}
+}
+
+// reachable reports whether the peer can be dialed, the .onion peers are only
+// reachable through the proxy.
+func (n *Network) reachable(addr wire.NetAddress) bool {
+	if addr.Host != "" {
+		return proxy.IsOnion(addr.Host) && n.Config.Proxy != "" && n.Config.Proxy != proxy.None
+	}
+
+	return addr.IP != nil && !addr.IP.IsUnspecified()
+}
+
+func (n *Network) processNewAddresses(ctx context.Context) {
+	for {
+		var addr wire.NetAddress
+		select {
+		case <-ctx.Done():
+			return
+		case addr = <-n.addrChannel:
+		}
+
+		if !n.reachable(addr) {
+			continue
+		}
+
+		n.mutex.Lock()
+		_, known := n.peerSet[addr.Hostname()]
+		if !n.isBanned(addr.Hostname()) && (known || len(n.peerSet) < addressBookMaxPeers) {
+			n.peerSet[addr.Hostname()] = addr
+		}
+		n.mutex.Unlock()
+
+		n.notePeerSeen(addr)
+	}
+}
+
+func (n *Network) sendPings(connectionCtx context.Context) {
+	defer n.waitGroup.Done()
+
+	//hack to work around .Wait() race condition on fast start-ups
+	select {
+	case <-n.ctx.Done():
+		n.stop(nil)
+		return
+	case <-time.After(10 * time.Second):
+	}
+
+	for {
+		var ping MasternodePing
+		select {
+		case <-n.ctx.Done():
+			n.stop(nil)
+			return
+		case ping = <-n.pingChannel:
+		}
+
+		n.relayPing(ping)
+
+		//spawn off extra nodes here if we don't have enough
+		n.mutex.Lock()
+		newConnectionSet := n.connectionSet
+		n.mutex.Unlock()
+
+		numberConnections := len(newConnectionSet)
+		var history map[string]storage.PeerRecord
+		if numberConnections < int(n.Config.MaxConnections) {
+			history = n.peerHistory()
+		}
+
+		for i := 0; i < int(n.Config.MaxConnections)-numberConnections; i++ {
+			//spawn off a new connection
+			peer, err := n.getNextPeer(newConnectionSet, history)
+			if err != nil {
+				continue
+			}
+
+			// intentionally don't provide a bootstraphash to prevent
+			// duplicate data downloads for unneeded blocks
+			newPinger := n.newPinger(peer)
+
+			//make a client
+			n.mutex.Lock()
+			newConnectionSet[newPinger.IpAddress] = newPinger
+			n.mutex.Unlock()
+
+			n.waitGroup.Add(1)
+			go newPinger.Start(connectionCtx, n.Config.UserAgent)
+
+			n.Logger.Println("Opened a new connection to ", newPinger.IpAddress, " (", len(newConnectionSet), "/", n.Config.MaxConnections, ")")
+		}
+
+		if numberConnections > 0 && numberConnections < int(n.Config.MinConnections) && time.Since(n.startTime).Seconds() > 300 {
+			n.Logger.Println("Minimum number of connections (", n.Config.MinConnections, ") not satisfied. Application has been running for ", time.Since(n.startTime))
+			n.Logger.Println("Closing Application now")
+
+			n.stop(ErrMinConnections)
+			return
+		}
+
+		if n.Config.NoBlockMinutes > 0 && time.Since(n.LastBlockTime()).Minutes() > float64(n.Config.NoBlockMinutes) {
+			n.Logger.Println("More than ", n.Config.NoBlockMinutes, " minutes without receiving blocks from network. Application has been running for ", time.Since(n.startTime))
+			n.Logger.Println("Closing Application now")
+
+			n.stop(ErrNoBlocks)
+			return
+		}
+	}
+}
+
+// relayPing hands the ping to every connected pinger and reaps the pingers
+// that had an error.
+func (n *Network) relayPing(ping MasternodePing) {
+	//the masternode has been removed while the ping was queued
+	if !n.isScheduled(ping) {
+		return
+	}
+
+	blockHash, err := n.pingBlockHash()
+	if err != nil {
+		n.Logger.Println(ping.Name, ": Not signing the ping,", err)
+		return
+	}
+	ping.BlockHash = blockHash
+
+	mnp, err := n.verifyPing(&ping)
+	if err != nil {
+		n.Logger.Printf("%s : Not relaying the ping, %v. Check the private key and the magic message %q.\n", ping.Name, err, ping.MagicMessage)
+		return
+	}
+
+	//the ping verified is the one every connection relays
+	signed := SignedPing{Name: ping.Name, Ping: mnp}
+	if ping.BroadcastTemplate != nil {
+		mnb := *ping.BroadcastTemplate
+		mnb.LastPing = mnp
+		signed.Broadcast = &mnb
+	}
+
+	pingsGenerated.Inc(n.Config.Name, ping.Name)
+
+	n.Logger.Println(ping.Name, ping.PingTime.UTC().Format("15:04:05"), "awake")
+
+	n.mutex.Lock()
+	connectionSet := n.connectionSet
+	n.mutex.Unlock()
+
+	//send the ping
+	var newConnectionSet = make(map[string]*PingerConnection)
+
+	for _, pinger := range connectionSet {
+		status := pinger.GetStatus()
+
+		if status < 0 || len(pinger.PingChannel) > 10 { //the pinger has had an error, close the channel
+			n.Logger.Println("There's been an error, closing connection to ", pinger.IpAddress)
+			pinger.SetStatus(-1)
+
+			n.Logger.Printf("%s : Closing down the ping channel.\n", pinger.IpAddress)
+			close(pinger.PingChannel) // don't add the closed pinger to the connectionArray
+
+			//remove the peer from the peerSet
+			n.mutex.Lock()
+			delete(n.peerSet, pinger.IpAddress)
+			n.mutex.Unlock()
+		} else {
+			if status > 0 {
+				n.Logger.Printf("%s : Pinging.", pinger.IpAddress)
+				pinger.PingChannel <- signed //only ping on connected pingers (1)
+			}
+			// this filters out bad connections, re-add unconnected peers just to be safe
+			newConnectionSet[pinger.IpAddress] = pinger
+		}
+	}
+
+	//replace the pointer
+	n.mutex.Lock()
+	n.connectionSet = newConnectionSet
+	n.mutex.Unlock()
+
+	//the inbound peers are removed by the listener once closed
+	for _, pinger := range n.inboundPingers() {
+		if len(pinger.PingChannel) <= 10 {
+			pinger.PingChannel <- signed
+		}
+	}
+}
+
+// pingBlockHash returns the hash the pings sign: the block pingDepth below
+// the best tip of the header chain, or the oldest of the last announced
+// blocks without a header chain or until it is deep enough.
+func (n *Network) pingBlockHash() (chainhash.Hash, error) {
+	if n.headers != nil {
+		if hash, ok := n.headers.PingHash(hashMaxAge); ok {
+			return hash, nil
+		}
+	}
+
+	hash, err := n.hashQueue.Recent(hashMaxAge)
+	if err != nil {
+		return chainhash.Hash{}, err
+	}
+	return *hash, nil
+}
+
+// chainTip returns the best tip of the header chain, the height is -1 while
+// unknown or without a header chain.
+func (n *Network) chainTip() (chainhash.Hash, int32) {
+	if n.headers == nil {
+		return chainhash.Hash{}, -1
+	}
+	return n.headers.Tip()
+}
+
+// noteTip records a new best tip of the header chain.
+func (n *Network) noteTip() {
+	hash, height := n.chainTip()
+
+	n.mutex.Lock()
+	n.lastBlockTime = time.Now()
+	n.mutex.Unlock()
+
+	if height >= 0 {
+		n.Logger.Println("New tip:", height, hash.String())
+	} else {
+		n.Logger.Println("New tip:", hash.String())
+	}
+}
+
+// stop hands the queued pings to the connections, closes the connections
+// and saves the state of the network. The connections relay their pending
+// pings before closing, see PingerConnection.Start.
+func (n *Network) stop(err error) {
+	n.mutex.Lock()
+	n.err = err
+	n.mutex.Unlock()
+
+	n.Logger.Println("Shutting down, relaying the pending pings.")
+
+	for pending := true; pending; {
+		select {
+		case ping := <-n.pingChannel:
+			n.relayPing(ping)
+		default:
+			pending = false
+		}
+	}
+
+	n.cancelConnections()
+
+	if err := n.saveState(); err != nil {
+		n.Logger.Println("Unable to save the state:", err)
+	}
+
+	close(n.done)
+}
@@ -0,0 +1,240 @@
+/**
+*    Copyright (C) 2019-present C2CV Holdings, LLC.
+*
+*    This program is free software: you can redistribute it and/or modify
+*    it under the terms of the Server Side Public License, version 1,
+*    as published by C2CV Holdings, LLC.
+*
+*    This program is distributed in the hope that it will be useful,
+*    but WITHOUT ANY WARRANTY; without even the implied warranty of
+*    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*    Server Side Public License for more details.
+*
+*    You should have received a copy of the Server Side Public License
+*    along with this program. If not, see
+*    <http://www.mongodb.com/licensing/server-side-public-license>.
+*
+*    As a special exception, the copyright holders give permission to link the
+*    code of portions of this program with the OpenSSL library under certain
+*    conditions as described in each individual source file and distribute
+*    linked combinations including the program with the OpenSSL library. You
+*    must comply with the Server Side Public License in all respects for
+*    all of the code used other than as permitted herein. If you modify file(s)
+*    with this exception, you may extend this exception to your version of the
+*    file(s), but you are not obligated to do so. If you do not wish to do so,
+*    delete this exception statement from your version. If you delete this
+*    exception statement from all source files in the program, then also delete
+*    it in the license file.
+ */
+
+package phantom
+
+import (
+	"errors"
+	"net"
+	"sort"
+	"time"
+
+	"../socket/wire"
+	"../storage"
+)
+
+const (
+	peerBanDuration = 6 * time.Hour
+
+	//a peer disconnecting this many times within the window is banned
+	peerDisconnectLimit  = 3
+	peerDisconnectWindow = 30 * time.Minute
+)
+
+// PeerBan is a peer that is temporarily excluded from the connections.
+type PeerBan struct {
+	Address string    `json:"address"`
+	Reason  string    `json:"reason"`
+	Since   time.Time `json:"since"`
+	Until   time.Time `json:"until"`
+}
+
+// banPeer excludes the peer from the connections for peerBanDuration.
+func (n *Network) banPeer(ip string, reason string) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	now := time.Now().UTC()
+	n.bans[ip] = PeerBan{
+		Address: ip,
+		Reason:  reason,
+		Since:   now,
+		Until:   now.Add(peerBanDuration),
+	}
+	delete(n.peerSet, ip)
+	delete(n.disconnects, ip)
+
+	peersBanned.Inc(n.Config.Name)
+	n.Logger.Printf("%s : Banned until %s: %s\n", ip, now.Add(peerBanDuration).Format("15:04:05"), reason)
+}
+
+// isBanned reports whether the peer is banned. The caller holds the mutex.
+func (n *Network) isBanned(ip string) bool {
+	ban, ok := n.bans[ip]
+	if !ok {
+		return false
+	}
+
+	if time.Now().After(ban.Until) {
+		delete(n.bans, ip)
+		return false
+	}
+	return true
+}
+
+// notePeerDisconnect records a dropped connection and bans the peers that
+// keep disconnecting.
+func (n *Network) notePeerDisconnect(ip string) {
+	n.mutex.Lock()
+
+	cutoff := time.Now().Add(-peerDisconnectWindow)
+	recent := []time.Time{time.Now()}
+	for _, disconnect := range n.disconnects[ip] {
+		if disconnect.After(cutoff) {
+			recent = append(recent, disconnect)
+		}
+	}
+	n.disconnects[ip] = recent
+
+	n.mutex.Unlock()
+
+	if len(recent) >= peerDisconnectLimit {
+		n.banPeer(ip, "disconnected repeatedly")
+	}
+}
+
+// Bans returns the active bans of the network.
+func (n *Network) Bans() []PeerBan {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	bans := make([]PeerBan, 0, len(n.bans))
+	for ip, ban := range n.bans {
+		if n.isBanned(ip) {
+			bans = append(bans, ban)
+		}
+	}
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].Address < bans[j].Address
+	})
+
+	return bans
+}
+
+// ClearBans lifts the ban of the given peer, or every ban when ip is empty.
+// It returns the number of lifted bans.
+func (n *Network) ClearBans(ip string) int {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if ip == "" {
+		cleared := len(n.bans)
+		n.bans = make(map[string]PeerBan)
+		return cleared
+	}
+
+	if _, ok := n.bans[ip]; !ok {
+		return 0
+	}
+
+	delete(n.bans, ip)
+	return 1
+}
+
+// peerHistory returns the address book records keyed by ip:port.
+func (n *Network) peerHistory() map[string]storage.PeerRecord {
+	history := make(map[string]storage.PeerRecord)
+	if n.addressBook == nil {
+		return history
+	}
+
+	records, err := n.addressBook.Peers()
+	if err != nil {
+		n.Logger.Println("Address book:", err)
+		return history
+	}
+
+	for _, record := range records {
+		history[record.Address] = record
+	}
+	return history
+}
+
+// peerScore ranks a peer by its history, peers that completed a handshake
+// recently come first and every failure lowers the score.
+func peerScore(record storage.PeerRecord, known bool) float64 {
+	if !known {
+		return 0
+	}
+
+	score := 0.0
+	if !record.LastSuccess.IsZero() {
+		//decays from 100 to 0 over a week
+		score += 100 - time.Since(record.LastSuccess).Hours()*100/(7*24)
+		if score < 1 {
+			score = 1
+		}
+	}
+
+	return score - float64(record.Failures)*20
+}
+
+// subnet returns the /16 of an IPv4 address, or the /32 of an IPv6 address.
+// The .onion peers have no subnet, each one is its own group.
+func subnet(host string) string {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return host
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(net.CIDRMask(16, 32)).String()
+	}
+	return ip.Mask(net.CIDRMask(32, 128)).String()
+}
+
+// getNextPeer picks the best peer that is neither connected nor banned,
+// preferring subnets we are not connected to yet.
+func (n *Network) getNextPeer(connectionSet map[string]*PingerConnection, history map[string]storage.PeerRecord) (wire.NetAddress, error) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	usedSubnets := make(map[string]bool)
+	for _, pinger := range connectionSet {
+		usedSubnets[subnet(pinger.IpAddress)] = true
+	}
+
+	var best wire.NetAddress
+	var bestScore float64
+	var bestNewSubnet, found bool
+
+	for ip, peer := range n.peerSet {
+		if _, ok := connectionSet[ip]; ok || n.isBanned(ip) {
+			continue
+		}
+
+		record, known := history[peerKey(ip, peer.Port)]
+		score := peerScore(record, known)
+		newSubnet := !usedSubnets[subnet(ip)]
+
+		//a new subnet always wins over a better score
+		if !found || (newSubnet && !bestNewSubnet) || (newSubnet == bestNewSubnet && score > bestScore) {
+			best, bestScore, bestNewSubnet, found = peer, score, newSubnet, true
+		}
+	}
+
+	if !found {
+		return best, errors.New("No peers found.")
+	}
+
+	//remove the peer from the connection list
+	delete(n.peerSet, best.Hostname())
+	n.Logger.Println("New peer found: ", best.Hostname(), " (", len(connectionSet), "/", n.Config.MaxConnections, ")")
+
+	return best, nil
+}
@@ -30,14 +30,26 @@
 package phantom
 
 import (
+	"errors"
 	"sync"
+	"time"
 
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 )
 
+// ErrNoRecentHash is returned by Recent when no block was seen lately.
+var ErrNoRecentHash = errors.New("no recent block hash")
+
+// QueuedHash is a queued hash along with the time it was first seen.
+type QueuedHash struct {
+	Hash chainhash.Hash `json:"hash"`
+	Seen time.Time      `json:"seen"`
+}
+
 // Queue is a basic FIFO queue based on a circular list that resizes as needed.
 type Queue struct {
 	nodes []*chainhash.Hash
+	seen  map[chainhash.Hash]time.Time
 	size  int
 	head  int
 	tail  int
@@ -48,12 +60,19 @@ type Queue struct {
 func NewQueue(size int) *Queue {
 	return &Queue{
 		nodes: make([]*chainhash.Hash, size),
+		seen:  make(map[chainhash.Hash]time.Time),
 		size:  size,
 	}
 }
 
-// Push adds a node to the queue.
+// Push adds a node to the queue, seen now.
 func (q *Queue) Push(n *chainhash.Hash) {
+	q.PushSeen(n, time.Now().UTC())
+}
+
+// PushSeen adds a node to the queue along with the time it was seen and
+// reports whether it was added.
+func (q *Queue) PushSeen(n *chainhash.Hash, seen time.Time) bool {
 	q.mux.Lock()
 
 	defer q.mux.Unlock()
@@ -62,7 +81,7 @@ func (q *Queue) Push(n *chainhash.Hash) {
 	for _, node := range q.nodes {
 		if node != nil && node.String() == n.String() {
 			//log.Println("Duplicate hash found - all is well.")
-			return //skip a hash that we already have
+			return false //skip a hash that we already have
 		}
 	}
 
@@ -75,8 +94,10 @@ func (q *Queue) Push(n *chainhash.Hash) {
 		q.nodes = nodes
 	}
 	q.nodes[q.tail] = n
+	q.seen[*n] = seen
 	q.tail = (q.tail + 1) % len(q.nodes)
 	q.count++
+	return true
 }
 
 // Pop removes and returns a node from the queue in first to last order.
@@ -89,6 +110,7 @@ func (q *Queue) Pop() *chainhash.Hash {
 		return nil
 	}
 	node := q.nodes[q.head]
+	delete(q.seen, *node)
 	q.head = (q.head + 1) % len(q.nodes)
 	q.count--
 	return node
@@ -105,6 +127,59 @@ func (q *Queue) Peek() *chainhash.Hash {
 	return q.nodes[q.head]
 }
 
+// Hashes returns a copy of the queued hashes from first to last.
+func (q *Queue) Hashes() []chainhash.Hash {
+	q.mux.Lock()
+
+	defer q.mux.Unlock()
+
+	hashes := make([]chainhash.Hash, 0, q.count)
+	for i := 0; i < q.count; i++ {
+		hashes = append(hashes, *q.nodes[(q.head+i)%len(q.nodes)])
+	}
+	return hashes
+}
+
+// Entries returns a copy of the queued hashes and their seen time from first
+// to last.
+func (q *Queue) Entries() []QueuedHash {
+	q.mux.Lock()
+
+	defer q.mux.Unlock()
+
+	entries := make([]QueuedHash, 0, q.count)
+	for i := 0; i < q.count; i++ {
+		node := q.nodes[(q.head+i)%len(q.nodes)]
+		entries = append(entries, QueuedHash{Hash: *node, Seen: q.seen[*node]})
+	}
+	return entries
+}
+
+// Recent returns the first hash of the queue provided a hash was seen within
+// maxAge, a stale queue would produce pings the network rejects.
+func (q *Queue) Recent(maxAge time.Duration) (*chainhash.Hash, error) {
+	q.mux.Lock()
+
+	defer q.mux.Unlock()
+
+	if q.count == 0 {
+		return nil, ErrNoRecentHash
+	}
+
+	var lastSeen time.Time
+	for _, seen := range q.seen {
+		if seen.After(lastSeen) {
+			lastSeen = seen
+		}
+	}
+
+	if time.Since(lastSeen) > maxAge {
+		return nil, ErrNoRecentHash
+	}
+
+	return q.nodes[q.head], nil
+}
+
 func (q *Queue) Len() int {
 	q.mux.Lock()
 
@@ -0,0 +1,148 @@
+/**
+*    Copyright (C) 2019-present C2CV Holdings, LLC.
+*
+*    This program is free software: you can redistribute it and/or modify
+*    it under the terms of the Server Side Public License, version 1,
+*    as published by C2CV Holdings, LLC.
+*
+*    This program is distributed in the hope that it will be useful,
+*    but WITHOUT ANY WARRANTY; without even the implied warranty of
+*    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*    Server Side Public License for more details.
+*
+*    You should have received a copy of the Server Side Public License
+*    along with this program. If not, see
+*    <http://www.mongodb.com/licensing/server-side-public-license>.
+*
+*    As a special exception, the copyright holders give permission to link the
+*    code of portions of this program with the OpenSSL library under certain
+*    conditions as described in each individual source file and distribute
+*    linked combinations including the program with the OpenSSL library. You
+*    must comply with the Server Side Public License in all respects for
+*    all of the code used other than as permitted herein. If you modify file(s)
+*    with this exception, you may extend this exception to your version of the
+*    file(s), but you are not obligated to do so. If you do not wish to do so,
+*    delete this exception statement from your version. If you delete this
+*    exception statement from all source files in the program, then also delete
+*    it in the license file.
+ */
+
+package phantom
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"../socket/wire"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// the announced pings and broadcasts are served for relayTTL, the nodes
+// consider a ping expired after an hour anyway. At most relayMaxMessages are
+// kept, a ping or broadcast is about 200 to 500 bytes.
+const (
+	invTypeMasternodeBroadcast wire.InvType = 14
+	invTypeMasternodePing      wire.InvType = 15
+
+	relayTTL         = time.Hour
+	relayMaxMessages = 10000
+)
+
+// RelayStore keeps the pings and broadcasts announced to the peers by their
+// inv hash, so a getdata is answered whichever connection announced it.
+// Messages expire after the ttl and the oldest are dropped once the store is
+// full.
+type RelayStore struct {
+	mutex       sync.Mutex
+	ttl         time.Duration
+	maxMessages int
+	messages    map[chainhash.Hash]*list.Element
+	order       *list.List
+}
+
+type relayEntry struct {
+	hash    chainhash.Hash
+	message wire.Message
+	expires time.Time
+}
+
+// sharedRelayStore is used by every network of the process.
+var sharedRelayStore = NewRelayStore(relayTTL, relayMaxMessages)
+
+// NewRelayStore creates an empty store.
+func NewRelayStore(ttl time.Duration, maxMessages int) *RelayStore {
+	return &RelayStore{
+		ttl:         ttl,
+		maxMessages: maxMessages,
+		messages:    make(map[chainhash.Hash]*list.Element),
+		order:       list.New(),
+	}
+}
+
+// Put stores the message announced with hash, an announced message is served
+// for the whole ttl again.
+func (s *RelayStore) Put(hash chainhash.Hash, message wire.Message) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	s.expire(now)
+
+	if element, ok := s.messages[hash]; ok {
+		entry := element.Value.(*relayEntry)
+		entry.message = message
+		entry.expires = now.Add(s.ttl)
+		s.order.MoveToBack(element)
+		return
+	}
+
+	for s.order.Len() >= s.maxMessages {
+		s.remove(s.order.Front())
+	}
+
+	s.messages[hash] = s.order.PushBack(&relayEntry{hash: hash, message: message, expires: now.Add(s.ttl)})
+}
+
+// Get returns the message announced with hash unless it expired.
+func (s *RelayStore) Get(hash chainhash.Hash) (wire.Message, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	element, ok := s.messages[hash]
+	if !ok {
+		return nil, false
+	}
+
+	entry := element.Value.(*relayEntry)
+	if time.Now().After(entry.expires) {
+		s.remove(element)
+		return nil, false
+	}
+	return entry.message, true
+}
+
+// Len returns the number of messages stored, expired ones included until
+// the next Put.
+func (s *RelayStore) Len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.order.Len()
+}
+
+// expire drops the expired messages, the oldest are at the front since every
+// message lives for the same ttl. The caller holds the mutex.
+func (s *RelayStore) expire(now time.Time) {
+	for element := s.order.Front(); element != nil; element = s.order.Front() {
+		if !now.After(element.Value.(*relayEntry).expires) {
+			return
+		}
+		s.remove(element)
+	}
+}
+
+func (s *RelayStore) remove(element *list.Element) {
+	delete(s.messages, element.Value.(*relayEntry).hash)
+	s.order.Remove(element)
+}
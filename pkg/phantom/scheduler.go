@@ -0,0 +1,220 @@
+/**
+*    Copyright (C) 2019-present C2CV Holdings, LLC.
+*
+*    This program is free software: you can redistribute it and/or modify
+*    it under the terms of the Server Side Public License, version 1,
+*    as published by C2CV Holdings, LLC.
+*
+*    This program is distributed in the hope that it will be useful,
+*    but WITHOUT ANY WARRANTY; without even the implied warranty of
+*    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*    Server Side Public License for more details.
+*
+*    You should have received a copy of the Server Side Public License
+*    along with this program. If not, see
+*    <http://www.mongodb.com/licensing/server-side-public-license>.
+*
+*    As a special exception, the copyright holders give permission to link the
+*    code of portions of this program with the OpenSSL library under certain
+*    conditions as described in each individual source file and distribute
+*    linked combinations including the program with the OpenSSL library. You
+*    must comply with the Server Side Public License in all respects for
+*    all of the code used other than as permitted herein. If you modify file(s)
+*    with this exception, you may extend this exception to your version of the
+*    file(s), but you are not obligated to do so. If you do not wish to do so,
+*    delete this exception statement from your version. If you delete this
+*    exception statement from all source files in the program, then also delete
+*    it in the license file.
+ */
+
+package phantom
+
+import (
+	"context"
+	"os"
+	"strings"
+	"time"
+)
+
+// pingSchedule keeps a masternode entry pinging every ten minutes, aligned on
+// its epoch, until it is stopped.
+type pingSchedule struct {
+	entry MasternodeEntry
+	stop  chan struct{}
+}
+
+// sameSchedule reports whether two entries produce the same pings. Assumed
+// epochs change on every load so they are ignored.
+func sameSchedule(a MasternodeEntry, b MasternodeEntry) bool {
+	if !a.EpochAssumed || !b.EpochAssumed {
+		if a.Epoch != b.Epoch {
+			return false
+		}
+	}
+
+	return a.Name == b.Name &&
+		a.Address == b.Address &&
+		a.PrivateKey == b.PrivateKey &&
+		a.OutpointHash == b.OutpointHash &&
+		a.OutpointIndex == b.OutpointIndex &&
+		a.CollateralKey == b.CollateralKey &&
+		a.CollateralPubKey == b.CollateralPubKey &&
+		a.BroadcastSig == b.BroadcastSig &&
+		a.BroadcastSigTime == b.BroadcastSigTime &&
+		strings.Join(a.Tags, ",") == strings.Join(b.Tags, ",")
+}
+
+// ReloadMasternodes re-reads the masternode file. When the file is invalid
+// the error is returned and the masternodes currently scheduled keep running.
+func (n *Network) ReloadMasternodes() error {
+	entries, err := n.LoadMasternodes()
+	if err != nil {
+		return err
+	}
+
+	n.applyMasternodes(entries)
+	return nil
+}
+
+// applyMasternodes cancels the schedules of removed or changed masternodes
+// and starts the new ones right away.
+func (n *Network) applyMasternodes(entries []MasternodeEntry) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	wanted := make(map[string]MasternodeEntry, len(entries))
+	for _, entry := range entries {
+		wanted[entry.Name] = entry
+	}
+
+	var added, removed, unchanged int
+
+	for name, schedule := range n.schedules {
+		entry, ok := wanted[name]
+		if ok && sameSchedule(schedule.entry, entry) {
+			unchanged++
+			delete(wanted, name)
+			continue
+		}
+
+		close(schedule.stop)
+		delete(n.schedules, name)
+		delete(n.masternodeSet, name)
+
+		if !ok {
+			n.Logger.Printf("%s : Disabling.\n", name)
+			removed++
+		}
+	}
+
+	for _, entry := range entries {
+		if _, ok := wanted[entry.Name]; !ok {
+			continue
+		}
+
+		schedule := &pingSchedule{
+			entry: entry,
+			stop:  make(chan struct{}),
+		}
+		n.schedules[entry.Name] = schedule
+
+		n.Logger.Printf("%s : Enabling.\n", entry.Name)
+		added++
+
+		go n.runSchedule(schedule)
+	}
+
+	n.Logger.Printf("Masternodes loaded: %d added, %d removed, %d unchanged\n", added, removed, unchanged)
+}
+
+func (n *Network) runSchedule(schedule *pingSchedule) {
+	for {
+		pingTime := determinePingTime(schedule.entry.Epoch)
+
+		n.notePingScheduled(schedule.entry, pingTime)
+
+		timer := time.NewTimer(time.Until(pingTime))
+		select {
+		case <-schedule.stop:
+			timer.Stop()
+			return
+		case <-n.ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		ping := MasternodePing{
+			Name:              schedule.entry.Name,
+			OutpointHash:      schedule.entry.OutpointHash,
+			OutpointIndex:     schedule.entry.OutpointIndex,
+			PrivateKey:        schedule.entry.PrivateKey,
+			PingTime:          pingTime,
+			MagicMessage:      n.Config.MagicMessage,
+			SentinelVersion:   n.Config.SentinelVersion,
+			DaemonVersion:     n.Config.DaemonVersion,
+			PingFormat:        n.pingFormat,
+			BroadcastTemplate: n.masternodeBroadcast(schedule.entry),
+		}
+
+		select {
+		case <-schedule.stop:
+			return
+		case <-n.ctx.Done():
+			return
+		case n.pingChannel <- ping:
+		}
+	}
+}
+
+// isScheduled reports whether the ping still belongs to an active schedule,
+// pings of removed masternodes are dropped before being relayed.
+func (n *Network) isScheduled(ping MasternodePing) bool {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	schedule, ok := n.schedules[ping.Name]
+	if !ok {
+		return false
+	}
+
+	return schedule.entry.OutpointHash == ping.OutpointHash &&
+		schedule.entry.OutpointIndex == ping.OutpointIndex &&
+		schedule.entry.PrivateKey == ping.PrivateKey
+}
+
+// watchMasternodeFile reloads the masternode file whenever it changes on disk.
+func (n *Network) watchMasternodeFile(ctx context.Context) {
+	var lastModified time.Time
+	var lastSize int64
+
+	if info, err := os.Stat(n.Config.MasternodeConf); err == nil {
+		lastModified = info.ModTime()
+		lastSize = info.Size()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+
+		info, err := os.Stat(n.Config.MasternodeConf)
+		if err != nil {
+			continue
+		}
+
+		if info.ModTime().Equal(lastModified) && info.Size() == lastSize {
+			continue
+		}
+
+		lastModified = info.ModTime()
+		lastSize = info.Size()
+
+		n.Logger.Println("Masternode file changed, reloading.")
+		if err := n.ReloadMasternodes(); err != nil {
+			n.Logger.Println("Keeping the previous masternodes.", err)
+		}
+	}
+}
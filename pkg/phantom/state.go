@@ -0,0 +1,171 @@
+/**
+*    Copyright (C) 2019-present C2CV Holdings, LLC.
+*
+*    This program is free software: you can redistribute it and/or modify
+*    it under the terms of the Server Side Public License, version 1,
+*    as published by C2CV Holdings, LLC.
+*
+*    This program is distributed in the hope that it will be useful,
+*    but WITHOUT ANY WARRANTY; without even the implied warranty of
+*    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*    Server Side Public License for more details.
+*
+*    You should have received a copy of the Server Side Public License
+*    along with this program. If not, see
+*    <http://www.mongodb.com/licensing/server-side-public-license>.
+*
+*    As a special exception, the copyright holders give permission to link the
+*    code of portions of this program with the OpenSSL library under certain
+*    conditions as described in each individual source file and distribute
+*    linked combinations including the program with the OpenSSL library. You
+*    must comply with the Server Side Public License in all respects for
+*    all of the code used other than as permitted herein. If you modify file(s)
+*    with this exception, you may extend this exception to your version of the
+*    file(s), but you are not obligated to do so. If you do not wish to do so,
+*    delete this exception statement from your version. If you delete this
+*    exception statement from all source files in the program, then also delete
+*    it in the license file.
+ */
+
+package phantom
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"../socket/wire"
+	"../storage"
+)
+
+// saveState flushes the peers, the recent block hashes and the broadcast
+// templates of the network to the database.
+func (n *Network) saveState() error {
+	n.mutex.Lock()
+
+	peers := make([]wire.NetAddress, 0, len(n.peerSet))
+	for _, peer := range n.peerSet {
+		peers = append(peers, peer)
+	}
+
+	broadcasts := make(map[string]string)
+	for outpoint, broadcast := range n.broadcastSet {
+		var buf bytes.Buffer
+		if err := broadcast.BtcEncode(&buf, n.Config.ProtocolNumber, wire.BaseEncoding); err != nil {
+			continue
+		}
+		broadcasts[outpoint] = hex.EncodeToString(buf.Bytes())
+	}
+
+	n.mutex.Unlock()
+
+	for _, peer := range peers {
+		n.notePeerSeen(peer)
+	}
+
+	if err := n.saveHashes(); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(broadcasts)
+	if err != nil {
+		return err
+	}
+	if err := storage.SaveState(n.db, n.Config.Name, "broadcasts", data); err != nil {
+		return err
+	}
+
+	n.Logger.Printf("State saved: %d peers, %d hashes, %d broadcasts.\n", len(peers), n.hashQueue.Len(), len(broadcasts))
+
+	return nil
+}
+
+// loadBroadcasts restores the broadcast templates saved on the last shut
+// down, broadcasts older than 24 hours are skipped.
+func (n *Network) loadBroadcasts() error {
+	data, err := storage.LoadState(n.db, n.Config.Name, "broadcasts")
+	if err != nil || data == nil {
+		return err
+	}
+
+	var broadcasts map[string]string
+	if err := json.Unmarshal(data, &broadcasts); err != nil {
+		return err
+	}
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	loaded := 0
+	for outpoint, encoded := range broadcasts {
+		raw, err := hex.DecodeString(encoded)
+		if err != nil {
+			continue
+		}
+
+		var broadcast wire.MsgMNB
+		if err := broadcast.BtcDecode(bytes.NewReader(raw), n.Config.ProtocolNumber, wire.BaseEncoding); err != nil {
+			continue
+		}
+
+		sigTime := time.Unix(int64(broadcast.SigTime), 0)
+		if sigTime.Add(time.Hour * 24).Before(time.Now().UTC()) {
+			continue
+		}
+
+		if _, ok := n.broadcastSet[outpoint]; !ok {
+			n.broadcastSet[outpoint] = broadcast
+			loaded++
+		}
+	}
+
+	if loaded > 0 {
+		n.Logger.Printf("Broadcasts restored: %d\n", loaded)
+	}
+
+	return nil
+}
+
+// saveHashes stores the queued block hashes along with the time they were
+// seen.
+func (n *Network) saveHashes() error {
+	data, err := json.Marshal(n.hashQueue.Entries())
+	if err != nil {
+		return err
+	}
+
+	return storage.SaveState(n.db, n.Config.Name, "hashes", data)
+}
+
+// loadHashes restores the saved block hashes when one of them was seen within
+// hashMaxAge and returns the number of restored hashes.
+func (n *Network) loadHashes() (int, error) {
+	data, err := storage.LoadState(n.db, n.Config.Name, "hashes")
+	if err != nil || data == nil {
+		return 0, err
+	}
+
+	var entries []QueuedHash
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return 0, err
+	}
+
+	fresh := false
+	for _, entry := range entries {
+		if time.Since(entry.Seen) <= hashMaxAge {
+			fresh = true
+		}
+	}
+
+	if !fresh {
+		return 0, nil
+	}
+
+	for _, entry := range entries {
+		hash := entry.Hash
+		n.hashQueue.PushSeen(&hash, entry.Seen)
+	}
+
+	return len(entries), nil
+}
@@ -0,0 +1,280 @@
+/**
+*    Copyright (C) 2019-present C2CV Holdings, LLC.
+*
+*    This program is free software: you can redistribute it and/or modify
+*    it under the terms of the Server Side Public License, version 1,
+*    as published by C2CV Holdings, LLC.
+*
+*    This program is distributed in the hope that it will be useful,
+*    but WITHOUT ANY WARRANTY; without even the implied warranty of
+*    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*    Server Side Public License for more details.
+*
+*    You should have received a copy of the Server Side Public License
+*    along with this program. If not, see
+*    <http://www.mongodb.com/licensing/server-side-public-license>.
+*
+*    As a special exception, the copyright holders give permission to link the
+*    code of portions of this program with the OpenSSL library under certain
+*    conditions as described in each individual source file and distribute
+*    linked combinations including the program with the OpenSSL library. You
+*    must comply with the Server Side Public License in all respects for
+*    all of the code used other than as permitted herein. If you modify file(s)
+*    with this exception, you may extend this exception to your version of the
+*    file(s), but you are not obligated to do so. If you do not wish to do so,
+*    delete this exception statement from your version. If you delete this
+*    exception statement from all source files in the program, then also delete
+*    it in the license file.
+ */
+
+package phantom
+
+import (
+	"sort"
+	"time"
+
+	"../socket/wire"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// ConnectionStatus describes a single pinger connection.
+type ConnectionStatus struct {
+	Address     string `json:"address"`
+	Port        uint16 `json:"port"`
+	Status      int8   `json:"status"`
+	Inbound     bool   `json:"inbound,omitempty"`
+	UserAgent   string `json:"user_agent,omitempty"`
+	Services    uint64 `json:"services"`
+	Protocol    uint32 `json:"protocol_version,omitempty"`
+	StartHeight int32  `json:"start_height"`
+}
+
+// BroadcastStatus describes a cached masternode broadcast.
+type BroadcastStatus struct {
+	Outpoint        string    `json:"outpoint"`
+	SigTime         time.Time `json:"sig_time"`
+	ProtocolVersion uint32    `json:"protocol_version"`
+	LastPingTime    time.Time `json:"last_ping_time"`
+}
+
+// MasternodeStatus describes the ping state of a masternode entry and how
+// the network sees it: the peers announcing the last ping back, and the
+// latest ping and broadcast of the collateral received from the network.
+type MasternodeStatus struct {
+	Name             string    `json:"name"`
+	Outpoint         string    `json:"outpoint"`
+	NextPing         time.Time `json:"next_ping"`
+	LastPing         time.Time `json:"last_ping"`
+	BlockHash        string    `json:"block_hash"`
+	Relays           int       `json:"relays"`
+	SeenBy           int       `json:"seen_by"`
+	NetworkPing      time.Time `json:"network_ping"`
+	NetworkBroadcast time.Time `json:"network_broadcast"`
+	Tags             []string  `json:"tags,omitempty"`
+
+	pingInv chainhash.Hash
+	seenBy  map[string]struct{}
+}
+
+// NetworkStatus is a point in time snapshot of a network.
+type NetworkStatus struct {
+	Name          string             `json:"name"`
+	StartTime     time.Time          `json:"start_time"`
+	LastBlockTime time.Time          `json:"last_block_time"`
+	Tip           string             `json:"tip"`
+	Height        int32              `json:"height"`
+	Peers         []string           `json:"peers"`
+	Connections   []ConnectionStatus `json:"connections"`
+	Hashes        []string           `json:"hashes"`
+	Broadcasts    []BroadcastStatus  `json:"broadcasts"`
+	Masternodes   []MasternodeStatus `json:"masternodes"`
+}
+
+// Status returns a snapshot of the network state.
+func (n *Network) Status() NetworkStatus {
+	tip, height := n.chainTip()
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	status := NetworkStatus{
+		Name:          n.Config.Name,
+		StartTime:     n.startTime,
+		LastBlockTime: n.lastBlockTime,
+		Tip:           tip.String(),
+		Height:        height,
+		Peers:         make([]string, 0, len(n.peerSet)),
+		Connections:   make([]ConnectionStatus, 0, len(n.connectionSet)+len(n.inboundSet)),
+		Hashes:        make([]string, 0, n.hashQueue.Len()),
+		Broadcasts:    make([]BroadcastStatus, 0, len(n.broadcastSet)),
+		Masternodes:   make([]MasternodeStatus, 0, len(n.masternodeSet)),
+	}
+
+	for _, peer := range n.peerSet {
+		status.Peers = append(status.Peers, peerKey(peer.Hostname(), peer.Port))
+	}
+	sort.Strings(status.Peers)
+
+	for _, pingers := range []map[string]*PingerConnection{n.connectionSet, n.inboundSet} {
+		for _, pinger := range pingers {
+			status.Connections = append(status.Connections, pinger.connectionStatus())
+		}
+	}
+	sort.Slice(status.Connections, func(i, j int) bool {
+		return status.Connections[i].Address < status.Connections[j].Address
+	})
+
+	for _, hash := range n.hashQueue.Hashes() {
+		status.Hashes = append(status.Hashes, hash.String())
+	}
+
+	for key, broadcast := range n.broadcastSet {
+		status.Broadcasts = append(status.Broadcasts, BroadcastStatus{
+			Outpoint:        key,
+			SigTime:         time.Unix(int64(broadcast.SigTime), 0).UTC(),
+			ProtocolVersion: broadcast.ProtocolVersion,
+			LastPingTime:    time.Unix(int64(broadcast.LastPing.SigTime), 0).UTC(),
+		})
+	}
+	sort.Slice(status.Broadcasts, func(i, j int) bool {
+		return status.Broadcasts[i].Outpoint < status.Broadcasts[j].Outpoint
+	})
+
+	for _, masternode := range n.masternodeSet {
+		status.Masternodes = append(status.Masternodes, *masternode)
+	}
+	sort.Slice(status.Masternodes, func(i, j int) bool {
+		return status.Masternodes[i].Name < status.Masternodes[j].Name
+	})
+
+	return status
+}
+
+// notePingScheduled records the next ping time of a masternode.
+func (n *Network) notePingScheduled(entry MasternodeEntry, pingTime time.Time) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	masternode, ok := n.masternodeSet[entry.Name]
+	if !ok {
+		masternode = &MasternodeStatus{Name: entry.Name}
+		n.masternodeSet[entry.Name] = masternode
+	}
+
+	masternode.Outpoint = entry.Outpoint()
+	masternode.NextPing = pingTime.UTC()
+	masternode.Tags = entry.Tags
+}
+
+// notePingRelayed records that a ping for the masternode has been announced
+// to a peer. The relay and sighting counts are reset every time a new ping is
+// signed.
+func (n *Network) notePingRelayed(name string, sigTime uint64, blockHash chainhash.Hash, invHash chainhash.Hash) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	masternode, ok := n.masternodeSet[name]
+	if !ok {
+		masternode = &MasternodeStatus{Name: name}
+		n.masternodeSet[name] = masternode
+	}
+
+	pingTime := time.Unix(int64(sigTime), 0).UTC()
+	if !masternode.LastPing.Equal(pingTime) {
+		masternode.LastPing = pingTime
+		masternode.Relays = 0
+		masternode.SeenBy = 0
+		masternode.seenBy = make(map[string]struct{})
+
+		delete(n.pingInvs, masternode.pingInv)
+		masternode.pingInv = invHash
+		n.pingInvs[invHash] = name
+	}
+
+	masternode.BlockHash = blockHash.String()
+	masternode.Relays++
+}
+
+// notePingSeen records that a peer announced the inventory of one of our
+// pings, which it learned from another peer. It returns the alias of the
+// masternode when the peer is the first one to announce it.
+func (n *Network) notePingSeen(invHash chainhash.Hash, peer string) (string, bool) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	name, ok := n.pingInvs[invHash]
+	if !ok {
+		return "", false
+	}
+
+	masternode, ok := n.masternodeSet[name]
+	if !ok {
+		//the masternode has been removed since
+		delete(n.pingInvs, invHash)
+		return "", false
+	}
+
+	if _, ok := masternode.seenBy[peer]; ok {
+		return name, false
+	}
+
+	masternode.seenBy[peer] = struct{}{}
+	masternode.SeenBy = len(masternode.seenBy)
+	pingsSeen.Inc(n.Config.Name, name)
+
+	return name, masternode.SeenBy == 1
+}
+
+// outpointMasternode returns the status of the scheduled masternode using
+// the collateral outpoint, the mutex must be held.
+func (n *Network) outpointMasternode(outpoint string) *MasternodeStatus {
+	for name, schedule := range n.schedules {
+		if schedule.entry.Outpoint() == outpoint {
+			return n.masternodeSet[name]
+		}
+	}
+
+	return nil
+}
+
+// noteNetworkPing records a ping received from the network for one of our
+// collaterals. It returns the alias of the masternode when the ping is newer
+// than the last one we signed, which means someone else pings it too.
+func (n *Network) noteNetworkPing(mnp *wire.MsgMNP) (string, bool) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	masternode := n.outpointMasternode(mnp.Vin.PreviousOutPoint.String())
+	if masternode == nil {
+		return "", false
+	}
+
+	pingTime := time.Unix(int64(mnp.SigTime), 0).UTC()
+	if !pingTime.After(masternode.NetworkPing) {
+		return masternode.Name, false
+	}
+	masternode.NetworkPing = pingTime
+
+	return masternode.Name, pingTime.After(masternode.LastPing) && !masternode.LastPing.IsZero()
+}
+
+// noteNetworkBroadcast records a broadcast received from the network for one
+// of our collaterals and reports whether it is the first one seen.
+func (n *Network) noteNetworkBroadcast(mnb *wire.MsgMNB) (string, bool) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	masternode := n.outpointMasternode(mnb.Vin.PreviousOutPoint.String())
+	if masternode == nil {
+		return "", false
+	}
+
+	sigTime := time.Unix(int64(mnb.SigTime), 0).UTC()
+	if !sigTime.After(masternode.NetworkBroadcast) {
+		return masternode.Name, false
+	}
+	first := masternode.NetworkBroadcast.IsZero()
+	masternode.NetworkBroadcast = sigTime
+
+	return masternode.Name, first
+}
@@ -0,0 +1,160 @@
+/**
+*    Copyright (C) 2019-present C2CV Holdings, LLC.
+*
+*    This program is free software: you can redistribute it and/or modify
+*    it under the terms of the Server Side Public License, version 1,
+*    as published by C2CV Holdings, LLC.
+*
+*    This program is distributed in the hope that it will be useful,
+*    but WITHOUT ANY WARRANTY; without even the implied warranty of
+*    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*    Server Side Public License for more details.
+*
+*    You should have received a copy of the Server Side Public License
+*    along with this program. If not, see
+*    <http://www.mongodb.com/licensing/server-side-public-license>.
+*
+*    As a special exception, the copyright holders give permission to link the
+*    code of portions of this program with the OpenSSL library under certain
+*    conditions as described in each individual source file and distribute
+*    linked combinations including the program with the OpenSSL library. You
+*    must comply with the Server Side Public License in all respects for
+*    all of the code used other than as permitted herein. If you modify file(s)
+*    with this exception, you may extend this exception to your version of the
+*    file(s), but you are not obligated to do so. If you do not wish to do so,
+*    delete this exception statement from your version. If you delete this
+*    exception statement from all source files in the program, then also delete
+*    it in the license file.
+ */
+
+package phantom
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+// genesisEpoch is the time of the bitcoin genesis block, no masternode epoch
+// can be older than that.
+const genesisEpoch = 1231006505
+
+// ValidateMasternodeEntries checks the values of the entries that the
+// parsers accept as plain strings. Every problem is reported, prefixed with
+// the location of the entry. The wif prefix is the hex secret key prefix of
+// the coin, required to check the keys belong to it.
+func ValidateMasternodeEntries(entries []MasternodeEntry, wifPrefix string) []string {
+	var problems []string
+
+	var params *chaincfg.Params
+	if wifPrefix == "" && len(entries) > 0 {
+		problems = append(problems, "the coin configuration has no wif_prefix, set it to the hex secret key prefix of the coin (base58Prefixes[SECRET_KEY] in its chainparams.cpp) so the private keys can be checked")
+	} else if wifPrefix != "" {
+		prefix, err := strconv.ParseUint(wifPrefix, 16, 8)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("invalid wif prefix %q in the coin configuration", wifPrefix))
+		} else {
+			params = &chaincfg.Params{PrivateKeyID: byte(prefix)}
+		}
+	}
+
+	latestEpoch := time.Now().Add(time.Minute * 10).Unix()
+
+	for _, entry := range entries {
+		prefix := entry.Location + " (" + entry.Name + ")"
+
+		wif, err := btcutil.DecodeWIF(entry.PrivateKey)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: invalid private key: %v", prefix, err))
+		} else if params != nil && !wif.IsForNet(params) {
+			problems = append(problems, fmt.Sprintf("%s: the private key belongs to another coin (expected wif prefix %s)", prefix, wifPrefix))
+		}
+
+		if len(entry.OutpointHash) != 64 {
+			problems = append(problems, fmt.Sprintf("%s: the collateral txid must be 64 hex characters, found %d", prefix, len(entry.OutpointHash)))
+		} else if _, err := hex.DecodeString(entry.OutpointHash); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: the collateral txid is not hexadecimal", prefix))
+		}
+
+		if !entry.EpochAssumed {
+			if entry.Epoch < genesisEpoch {
+				problems = append(problems, fmt.Sprintf("%s: epoch %d is too old, use a unix timestamp in seconds", prefix, entry.Epoch))
+			} else if entry.Epoch > latestEpoch {
+				problems = append(problems, fmt.Sprintf("%s: epoch %d is in the future", prefix, entry.Epoch))
+			}
+		}
+
+		if entry.CanBroadcast() {
+			problems = append(problems, validateBroadcastEntry(entry, prefix, params, wifPrefix)...)
+		}
+	}
+
+	return problems
+}
+
+// validateBroadcastEntry checks what is needed to create the broadcast of
+// the entry.
+func validateBroadcastEntry(entry MasternodeEntry, prefix string, params *chaincfg.Params, wifPrefix string) []string {
+	var problems []string
+
+	if _, err := ParseService(entry.Address); err != nil {
+		problems = append(problems, fmt.Sprintf("%s: a broadcast needs the masternode address: %v", prefix, err))
+	}
+
+	if entry.CollateralKey != "" {
+		wif, err := btcutil.DecodeWIF(entry.CollateralKey)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: invalid collateral key: %v", prefix, err))
+		} else if params != nil && !wif.IsForNet(params) {
+			problems = append(problems, fmt.Sprintf("%s: the collateral key belongs to another coin (expected wif prefix %s)", prefix, wifPrefix))
+		}
+		return problems
+	}
+
+	pubKey, err := hex.DecodeString(entry.CollateralPubKey)
+	if err == nil {
+		_, err = btcec.ParsePubKey(pubKey)
+	}
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("%s: invalid collateral public key: %v", prefix, err))
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(entry.BroadcastSig)
+	if err != nil || len(sig) != 65 {
+		problems = append(problems, fmt.Sprintf("%s: the broadcast signature must be a base64 compact signature", prefix))
+	}
+
+	if entry.BroadcastSigTime < genesisEpoch {
+		problems = append(problems, fmt.Sprintf("%s: missing or invalid broadcast_sig_time", prefix))
+	}
+
+	return problems
+}
+
+// LoadMasternodes loads and validates the masternode configuration of the
+// network without scheduling anything.
+func (n *Network) LoadMasternodes() ([]MasternodeEntry, error) {
+	entries, err := LoadMasternodeConf(n.Config.MasternodeConf, n.Config.Name, n.Config.Keys)
+
+	confError, ok := err.(*MasternodeConfError)
+	if err != nil && !ok {
+		return nil, err
+	}
+	if !ok {
+		confError = &MasternodeConfError{Path: n.Config.MasternodeConf}
+	}
+
+	//report the parsing and the validation problems together
+	confError.Problems = append(confError.Problems, ValidateMasternodeEntries(entries, n.Config.WIFPrefix)...)
+	if len(confError.Problems) > 0 {
+		return nil, confError
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,120 @@
+package powhash
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// BLAKE-512 as submitted to the SHA-3 competition (16 rounds, no salt).
+
+var blakeIV = [8]uint64{
+	0x6a09e667f3bcc908, 0xbb67ae8584caa73b, 0x3c6ef372fe94f82b, 0xa54ff53a5f1d36f1,
+	0x510e527fade682d1, 0x9b05688c2b3e6c1f, 0x1f83d9abfb41bd6b, 0x5be0cd19137e2179,
+}
+
+var blakeC = [16]uint64{
+	0x243f6a8885a308d3, 0x13198a2e03707344, 0xa4093822299f31d0, 0x082efa98ec4e6c89,
+	0x452821e638d01377, 0xbe5466cf34e90c6c, 0xc0ac29b7c97c50dd, 0x3f84d5b5b5470917,
+	0x9216d5d98979fb1b, 0xd1310ba698dfb5ac, 0x2ffd72dbd01adfb7, 0xb8e1afed6a267e96,
+	0xba7c9045f12c7f99, 0x24a19947b3916cf7, 0x0801f2e2858efc16, 0x636920d871574e69,
+}
+
+var blakeSigma = [10][16]uint8{
+	{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15},
+	{14, 10, 4, 8, 9, 15, 13, 6, 1, 12, 0, 2, 11, 7, 5, 3},
+	{11, 8, 12, 0, 5, 2, 15, 13, 10, 14, 3, 6, 7, 1, 9, 4},
+	{7, 9, 3, 1, 13, 12, 11, 14, 2, 6, 5, 10, 4, 0, 15, 8},
+	{9, 0, 5, 7, 2, 4, 10, 15, 14, 1, 11, 12, 6, 8, 3, 13},
+	{2, 12, 6, 10, 0, 11, 8, 3, 4, 13, 7, 5, 15, 14, 1, 9},
+	{12, 5, 1, 15, 14, 13, 4, 10, 0, 7, 6, 3, 9, 2, 8, 11},
+	{13, 11, 7, 14, 12, 1, 3, 9, 5, 0, 15, 4, 8, 6, 2, 10},
+	{6, 15, 14, 9, 11, 3, 0, 8, 12, 2, 13, 7, 1, 4, 10, 5},
+	{10, 2, 8, 4, 7, 6, 1, 5, 15, 11, 9, 14, 3, 12, 13, 0},
+}
+
+func blake512Block(h *[8]uint64, block []byte, counter uint64) {
+	var m [16]uint64
+	for i := range m {
+		m[i] = binary.BigEndian.Uint64(block[i*8:])
+	}
+
+	var v [16]uint64
+	copy(v[:8], h[:])
+	v[8] = blakeC[0]
+	v[9] = blakeC[1]
+	v[10] = blakeC[2]
+	v[11] = blakeC[3]
+	v[12] = counter ^ blakeC[4]
+	v[13] = counter ^ blakeC[5]
+	v[14] = blakeC[6]
+	v[15] = blakeC[7]
+
+	g := func(s *[16]uint8, i, a, b, c, d int) {
+		x, y := s[2*i], s[2*i+1]
+		v[a] += v[b] + (m[x] ^ blakeC[y])
+		v[d] = bits.RotateLeft64(v[d]^v[a], -32)
+		v[c] += v[d]
+		v[b] = bits.RotateLeft64(v[b]^v[c], -25)
+		v[a] += v[b] + (m[y] ^ blakeC[x])
+		v[d] = bits.RotateLeft64(v[d]^v[a], -16)
+		v[c] += v[d]
+		v[b] = bits.RotateLeft64(v[b]^v[c], -11)
+	}
+
+	for r := 0; r < 16; r++ {
+		s := &blakeSigma[r%10]
+		g(s, 0, 0, 4, 8, 12)
+		g(s, 1, 1, 5, 9, 13)
+		g(s, 2, 2, 6, 10, 14)
+		g(s, 3, 3, 7, 11, 15)
+		g(s, 4, 0, 5, 10, 15)
+		g(s, 5, 1, 6, 11, 12)
+		g(s, 6, 2, 7, 8, 13)
+		g(s, 7, 3, 4, 9, 14)
+	}
+
+	for i := range h {
+		h[i] ^= v[i] ^ v[i+8]
+	}
+}
+
+// Blake512 returns the BLAKE-512 digest of data.
+func Blake512(data []byte) [64]byte {
+	h := blakeIV
+	length := uint64(len(data))
+
+	for len(data) >= 128 {
+		length128 := length - uint64(len(data)) + 128
+		blake512Block(&h, data[:128], length128*8)
+		data = data[128:]
+	}
+
+	// The counter holds the number of message bits in the blocks hashed so
+	// far and is zero for a block made of padding only.
+	var tail [256]byte
+	n := copy(tail[:], data)
+	tail[n] = 0x80
+	size := 128
+	if n >= 112 {
+		size = 256
+	}
+	tail[size-17] |= 0x01
+	binary.BigEndian.PutUint64(tail[size-8:], length*8)
+
+	if size == 256 {
+		blake512Block(&h, tail[:128], length*8)
+		blake512Block(&h, tail[128:], 0)
+	} else {
+		counter := length * 8
+		if n == 0 && length > 0 {
+			counter = 0
+		}
+		blake512Block(&h, tail[:128], counter)
+	}
+
+	var out [64]byte
+	for i, w := range h {
+		binary.BigEndian.PutUint64(out[i*8:], w)
+	}
+	return out
+}
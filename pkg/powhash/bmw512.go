@@ -0,0 +1,156 @@
+package powhash
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// Blue Midnight Wish 512 (second round tweak).
+
+var bmwIV = func() (iv [16]uint64) {
+	for i := range iv {
+		for j := 0; j < 8; j++ {
+			iv[i] = iv[i]<<8 | uint64(0x80+i*8+j)
+		}
+	}
+	return iv
+}()
+
+var bmwFinal = func() (h [16]uint64) {
+	for i := range h {
+		h[i] = 0xaaaaaaaaaaaaaaa0 + uint64(i)
+	}
+	return h
+}()
+
+func bmwS0(x uint64) uint64 {
+	return x>>1 ^ x<<3 ^ bits.RotateLeft64(x, 4) ^ bits.RotateLeft64(x, 37)
+}
+
+func bmwS1(x uint64) uint64 {
+	return x>>1 ^ x<<2 ^ bits.RotateLeft64(x, 13) ^ bits.RotateLeft64(x, 43)
+}
+
+func bmwS2(x uint64) uint64 {
+	return x>>2 ^ x<<1 ^ bits.RotateLeft64(x, 19) ^ bits.RotateLeft64(x, 53)
+}
+
+func bmwS3(x uint64) uint64 {
+	return x>>2 ^ x<<2 ^ bits.RotateLeft64(x, 28) ^ bits.RotateLeft64(x, 59)
+}
+
+func bmwS4(x uint64) uint64 { return x>>1 ^ x }
+func bmwS5(x uint64) uint64 { return x>>2 ^ x }
+
+func bmwCompress(h *[16]uint64, m *[16]uint64) {
+	var x [16]uint64
+	for i := range x {
+		x[i] = m[i] ^ h[i]
+	}
+
+	var w [16]uint64
+	w[0] = x[5] - x[7] + x[10] + x[13] + x[14]
+	w[1] = x[6] - x[8] + x[11] + x[14] - x[15]
+	w[2] = x[0] + x[7] + x[9] - x[12] + x[15]
+	w[3] = x[0] - x[1] + x[8] - x[10] + x[13]
+	w[4] = x[1] + x[2] + x[9] - x[11] - x[14]
+	w[5] = x[3] - x[2] + x[10] - x[12] + x[15]
+	w[6] = x[4] - x[0] - x[3] - x[11] + x[13]
+	w[7] = x[1] - x[4] - x[5] - x[12] - x[14]
+	w[8] = x[2] - x[5] - x[6] + x[13] - x[15]
+	w[9] = x[0] - x[3] + x[6] - x[7] + x[14]
+	w[10] = x[8] - x[1] - x[4] - x[7] + x[15]
+	w[11] = x[8] - x[0] - x[2] - x[5] + x[9]
+	w[12] = x[1] + x[3] - x[6] - x[9] + x[10]
+	w[13] = x[2] + x[4] + x[7] + x[10] + x[11]
+	w[14] = x[3] - x[5] + x[8] - x[11] - x[12]
+	w[15] = x[12] - x[4] - x[6] - x[9] + x[13]
+
+	var q [32]uint64
+	s := [5]func(uint64) uint64{bmwS0, bmwS1, bmwS2, bmwS3, bmwS4}
+	for j := 0; j < 16; j++ {
+		q[j] = s[j%5](w[j]) + h[(j+1)%16]
+	}
+
+	addElement := func(j int) uint64 {
+		a, b, c := (j-16)%16, (j-13)%16, (j-6)%16
+		k := uint64(j) * 0x0555555555555555
+		return (bits.RotateLeft64(m[a], a+1) + bits.RotateLeft64(m[b], b+1) -
+			bits.RotateLeft64(m[c], c+1) + k) ^ h[(j-16+7)%16]
+	}
+
+	for j := 16; j < 18; j++ {
+		q[j] = bmwS1(q[j-16]) + bmwS2(q[j-15]) + bmwS3(q[j-14]) + bmwS0(q[j-13]) +
+			bmwS1(q[j-12]) + bmwS2(q[j-11]) + bmwS3(q[j-10]) + bmwS0(q[j-9]) +
+			bmwS1(q[j-8]) + bmwS2(q[j-7]) + bmwS3(q[j-6]) + bmwS0(q[j-5]) +
+			bmwS1(q[j-4]) + bmwS2(q[j-3]) + bmwS3(q[j-2]) + bmwS0(q[j-1]) +
+			addElement(j)
+	}
+	for j := 18; j < 32; j++ {
+		q[j] = q[j-16] + bits.RotateLeft64(q[j-15], 5) + q[j-14] + bits.RotateLeft64(q[j-13], 11) +
+			q[j-12] + bits.RotateLeft64(q[j-11], 27) + q[j-10] + bits.RotateLeft64(q[j-9], 32) +
+			q[j-8] + bits.RotateLeft64(q[j-7], 37) + q[j-6] + bits.RotateLeft64(q[j-5], 43) +
+			q[j-4] + bits.RotateLeft64(q[j-3], 53) + bmwS4(q[j-2]) + bmwS5(q[j-1]) +
+			addElement(j)
+	}
+
+	xl := q[16] ^ q[17] ^ q[18] ^ q[19] ^ q[20] ^ q[21] ^ q[22] ^ q[23]
+	xh := xl ^ q[24] ^ q[25] ^ q[26] ^ q[27] ^ q[28] ^ q[29] ^ q[30] ^ q[31]
+
+	h[0] = (xh<<5 ^ q[16]>>5 ^ m[0]) + (xl ^ q[24] ^ q[0])
+	h[1] = (xh>>7 ^ q[17]<<8 ^ m[1]) + (xl ^ q[25] ^ q[1])
+	h[2] = (xh>>5 ^ q[18]<<5 ^ m[2]) + (xl ^ q[26] ^ q[2])
+	h[3] = (xh>>1 ^ q[19]<<5 ^ m[3]) + (xl ^ q[27] ^ q[3])
+	h[4] = (xh>>3 ^ q[20] ^ m[4]) + (xl ^ q[28] ^ q[4])
+	h[5] = (xh<<6 ^ q[21]>>6 ^ m[5]) + (xl ^ q[29] ^ q[5])
+	h[6] = (xh>>4 ^ q[22]<<6 ^ m[6]) + (xl ^ q[30] ^ q[6])
+	h[7] = (xh>>11 ^ q[23]<<2 ^ m[7]) + (xl ^ q[31] ^ q[7])
+
+	h[8] = bits.RotateLeft64(h[4], 9) + (xh ^ q[24] ^ m[8]) + (xl<<8 ^ q[23] ^ q[8])
+	h[9] = bits.RotateLeft64(h[5], 10) + (xh ^ q[25] ^ m[9]) + (xl>>6 ^ q[16] ^ q[9])
+	h[10] = bits.RotateLeft64(h[6], 11) + (xh ^ q[26] ^ m[10]) + (xl<<6 ^ q[17] ^ q[10])
+	h[11] = bits.RotateLeft64(h[7], 12) + (xh ^ q[27] ^ m[11]) + (xl<<4 ^ q[18] ^ q[11])
+	h[12] = bits.RotateLeft64(h[0], 13) + (xh ^ q[28] ^ m[12]) + (xl>>3 ^ q[19] ^ q[12])
+	h[13] = bits.RotateLeft64(h[1], 14) + (xh ^ q[29] ^ m[13]) + (xl>>4 ^ q[20] ^ q[13])
+	h[14] = bits.RotateLeft64(h[2], 15) + (xh ^ q[30] ^ m[14]) + (xl>>7 ^ q[21] ^ q[14])
+	h[15] = bits.RotateLeft64(h[3], 16) + (xh ^ q[31] ^ m[15]) + (xl>>2 ^ q[22] ^ q[15])
+}
+
+// Bmw512 returns the BMW-512 digest of data.
+func Bmw512(data []byte) [64]byte {
+	h := bmwIV
+	length := uint64(len(data))
+	var m [16]uint64
+
+	for len(data) >= 128 {
+		for i := range m {
+			m[i] = binary.LittleEndian.Uint64(data[i*8:])
+		}
+		bmwCompress(&h, &m)
+		data = data[128:]
+	}
+
+	var tail [256]byte
+	n := copy(tail[:], data)
+	tail[n] = 0x80
+	size := 128
+	if n >= 120 {
+		size = 256
+	}
+	binary.LittleEndian.PutUint64(tail[size-8:], length*8)
+	for block := tail[:size]; len(block) > 0; block = block[128:] {
+		for i := range m {
+			m[i] = binary.LittleEndian.Uint64(block[i*8:])
+		}
+		bmwCompress(&h, &m)
+	}
+
+	final := bmwFinal
+	bmwCompress(&final, &h)
+
+	var out [64]byte
+	for i := 0; i < 8; i++ {
+		binary.LittleEndian.PutUint64(out[i*8:], final[i+8])
+	}
+	return out
+}
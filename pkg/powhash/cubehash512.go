@@ -0,0 +1,86 @@
+package powhash
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// CubeHash16/32-512.
+
+const (
+	cubehashRounds    = 16
+	cubehashBlockSize = 32
+)
+
+func cubehashRound(x *[32]uint32, rounds int) {
+	for r := 0; r < rounds; r++ {
+		for i := 0; i < 16; i++ {
+			x[i+16] += x[i]
+			x[i] = bits.RotateLeft32(x[i], 7)
+		}
+		for i := 0; i < 8; i++ {
+			x[i], x[i+8] = x[i+8], x[i]
+		}
+		for i := 0; i < 16; i++ {
+			x[i] ^= x[i+16]
+		}
+		for i := 16; i < 32; i++ {
+			if i&2 == 0 {
+				x[i], x[i+2] = x[i+2], x[i]
+			}
+		}
+		for i := 0; i < 16; i++ {
+			x[i+16] += x[i]
+			x[i] = bits.RotateLeft32(x[i], 11)
+		}
+		for i := 0; i < 16; i++ {
+			if i&4 == 0 {
+				x[i], x[i+4] = x[i+4], x[i]
+			}
+		}
+		for i := 0; i < 16; i++ {
+			x[i] ^= x[i+16]
+		}
+		for i := 16; i < 32; i += 2 {
+			x[i], x[i+1] = x[i+1], x[i]
+		}
+	}
+}
+
+var cubehashIV = func() (x [32]uint32) {
+	x[0] = 64
+	x[1] = cubehashBlockSize
+	x[2] = cubehashRounds
+	cubehashRound(&x, 10*cubehashRounds)
+	return x
+}()
+
+func cubehashBlock(x *[32]uint32, block []byte) {
+	for i := 0; i < cubehashBlockSize/4; i++ {
+		x[i] ^= binary.LittleEndian.Uint32(block[i*4:])
+	}
+	cubehashRound(x, cubehashRounds)
+}
+
+// Cubehash512 returns the CubeHash16/32-512 digest of data.
+func Cubehash512(data []byte) [64]byte {
+	x := cubehashIV
+	for len(data) >= cubehashBlockSize {
+		cubehashBlock(&x, data[:cubehashBlockSize])
+		data = data[cubehashBlockSize:]
+	}
+
+	var tail [cubehashBlockSize]byte
+	n := copy(tail[:], data)
+	tail[n] = 0x80
+	cubehashBlock(&x, tail[:])
+
+	x[31] ^= 1
+	cubehashRound(&x, 10*cubehashRounds)
+
+	var out [64]byte
+	for i := 0; i < 16; i++ {
+		binary.LittleEndian.PutUint32(out[i*4:], x[i])
+	}
+	return out
+}
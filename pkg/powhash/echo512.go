@@ -0,0 +1,111 @@
+package powhash
+
+import "encoding/binary"
+
+// ECHO-512. The state is a 4x4 matrix of 128 bit words, word i sitting in
+// column i/4 and row i%4, each word being an AES state.
+
+// aesBlock is an AES state, byte i sitting in column i/4 and row i%4.
+type aesBlock [16]byte
+
+// aesRound runs SubBytes, ShiftRows and MixColumns on w and adds key.
+func aesRound(w *aesBlock, key *aesBlock) {
+	var t aesBlock
+	for c := 0; c < 4; c++ {
+		for r := 0; r < 4; r++ {
+			t[c*4+r] = aesSbox[w[((c+r)%4)*4+r]]
+		}
+	}
+	for c := 0; c < 4; c++ {
+		a, b, d, e := t[c*4], t[c*4+1], t[c*4+2], t[c*4+3]
+		w[c*4] = gfMul(a, 2) ^ gfMul(b, 3) ^ d ^ e ^ key[c*4]
+		w[c*4+1] = a ^ gfMul(b, 2) ^ gfMul(d, 3) ^ e ^ key[c*4+1]
+		w[c*4+2] = a ^ b ^ gfMul(d, 2) ^ gfMul(e, 3) ^ key[c*4+2]
+		w[c*4+3] = gfMul(a, 3) ^ b ^ d ^ gfMul(e, 2) ^ key[c*4+3]
+	}
+}
+
+func echoCompress(v *[8]aesBlock, block []byte, counter uint64) {
+	var w [16]aesBlock
+	copy(w[:8], v[:])
+	for i := 0; i < 8; i++ {
+		copy(w[8+i][:], block[i*16:])
+	}
+
+	var salt aesBlock
+	for r := 0; r < 10; r++ {
+		// BigSubWords
+		for i := range w {
+			var key aesBlock
+			binary.LittleEndian.PutUint64(key[:], counter)
+			aesRound(&w[i], &key)
+			aesRound(&w[i], &salt)
+			counter++
+		}
+
+		// BigShiftRows
+		var t [16]aesBlock
+		for c := 0; c < 4; c++ {
+			for row := 0; row < 4; row++ {
+				t[c*4+row] = w[((c+row)%4)*4+row]
+			}
+		}
+
+		// BigMixColumns
+		for c := 0; c < 4; c++ {
+			for n := 0; n < 16; n++ {
+				a, b, d, e := t[c*4][n], t[c*4+1][n], t[c*4+2][n], t[c*4+3][n]
+				w[c*4][n] = gfMul(a, 2) ^ gfMul(b, 3) ^ d ^ e
+				w[c*4+1][n] = a ^ gfMul(b, 2) ^ gfMul(d, 3) ^ e
+				w[c*4+2][n] = a ^ b ^ gfMul(d, 2) ^ gfMul(e, 3)
+				w[c*4+3][n] = gfMul(a, 3) ^ b ^ d ^ gfMul(e, 2)
+			}
+		}
+	}
+
+	for i := range v {
+		for n := 0; n < 16; n++ {
+			v[i][n] ^= block[i*16+n] ^ w[i][n] ^ w[i+8][n]
+		}
+	}
+}
+
+// Echo512 returns the ECHO-512 digest of data.
+func Echo512(data []byte) [64]byte {
+	var v [8]aesBlock
+	for i := range v {
+		binary.LittleEndian.PutUint16(v[i][:], 512)
+	}
+
+	length := uint64(len(data)) * 8
+	counter := uint64(0)
+	for len(data) >= 128 {
+		counter += 1024
+		echoCompress(&v, data[:128], counter)
+		data = data[128:]
+	}
+
+	// The counter of a block holding no message bits is zero.
+	var tail [128]byte
+	n := copy(tail[:], data)
+	tail[n] = 0x80
+	if n == 0 {
+		counter = 0
+	} else {
+		counter = length
+	}
+	if n+1 > 128-18 {
+		echoCompress(&v, tail[:], counter)
+		tail = [128]byte{}
+		counter = 0
+	}
+	binary.LittleEndian.PutUint16(tail[110:], 512)
+	binary.LittleEndian.PutUint64(tail[112:], length)
+	echoCompress(&v, tail[:], counter)
+
+	var out [64]byte
+	for i := 0; i < 4; i++ {
+		copy(out[i*16:], v[i][:])
+	}
+	return out
+}
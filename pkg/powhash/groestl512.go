@@ -0,0 +1,149 @@
+package powhash
+
+import "encoding/binary"
+
+// Grøstl-512 (final round version). The state is kept as 16 columns of eight
+// bytes, byte k of a block landing in row k%8 of column k/8.
+
+const groestlColumns = 16
+
+// aesSbox is the AES S-box, shared with the other AES based algorithms.
+var aesSbox = func() (s [256]byte) {
+	p, q := byte(1), byte(1)
+	for {
+		// Walk the multiplicative group with generator 3 and its inverse.
+		p = p ^ p<<1 ^ byte(int8(p)>>7)&0x1b
+		q ^= q << 1
+		q ^= q << 2
+		q ^= q << 4
+		q ^= byte(int8(q)>>7) & 0x09
+
+		x := q ^ (q<<1 | q>>7) ^ (q<<2 | q>>6) ^ (q<<3 | q>>5) ^ (q<<4 | q>>4)
+		s[p] = x ^ 0x63
+		if p == 1 {
+			break
+		}
+	}
+	s[0] = 0x63
+	return s
+}()
+
+// gfMul multiplies two elements of GF(2^8) modulo the AES polynomial.
+func gfMul(a, b byte) byte {
+	var p byte
+	for b != 0 {
+		if b&1 != 0 {
+			p ^= a
+		}
+		a = a<<1 ^ byte(int8(a)>>7)&0x1b
+		b >>= 1
+	}
+	return p
+}
+
+var groestlMix = [8]byte{2, 2, 3, 4, 5, 3, 5, 7}
+
+var groestlShiftP = [8]int{0, 1, 2, 3, 4, 5, 6, 11}
+var groestlShiftQ = [8]int{1, 3, 5, 11, 0, 2, 4, 6}
+
+type groestlState [groestlColumns][8]byte
+
+func (s *groestlState) permute(q bool) {
+	shift := &groestlShiftP
+	if q {
+		shift = &groestlShiftQ
+	}
+
+	for r := 0; r < 14; r++ {
+		// AddRoundConstant
+		for j := 0; j < groestlColumns; j++ {
+			if q {
+				for i := 0; i < 7; i++ {
+					s[j][i] ^= 0xff
+				}
+				s[j][7] ^= 0xff ^ byte(j<<4) ^ byte(r)
+			} else {
+				s[j][0] ^= byte(j<<4) ^ byte(r)
+			}
+		}
+
+		// SubBytes and ShiftBytes
+		var t groestlState
+		for j := 0; j < groestlColumns; j++ {
+			for i := 0; i < 8; i++ {
+				t[j][i] = aesSbox[s[(j+shift[i])%groestlColumns][i]]
+			}
+		}
+
+		// MixBytes
+		for j := 0; j < groestlColumns; j++ {
+			for i := 0; i < 8; i++ {
+				var v byte
+				for k := 0; k < 8; k++ {
+					v ^= gfMul(groestlMix[(k-i+8)%8], t[j][k])
+				}
+				s[j][i] = v
+			}
+		}
+	}
+}
+
+func groestlLoad(block []byte) (s groestlState) {
+	for j := range s {
+		copy(s[j][:], block[j*8:])
+	}
+	return s
+}
+
+func groestlCompress(h *groestlState, block []byte) {
+	m := groestlLoad(block)
+	p := m
+	for j := range p {
+		for i := range p[j] {
+			p[j][i] ^= h[j][i]
+		}
+	}
+	p.permute(false)
+	m.permute(true)
+	for j := range h {
+		for i := range h[j] {
+			h[j][i] ^= p[j][i] ^ m[j][i]
+		}
+	}
+}
+
+// Groestl512 returns the Grøstl-512 digest of data.
+func Groestl512(data []byte) [64]byte {
+	var h groestlState
+	h[groestlColumns-1][6] = 0x02
+
+	blocks := uint64(0)
+	for len(data) >= 128 {
+		groestlCompress(&h, data[:128])
+		data = data[128:]
+		blocks++
+	}
+
+	var tail [256]byte
+	n := copy(tail[:], data)
+	tail[n] = 0x80
+	size := 128
+	if n >= 120 {
+		size = 256
+	}
+	blocks += uint64(size / 128)
+	binary.BigEndian.PutUint64(tail[size-8:], blocks)
+	for block := tail[:size]; len(block) > 0; block = block[128:] {
+		groestlCompress(&h, block[:128])
+	}
+
+	x := h
+	x.permute(false)
+	var out [64]byte
+	for j := 8; j < groestlColumns; j++ {
+		for i := 0; i < 8; i++ {
+			out[(j-8)*8+i] = x[j][i] ^ h[j][i]
+		}
+	}
+	return out
+}
@@ -0,0 +1,143 @@
+package powhash
+
+import "encoding/binary"
+
+// JH-512 (round 3, 42 rounds), written after the reference implementation
+// that works on 256 four bit elements. It is slow next to a bitsliced
+// version but only ever hashes block headers.
+
+var jhSbox = [2][16]byte{
+	{9, 0, 4, 11, 13, 12, 3, 15, 1, 10, 2, 6, 7, 5, 8, 14},
+	{3, 12, 6, 13, 5, 7, 1, 9, 15, 2, 0, 4, 11, 10, 14, 8},
+}
+
+// jhRoundConstantZero holds the fractional part of sqrt(2) in nibbles.
+var jhRoundConstantZero = [64]byte{
+	0x6, 0xa, 0x0, 0x9, 0xe, 0x6, 0x6, 0x7, 0xf, 0x3, 0xb, 0xc, 0xc, 0x9, 0x0, 0x8,
+	0xb, 0x2, 0xf, 0xb, 0x1, 0x3, 0x6, 0x6, 0xe, 0xa, 0x9, 0x5, 0x7, 0xd, 0x3, 0xe,
+	0x3, 0xa, 0xd, 0xe, 0xc, 0x1, 0x7, 0x5, 0x1, 0x2, 0x7, 0x7, 0x5, 0x0, 0x9, 0x9,
+	0xd, 0xa, 0x2, 0xf, 0x5, 0x9, 0x0, 0xb, 0x0, 0x6, 0x6, 0x7, 0x3, 0x2, 0x2, 0xa,
+}
+
+// jhRoundConstants are the 42 round constants, derived once from the first.
+var jhRoundConstants = func() (rc [42][64]byte) {
+	c := jhRoundConstantZero
+	for r := range rc {
+		rc[r] = c
+		var t [64]byte
+		for i := range t {
+			t[i] = jhSbox[0][c[i]]
+		}
+		jhPermute(t[:])
+		c = [64]byte{}
+		copy(c[:], t[:])
+	}
+	return rc
+}()
+
+func jhL(a, b *byte) {
+	*b ^= (*a<<1 ^ *a>>3 ^ (*a>>2)&2) & 0xf
+	*a ^= (*b<<1 ^ *b>>3 ^ (*b>>2)&2) & 0xf
+}
+
+// jhPermute applies the MDS layer and the permutation P_d to a slice of
+// 2^d elements.
+func jhPermute(a []byte) {
+	n := len(a)
+	for i := 0; i < n; i += 2 {
+		jhL(&a[i], &a[i+1])
+	}
+	for i := 0; i < n; i += 4 {
+		a[i+2], a[i+3] = a[i+3], a[i+2]
+	}
+	t := make([]byte, n)
+	for i := 0; i < n/2; i++ {
+		t[i] = a[i<<1]
+		t[i+n/2] = a[i<<1+1]
+	}
+	copy(a, t)
+	for i := n / 2; i < n; i += 2 {
+		a[i], a[i+1] = a[i+1], a[i]
+	}
+}
+
+func jhBit(h []byte, i int) byte {
+	return h[i>>3] >> (7 - uint(i&7)) & 1
+}
+
+func jhE8(h *[128]byte) {
+	var t, a [256]byte
+	for i := 0; i < 256; i++ {
+		t[i] = jhBit(h[:], i)<<3 | jhBit(h[:], i+256)<<2 | jhBit(h[:], i+512)<<1 | jhBit(h[:], i+768)
+	}
+	for i := 0; i < 128; i++ {
+		a[i<<1] = t[i]
+		a[i<<1+1] = t[i+128]
+	}
+
+	for r := 0; r < 42; r++ {
+		rc := &jhRoundConstants[r]
+		for i := 0; i < 256; i++ {
+			a[i] = jhSbox[rc[i>>2]>>(3-uint(i&3))&1][a[i]]
+		}
+		jhPermute(a[:])
+	}
+
+	for i := 0; i < 128; i++ {
+		t[i] = a[i<<1]
+		t[i+128] = a[i<<1+1]
+	}
+	*h = [128]byte{}
+	for i := 0; i < 256; i++ {
+		shift := 7 - uint(i&7)
+		h[i>>3] |= (t[i] >> 3 & 1) << shift
+		h[(i+256)>>3] |= (t[i] >> 2 & 1) << shift
+		h[(i+512)>>3] |= (t[i] >> 1 & 1) << shift
+		h[(i+768)>>3] |= (t[i] & 1) << shift
+	}
+}
+
+func jhF8(h *[128]byte, block []byte) {
+	for i := 0; i < 64; i++ {
+		h[i] ^= block[i]
+	}
+	jhE8(h)
+	for i := 0; i < 64; i++ {
+		h[i+64] ^= block[i]
+	}
+}
+
+var jhIV = func() (h [128]byte) {
+	binary.BigEndian.PutUint16(h[:], 512)
+	jhF8(&h, make([]byte, 64))
+	return h
+}()
+
+// Jh512 returns the JH-512 digest of data.
+func Jh512(data []byte) [64]byte {
+	h := jhIV
+	length := uint64(len(data))
+
+	for len(data) >= 64 {
+		jhF8(&h, data[:64])
+		data = data[64:]
+	}
+
+	// The padding always spans at least one full block: a one bit, zeros
+	// and the 128 bit message length.
+	var tail [128]byte
+	n := copy(tail[:], data)
+	tail[n] = 0x80
+	size := 64
+	if n > 0 {
+		size = 128
+	}
+	binary.BigEndian.PutUint64(tail[size-8:], length*8)
+	for block := tail[:size]; len(block) > 0; block = block[64:] {
+		jhF8(&h, block[:64])
+	}
+
+	var out [64]byte
+	copy(out[:], h[64:])
+	return out
+}
@@ -0,0 +1,173 @@
+package powhash
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// Luffa-512 (second round version). The state is made of five 256 bit
+// lines of eight words, each stepping through its own permutation.
+
+const luffaLines = 5
+
+var luffaIV = [luffaLines][8]uint32{
+	{0x6d251e69, 0x44b051e0, 0x4eaa6fb4, 0xdbf78465, 0x6e292011, 0x90152df4, 0xee058139, 0xdef610bb},
+	{0xc3b44b95, 0xd9d2f256, 0x70eee9a0, 0xde099fa3, 0x5d9b0557, 0x8fc944b3, 0xcf1ccf0e, 0x746cd581},
+	{0xf7efc89d, 0x5dba5781, 0x04016ce5, 0xad659c05, 0x0306194f, 0x666d1836, 0x24aa230a, 0x8b264ae7},
+	{0x858075d5, 0x36d79cce, 0xe571f7d7, 0x204b1f67, 0x35870c6a, 0x57e9e923, 0x14bcb808, 0x7cde72ce},
+	{0x6c68e9be, 0x5ec41e22, 0xc825b7c7, 0xaffb4363, 0xf5df3999, 0x0fc688f1, 0xb07224cc, 0x03e86cea},
+}
+
+// luffaConstants holds the step constants added to words 0 and 4 of each
+// line.
+var luffaConstants = [luffaLines][2][8]uint32{
+	{
+		{0x303994a6, 0xc0e65299, 0x6cc33a12, 0xdc56983e, 0x1e00108f, 0x7800423d, 0x8f5b7882, 0x96e1db12},
+		{0xe0337818, 0x441ba90d, 0x7f34d442, 0x9389217f, 0xe5a8bce6, 0x5274baf4, 0x26889ba7, 0x9a226e9d},
+	},
+	{
+		{0xb6de10ed, 0x70f47aae, 0x0707a3d4, 0x1c1e8f51, 0x707a3d45, 0xaeb28562, 0xbaca1589, 0x40a46f3e},
+		{0x01685f3d, 0x05a17cf4, 0xbd09caca, 0xf4272b28, 0x144ae5cc, 0xfaa7ae2b, 0x2e48f1c1, 0xb923c704},
+	},
+	{
+		{0xfc20d9d2, 0x34552e25, 0x7ad8818f, 0x8438764a, 0xbb6de032, 0xedb780c8, 0xd9847356, 0xa2c78434},
+		{0xe25e72c1, 0xe623bb72, 0x5c58a4a4, 0x1e38e2e7, 0x78e38b9d, 0x27586719, 0x36eda57f, 0x703aace7},
+	},
+	{
+		{0xb213afa5, 0xc84ebe95, 0x4e608a22, 0x56d858fe, 0x343b138f, 0xd0ec4e3d, 0x2ceb4882, 0xb3ad2208},
+		{0xe028c9bf, 0x44756f91, 0x7e8fce32, 0x956548be, 0xfe191be2, 0x3cb226e5, 0x5944a28e, 0xa1c4c355},
+	},
+	{
+		{0xf0d2e9e3, 0xac11d7fa, 0x1bcb66f2, 0x6f2d9bc9, 0x78602649, 0x8edae952, 0x3b6ba548, 0xedae9520},
+		{0x5090d577, 0x2d1925ab, 0xb46496ac, 0xd1925ab0, 0x29131ab6, 0x0fc053c3, 0x3f014f0c, 0xfc053c31},
+	},
+}
+
+type luffaLine [8]uint32
+
+// double multiplies the line by x modulo x^8 + x^4 + x^3 + x + 1, the
+// coefficients being words.
+func (l luffaLine) double() luffaLine {
+	return luffaLine{l[7], l[0] ^ l[7], l[1], l[2] ^ l[7], l[3] ^ l[7], l[4], l[5], l[6]}
+}
+
+func (l luffaLine) xor(m luffaLine) luffaLine {
+	for i := range l {
+		l[i] ^= m[i]
+	}
+	return l
+}
+
+// luffaInject is the message injection of the five line version.
+func luffaInject(v *[luffaLines]luffaLine, m luffaLine) {
+	a := v[0].xor(v[1]).xor(v[2]).xor(v[3]).xor(v[4]).double()
+	for j := range v {
+		v[j] = v[j].xor(a)
+	}
+
+	b := v[0].double().xor(v[1])
+	v[1] = v[1].double().xor(v[2])
+	v[2] = v[2].double().xor(v[3])
+	v[3] = v[3].double().xor(v[4])
+	v[4] = v[4].double().xor(v[0])
+	v[0] = b.double().xor(v[4])
+	v[4] = v[4].double().xor(v[3])
+	v[3] = v[3].double().xor(v[2])
+	v[2] = v[2].double().xor(v[1])
+	v[1] = v[1].double().xor(b)
+
+	for j := range v {
+		v[j] = v[j].xor(m)
+		m = m.double()
+	}
+}
+
+// luffaSubCrumb is the 4 bit S-box applied in bit slices to four words.
+func luffaSubCrumb(a0, a1, a2, a3 *uint32) {
+	tmp := *a0
+	*a0 |= *a1
+	*a2 ^= *a3
+	*a1 = ^*a1
+	*a0 ^= *a3
+	*a3 &= tmp
+	*a1 ^= *a3
+	*a3 ^= *a2
+	*a2 &= *a0
+	*a0 = ^*a0
+	*a2 ^= *a1
+	*a1 |= *a3
+	tmp ^= *a1
+	*a3 ^= *a2
+	*a2 &= *a1
+	*a1 ^= *a0
+	*a0 = tmp
+}
+
+func luffaMixWord(u, v *uint32) {
+	*v ^= *u
+	*u = bits.RotateLeft32(*u, 2) ^ *v
+	*v = bits.RotateLeft32(*v, 14) ^ *u
+	*u = bits.RotateLeft32(*u, 10) ^ *v
+	*v = bits.RotateLeft32(*v, 1)
+}
+
+// luffaPermute runs the eight steps of the permutation of line j, after the
+// tweak rotating its last four words by j bits.
+func luffaPermute(v *luffaLine, j int) {
+	for i := 4; i < 8; i++ {
+		v[i] = bits.RotateLeft32(v[i], j)
+	}
+
+	for r := 0; r < 8; r++ {
+		luffaSubCrumb(&v[0], &v[1], &v[2], &v[3])
+		luffaSubCrumb(&v[5], &v[6], &v[7], &v[4])
+		for i := 0; i < 4; i++ {
+			luffaMixWord(&v[i], &v[i+4])
+		}
+		v[0] ^= luffaConstants[j][0][r]
+		v[4] ^= luffaConstants[j][1][r]
+	}
+}
+
+func luffaRound(v *[luffaLines]luffaLine, block []byte) {
+	var m luffaLine
+	if block != nil {
+		for i := range m {
+			m[i] = binary.BigEndian.Uint32(block[i*4:])
+		}
+	}
+
+	luffaInject(v, m)
+	for j := range v {
+		luffaPermute(&v[j], j)
+	}
+}
+
+// Luffa512 returns the Luffa-512 digest of data.
+func Luffa512(data []byte) [64]byte {
+	var v [luffaLines]luffaLine
+	for j := range v {
+		v[j] = luffaIV[j]
+	}
+
+	for len(data) >= 32 {
+		luffaRound(&v, data[:32])
+		data = data[32:]
+	}
+
+	var tail [32]byte
+	n := copy(tail[:], data)
+	tail[n] = 0x80
+	luffaRound(&v, tail[:])
+
+	// Each blank round gives 256 bits of the digest.
+	var out [64]byte
+	for half := 0; half < 2; half++ {
+		luffaRound(&v, nil)
+		for i := 0; i < 8; i++ {
+			w := v[0][i] ^ v[1][i] ^ v[2][i] ^ v[3][i] ^ v[4][i]
+			binary.BigEndian.PutUint32(out[half*32+i*4:], w)
+		}
+	}
+	return out
+}
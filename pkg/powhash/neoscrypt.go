@@ -0,0 +1,198 @@
+package powhash
+
+import (
+	"encoding/binary"
+	"math/bits"
+
+	"golang.org/x/crypto/blake2s"
+)
+
+// NeoScrypt with the default profile: FastKDF-BLAKE2s around the ChaCha20/20
+// and Salsa20/20 flavours of the scrypt SMix, N = 128, r = 2 and p = 1.
+
+const (
+	neoscryptN        = 128
+	neoscryptBlocks   = 4 // 2r blocks of 64 bytes
+	neoscryptWords    = neoscryptBlocks * 16
+	fastkdfBufferSize = 256
+	fastkdfKeySize    = 32
+	fastkdfInputSize  = 64
+	fastkdfOutputSize = 32
+	fastkdfIterations = 32
+)
+
+// fastkdf derives output from password and salt, both repeated over the
+// circular buffers the BLAKE2s inputs and keys are read from.
+func fastkdf(password, salt []byte, output []byte) {
+	var a [fastkdfBufferSize + fastkdfInputSize]byte
+	var b [fastkdfBufferSize + fastkdfKeySize]byte
+	for i := 0; i < fastkdfBufferSize; i += copy(a[i:fastkdfBufferSize], password) {
+	}
+	copy(a[fastkdfBufferSize:], password)
+	for i := 0; i < fastkdfBufferSize; i += copy(b[i:fastkdfBufferSize], salt) {
+	}
+	copy(b[fastkdfBufferSize:], salt)
+
+	ptr := 0
+	for i := 0; i < fastkdfIterations; i++ {
+		prf, _ := blake2s.New256(b[ptr : ptr+fastkdfKeySize])
+		prf.Write(a[ptr : ptr+fastkdfInputSize])
+		var out [fastkdfOutputSize]byte
+		prf.Sum(out[:0])
+
+		ptr = 0
+		for _, x := range out {
+			ptr += int(x)
+		}
+		ptr &= fastkdfBufferSize - 1
+
+		for j, x := range out {
+			b[ptr+j] ^= x
+		}
+
+		// Keep the head of the buffer and its copy past the end in sync.
+		if ptr < fastkdfKeySize {
+			copy(b[fastkdfBufferSize+ptr:], b[ptr:fastkdfKeySize])
+		}
+		if fastkdfBufferSize-ptr < fastkdfOutputSize {
+			copy(b[:], b[fastkdfBufferSize:ptr+fastkdfOutputSize])
+		}
+	}
+
+	for i := range output {
+		output[i] = b[(ptr+i)%fastkdfBufferSize] ^ a[i]
+	}
+}
+
+func salsa20Core(x *[16]uint32) {
+	w := *x
+	for i := 0; i < 20; i += 2 {
+		w[4] ^= bits.RotateLeft32(w[0]+w[12], 7)
+		w[8] ^= bits.RotateLeft32(w[4]+w[0], 9)
+		w[12] ^= bits.RotateLeft32(w[8]+w[4], 13)
+		w[0] ^= bits.RotateLeft32(w[12]+w[8], 18)
+		w[9] ^= bits.RotateLeft32(w[5]+w[1], 7)
+		w[13] ^= bits.RotateLeft32(w[9]+w[5], 9)
+		w[1] ^= bits.RotateLeft32(w[13]+w[9], 13)
+		w[5] ^= bits.RotateLeft32(w[1]+w[13], 18)
+		w[14] ^= bits.RotateLeft32(w[10]+w[6], 7)
+		w[2] ^= bits.RotateLeft32(w[14]+w[10], 9)
+		w[6] ^= bits.RotateLeft32(w[2]+w[14], 13)
+		w[10] ^= bits.RotateLeft32(w[6]+w[2], 18)
+		w[3] ^= bits.RotateLeft32(w[15]+w[11], 7)
+		w[7] ^= bits.RotateLeft32(w[3]+w[15], 9)
+		w[11] ^= bits.RotateLeft32(w[7]+w[3], 13)
+		w[15] ^= bits.RotateLeft32(w[11]+w[7], 18)
+
+		w[1] ^= bits.RotateLeft32(w[0]+w[3], 7)
+		w[2] ^= bits.RotateLeft32(w[1]+w[0], 9)
+		w[3] ^= bits.RotateLeft32(w[2]+w[1], 13)
+		w[0] ^= bits.RotateLeft32(w[3]+w[2], 18)
+		w[6] ^= bits.RotateLeft32(w[5]+w[4], 7)
+		w[7] ^= bits.RotateLeft32(w[6]+w[5], 9)
+		w[4] ^= bits.RotateLeft32(w[7]+w[6], 13)
+		w[5] ^= bits.RotateLeft32(w[4]+w[7], 18)
+		w[11] ^= bits.RotateLeft32(w[10]+w[9], 7)
+		w[8] ^= bits.RotateLeft32(w[11]+w[10], 9)
+		w[9] ^= bits.RotateLeft32(w[8]+w[11], 13)
+		w[10] ^= bits.RotateLeft32(w[9]+w[8], 18)
+		w[12] ^= bits.RotateLeft32(w[15]+w[14], 7)
+		w[13] ^= bits.RotateLeft32(w[12]+w[15], 9)
+		w[14] ^= bits.RotateLeft32(w[13]+w[12], 13)
+		w[15] ^= bits.RotateLeft32(w[14]+w[13], 18)
+	}
+	for i := range x {
+		x[i] += w[i]
+	}
+}
+
+func chacha20Core(x *[16]uint32) {
+	w := *x
+	quarter := func(a, b, c, d int) {
+		w[a] += w[b]
+		w[d] = bits.RotateLeft32(w[d]^w[a], 16)
+		w[c] += w[d]
+		w[b] = bits.RotateLeft32(w[b]^w[c], 12)
+		w[a] += w[b]
+		w[d] = bits.RotateLeft32(w[d]^w[a], 8)
+		w[c] += w[d]
+		w[b] = bits.RotateLeft32(w[b]^w[c], 7)
+	}
+	for i := 0; i < 20; i += 2 {
+		quarter(0, 4, 8, 12)
+		quarter(1, 5, 9, 13)
+		quarter(2, 6, 10, 14)
+		quarter(3, 7, 11, 15)
+		quarter(0, 5, 10, 15)
+		quarter(1, 6, 11, 12)
+		quarter(2, 7, 8, 13)
+		quarter(3, 4, 9, 14)
+	}
+	for i := range x {
+		x[i] += w[i]
+	}
+}
+
+type neoscryptBlock [neoscryptBlocks][16]uint32
+
+// mix is the BlockMix of r = 2, every block being mixed with the previous
+// one before the second and third blocks swap places.
+func (x *neoscryptBlock) mix(core func(*[16]uint32)) {
+	prev := neoscryptBlocks - 1
+	for i := range x {
+		for j := range x[i] {
+			x[i][j] ^= x[prev][j]
+		}
+		core(&x[i])
+		prev = i
+	}
+	x[1], x[2] = x[2], x[1]
+}
+
+func (x *neoscryptBlock) xor(y *neoscryptBlock) {
+	for i := range x {
+		for j := range x[i] {
+			x[i][j] ^= y[i][j]
+		}
+	}
+}
+
+// smix is the sequential memory hard mixing of scrypt.
+func (x *neoscryptBlock) smix(core func(*[16]uint32)) {
+	var v [neoscryptN]neoscryptBlock
+	for i := range v {
+		v[i] = *x
+		x.mix(core)
+	}
+	for i := 0; i < neoscryptN; i++ {
+		j := x[neoscryptBlocks-1][0] & (neoscryptN - 1)
+		x.xor(&v[j])
+		x.mix(core)
+	}
+}
+
+// Neoscrypt returns the NeoScrypt hash of data, a block header.
+func Neoscrypt(data []byte) (out [32]byte) {
+	var buf [neoscryptWords * 4]byte
+	fastkdf(data, data, buf[:])
+
+	var x neoscryptBlock
+	for i := range x {
+		for j := range x[i] {
+			x[i][j] = binary.LittleEndian.Uint32(buf[i*64+j*4:])
+		}
+	}
+
+	y := x
+	y.smix(chacha20Core)
+	x.smix(salsa20Core)
+	x.xor(&y)
+
+	for i := range x {
+		for j := range x[i] {
+			binary.LittleEndian.PutUint32(buf[i*64+j*4:], x[i][j])
+		}
+	}
+	fastkdf(data, buf[:], out[:])
+	return out
+}
@@ -0,0 +1,114 @@
+// Package powhash hashes serialized block headers with the algorithms used by
+// the masternode coins, keyed by the pow_algorithm name of a coin conf.
+package powhash
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"golang.org/x/crypto/scrypt"
+)
+
+// DefaultAlgorithm is used when a coin does not name its algorithm.
+const DefaultAlgorithm = "sha256d"
+
+var ErrUnknownAlgorithm = errors.New("powhash: unknown algorithm")
+
+// Func hashes a serialized block header.
+type Func func(header []byte) chainhash.Hash
+
+// Algorithm describes how a coin hashes its block headers. Most coins
+// identify blocks by their proof of work hash, scrypt coins keep double
+// SHA256 identifiers and only use scrypt for the proof of work. NeoScrypt
+// follows the masternode coins forked from Dash, which hash their block
+// identifiers with it as well.
+type Algorithm struct {
+	Name string
+
+	// BlockHash computes the identifier used by inventories and by the
+	// previous block field of the next header.
+	BlockHash Func
+
+	// PowHash computes the hash compared against the difficulty target.
+	PowHash Func
+}
+
+var (
+	mutex      sync.RWMutex
+	algorithms = make(map[string]Algorithm)
+)
+
+func init() {
+	Register(Algorithm{Name: "sha256d", BlockHash: sha256d, PowHash: sha256d})
+	Register(Algorithm{Name: "scrypt", BlockHash: sha256d, PowHash: scryptHash})
+	Register(Algorithm{Name: "quark", BlockHash: quarkHash, PowHash: quarkHash})
+	Register(Algorithm{Name: "x11", BlockHash: x11Hash, PowHash: x11Hash})
+	Register(Algorithm{Name: "neoscrypt", BlockHash: neoscryptHash, PowHash: neoscryptHash})
+}
+
+// Register adds an algorithm, replacing any algorithm of the same name.
+// Names are case insensitive.
+func Register(algorithm Algorithm) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	algorithms[strings.ToLower(algorithm.Name)] = algorithm
+}
+
+// Lookup returns the algorithm registered under name, an empty name selects
+// DefaultAlgorithm.
+func Lookup(name string) (Algorithm, error) {
+	if name == "" {
+		name = DefaultAlgorithm
+	}
+
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	algorithm, ok := algorithms[strings.ToLower(name)]
+	if !ok {
+		return Algorithm{}, ErrUnknownAlgorithm
+	}
+	return algorithm, nil
+}
+
+// Names returns the sorted names of the registered algorithms.
+func Names() []string {
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	names := make([]string, 0, len(algorithms))
+	for name := range algorithms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sha256d(header []byte) chainhash.Hash {
+	return chainhash.DoubleHashH(header)
+}
+
+func scryptHash(header []byte) chainhash.Hash {
+	var hash chainhash.Hash
+
+	// scrypt(N=1024, r=1, p=1) only fails on invalid parameters.
+	key, _ := scrypt.Key(header, header, 1024, 1, 1, chainhash.HashSize)
+	copy(hash[:], key)
+	return hash
+}
+
+func quarkHash(header []byte) chainhash.Hash {
+	return chainhash.Hash(Quark(header))
+}
+
+func x11Hash(header []byte) chainhash.Hash {
+	return chainhash.Hash(X11(header))
+}
+
+func neoscryptHash(header []byte) chainhash.Hash {
+	return chainhash.Hash(Neoscrypt(header))
+}
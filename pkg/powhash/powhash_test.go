@@ -0,0 +1,157 @@
+package powhash
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"math/big"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// mainnetHeader is a block of a mainnet chain, its hash as shown by the
+// explorers.
+type mainnetHeader struct {
+	coin       string
+	algorithm  string
+	version    int32
+	prevBlock  string
+	merkleRoot string
+	timestamp  uint32
+	bits       uint32
+	nonce      uint32
+	hash       string
+}
+
+var mainnetHeaders = []mainnetHeader{
+	{
+		coin:       "Bitcoin genesis",
+		algorithm:  "sha256d",
+		version:    1,
+		merkleRoot: "4a5e1e4baab89f3a32518a88c31bc87f618f76673e2cc77ab2127b7afdeda33b",
+		timestamp:  1231006505,
+		bits:       0x1d00ffff,
+		nonce:      2083236893,
+		hash:       "000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f",
+	},
+	{
+		coin:       "Bitcoin block 1",
+		algorithm:  "sha256d",
+		version:    1,
+		prevBlock:  "000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f",
+		merkleRoot: "0e3e2357e806b6cdb1f70b54c3a3a17b6714ee1f0e68bebb44a74b1efd512098",
+		timestamp:  1231469665,
+		bits:       0x1d00ffff,
+		nonce:      2573394689,
+		hash:       "00000000839a8e6886ab5951d76f411475428afc90947ee320161bbf18eb6048",
+	},
+	{
+		coin:       "Litecoin genesis",
+		algorithm:  "scrypt",
+		version:    1,
+		merkleRoot: "97ddfbbae6be97fd6cdf3e7ca13232a3afff2353e29badfab7f73011edd4ced9",
+		timestamp:  1317972665,
+		bits:       0x1e0ffff0,
+		nonce:      2084524493,
+		hash:       "12a765e31ffd4059bada1e25190f6e98c99d9714d334efa41a195a7e7e04bfe2",
+	},
+	{
+		coin:       "PIVX genesis",
+		algorithm:  "quark",
+		version:    1,
+		merkleRoot: "1b2ef6e2f28be914103a277377ae7729dcd125dfeb8bf97bd5964ba72b6dc39b",
+		timestamp:  1454124731,
+		bits:       0x1e0ffff0,
+		nonce:      2402015,
+		hash:       "0000041e482b9b9691d98eefb48473405c0b8ec31b76df3797c74a78680ef818",
+	},
+	{
+		coin:       "Dash genesis",
+		algorithm:  "x11",
+		version:    1,
+		merkleRoot: "e0028eb9648db56b1ac77cf090b99048a8007e2bb64b68f092c03c7f56a662c7",
+		timestamp:  1390095618,
+		bits:       0x1e0ffff0,
+		nonce:      28917698,
+		hash:       "00000ffd590b1485b3caadc19b22e6379c733355108f107a430458cdf3407ab6",
+	},
+}
+
+func (h mainnetHeader) serialize(t *testing.T) []byte {
+	header := make([]byte, 80)
+	binary.LittleEndian.PutUint32(header[0:], uint32(h.version))
+	for offset, field := range map[int]string{4: h.prevBlock, 36: h.merkleRoot} {
+		if field == "" {
+			continue
+		}
+		hash, err := chainhash.NewHashFromStr(field)
+		if err != nil {
+			t.Fatal(err)
+		}
+		copy(header[offset:], hash[:])
+	}
+	binary.LittleEndian.PutUint32(header[68:], h.timestamp)
+	binary.LittleEndian.PutUint32(header[72:], h.bits)
+	binary.LittleEndian.PutUint32(header[76:], h.nonce)
+	return header
+}
+
+// meetsTarget reports whether the hash, read as a little endian number, is
+// at most the compact target.
+func meetsTarget(hash chainhash.Hash, bits uint32) bool {
+	target := new(big.Int).SetUint64(uint64(bits & 0x007fffff))
+	if exponent := uint(bits >> 24); exponent <= 3 {
+		target.Rsh(target, 8*(3-exponent))
+	} else {
+		target.Lsh(target, 8*(exponent-3))
+	}
+
+	var reversed [chainhash.HashSize]byte
+	for i, b := range hash {
+		reversed[chainhash.HashSize-1-i] = b
+	}
+	return new(big.Int).SetBytes(reversed[:]).Cmp(target) <= 0
+}
+
+func TestMainnetHeaders(t *testing.T) {
+	for _, h := range mainnetHeaders {
+		algorithm, err := Lookup(h.algorithm)
+		if err != nil {
+			t.Fatalf("%s: %v", h.coin, err)
+		}
+
+		header := h.serialize(t)
+		if hash := algorithm.BlockHash(header); hash.String() != h.hash {
+			t.Errorf("%s: block hash %s, want %s", h.coin, hash, h.hash)
+		}
+		if hash := algorithm.PowHash(header); !meetsTarget(hash, h.bits) {
+			t.Errorf("%s: proof of work hash %s above the target %08x", h.coin, hash, h.bits)
+		}
+	}
+}
+
+// TestNeoscrypt checks the test vector of the NeoScrypt reference
+// implementation, the hash of the bytes 0 to 79.
+func TestNeoscrypt(t *testing.T) {
+	input := make([]byte, 80)
+	for i := range input {
+		input[i] = byte(i)
+	}
+
+	want := "7258961afb33fd12d00cacb8d63f4f4f52bb6917043865dd24a08f578853122d"
+	if hash := Neoscrypt(input); hex.EncodeToString(hash[:]) != want {
+		t.Errorf("neoscrypt %x, want %s", hash, want)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	if algorithm, err := Lookup(""); err != nil || algorithm.Name != DefaultAlgorithm {
+		t.Errorf("empty name gave %q, %v", algorithm.Name, err)
+	}
+	if _, err := Lookup("X11"); err != nil {
+		t.Errorf("names should be case insensitive: %v", err)
+	}
+	if _, err := Lookup("lyra2z"); err != ErrUnknownAlgorithm {
+		t.Errorf("unknown algorithm gave %v", err)
+	}
+}
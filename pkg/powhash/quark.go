@@ -0,0 +1,39 @@
+package powhash
+
+import "golang.org/x/crypto/sha3"
+
+func keccak512(data []byte) (out [64]byte) {
+	h := sha3.NewLegacyKeccak512()
+	h.Write(data)
+	h.Sum(out[:0])
+	return out
+}
+
+// Quark chains nine rounds of six SHA-3 candidates, three of them picking
+// the next function from bit 3 of the previous digest, and keeps the first
+// 256 bits.
+func Quark(data []byte) (out [32]byte) {
+	h := Blake512(data)
+	h = Bmw512(h[:])
+	if h[0]&8 != 0 {
+		h = Groestl512(h[:])
+	} else {
+		h = Skein512(h[:])
+	}
+	h = Groestl512(h[:])
+	h = Jh512(h[:])
+	if h[0]&8 != 0 {
+		h = Blake512(h[:])
+	} else {
+		h = Bmw512(h[:])
+	}
+	h = keccak512(h[:])
+	h = Skein512(h[:])
+	if h[0]&8 != 0 {
+		h = keccak512(h[:])
+	} else {
+		h = Jh512(h[:])
+	}
+	copy(out[:], h[:])
+	return out
+}
@@ -0,0 +1,150 @@
+package powhash
+
+import "encoding/binary"
+
+// SHAvite-3-512 (second round tweak, 14 rounds, no salt). The chaining
+// value is four 128 bit words mixed by a Feistel network of AES rounds.
+
+var shaviteIV = [16]uint32{
+	0x72fccdd8, 0x79ca4727, 0x128a077b, 0x40d55aec, 0xd1901a06, 0x430ae307, 0xb29f5cd1, 0xdf07fbfc,
+	0x8e45d73d, 0x681ab538, 0xbde86578, 0xdd577e47, 0xe275eade, 0x502d9fcd, 0xb9357178, 0x022a4b9a,
+}
+
+// shaviteAES runs a keyless AES round on four little endian words.
+func shaviteAES(x *[4]uint32) {
+	var b aesBlock
+	for i, w := range x {
+		binary.LittleEndian.PutUint32(b[i*4:], w)
+	}
+	aesRound(&b, &aesBlock{})
+	for i := range x {
+		x[i] = binary.LittleEndian.Uint32(b[i*4:])
+	}
+}
+
+// shaviteExpand derives the 448 round key words from the message block, the
+// bit counter being mixed in four times.
+func shaviteExpand(block []byte, counter [4]uint32) (rk [448]uint32) {
+	for i := 0; i < 32; i++ {
+		rk[i] = binary.LittleEndian.Uint32(block[i*4:])
+	}
+
+	nonLinear := func(u int) {
+		x := [4]uint32{rk[u-31], rk[u-30], rk[u-29], rk[u-32]}
+		shaviteAES(&x)
+		for i := range x {
+			rk[u+i] = x[i] ^ rk[u-4+i]
+		}
+
+		var c [4]uint32
+		switch u {
+		case 32:
+			c = [4]uint32{counter[0], counter[1], counter[2], ^counter[3]}
+		case 164:
+			c = [4]uint32{counter[3], counter[2], counter[1], ^counter[0]}
+		case 316:
+			c = [4]uint32{counter[2], counter[3], counter[0], ^counter[1]}
+		case 440:
+			c = [4]uint32{counter[1], counter[0], counter[3], ^counter[2]}
+		default:
+			return
+		}
+		for i := range c {
+			rk[u+i] ^= c[i]
+		}
+	}
+
+	u := 32
+	for {
+		for s := 0; s < 8; s++ {
+			nonLinear(u)
+			u += 4
+		}
+		if u == len(rk) {
+			return rk
+		}
+
+		for s := 0; s < 8; s++ {
+			for i := 0; i < 4; i++ {
+				rk[u+i] = rk[u-32+i] ^ rk[u-7+i]
+			}
+			u += 4
+		}
+	}
+}
+
+func shaviteCompress(h *[16]uint32, block []byte, counter [4]uint32) {
+	rk := shaviteExpand(block, counter)
+
+	p := *h
+	u := 0
+
+	// f xors four keyed AES rounds of the words at src into the ones at dst.
+	f := func(dst, src int) {
+		var x [4]uint32
+		copy(x[:], p[src:src+4])
+		for round := 0; round < 4; round++ {
+			for i := range x {
+				x[i] ^= rk[u]
+				u++
+			}
+			shaviteAES(&x)
+		}
+		for i := range x {
+			p[dst+i] ^= x[i]
+		}
+	}
+
+	for r := 0; r < 14; r++ {
+		f(0, 4)
+		f(8, 12)
+
+		// The 128 bit words rotate by one position.
+		var t [4]uint32
+		copy(t[:], p[12:16])
+		copy(p[4:16], p[0:12])
+		copy(p[0:4], t[:])
+	}
+
+	for i := range h {
+		h[i] ^= p[i]
+	}
+}
+
+// Shavite512 returns the SHAvite-3-512 digest of data.
+func Shavite512(data []byte) [64]byte {
+	h := shaviteIV
+	length := uint64(len(data)) * 8
+
+	var counter [4]uint32
+	processed := uint64(0)
+	for len(data) >= 128 {
+		processed += 1024
+		counter[0], counter[1] = uint32(processed), uint32(processed>>32)
+		shaviteCompress(&h, data[:128], counter)
+		data = data[128:]
+	}
+
+	// The counter of a block holding no message bits is zero, the length
+	// and the digest size close the last block.
+	var tail [128]byte
+	n := copy(tail[:], data)
+	tail[n] = 0x80
+	counter[0], counter[1] = uint32(length), uint32(length>>32)
+	if n == 0 {
+		counter = [4]uint32{}
+	} else if n >= 110 {
+		shaviteCompress(&h, tail[:], counter)
+		tail = [128]byte{}
+		counter = [4]uint32{}
+	}
+	binary.LittleEndian.PutUint64(tail[110:], length)
+	binary.LittleEndian.PutUint16(tail[126:], 512)
+	shaviteCompress(&h, tail[:], counter)
+
+	var out [64]byte
+	for i, w := range h {
+		binary.LittleEndian.PutUint32(out[i*4:], w)
+	}
+	return out
+}
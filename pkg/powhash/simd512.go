@@ -0,0 +1,182 @@
+package powhash
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// SIMD-512 (version 1.1). The message block is expanded by a number
+// theoretic transform over Z/257 and fed to four parallel lines of a
+// Feistel like compression, each line made of eight words.
+
+var simdIV = [32]uint32{
+	0x0ba16b95, 0x72f999ad, 0x9fecc2ae, 0xba3264fc, 0x5e894929, 0x8e9f30e5, 0x2f1daa37, 0xf0f2c558,
+	0xac506643, 0xa90635a5, 0xe25b878b, 0xaab7878f, 0x88817f7a, 0x0a02892b, 0x559a7550, 0x598f657e,
+	0x7eef60a1, 0x6b70e3e8, 0x9c1714d1, 0xb958e2a8, 0xab02675e, 0xed1c014f, 0xcd8d65bb, 0xfdb7a257,
+	0x09254899, 0xd699c7bc, 0x9019b6dc, 0x2b9022e4, 0x8fa14956, 0x21bf9bd3, 0xb94d0943, 0x6ffddc22,
+}
+
+// simdPowers holds the powers of 41, a 256th root of unity modulo 257.
+var simdPowers = func() (p [256]int32) {
+	p[0] = 1
+	for i := 1; i < len(p); i++ {
+		p[i] = p[i-1] * 41 % 257
+	}
+	return p
+}()
+
+// simdExpand computes the transform of the block, the message polynomial
+// being completed by X^255, and X^253 for the last block, and centers the
+// values around zero.
+func simdExpand(block []byte, final bool) (y [256]int32) {
+	for i := range y {
+		var sum int32
+		for j := 0; j < 128; j++ {
+			sum = (sum + int32(block[j])*simdPowers[i*j%256]) % 257
+		}
+		sum += simdPowers[i*255%256]
+		if final {
+			sum += simdPowers[i*253%256]
+		}
+		sum %= 257
+		if sum > 128 {
+			sum -= 257
+		}
+		y[i] = sum
+	}
+	return y
+}
+
+// simdWordSources tells which transform outputs make the message words of
+// each step: the 16 bit halves of word k are built from the values at
+// offsets a and b plus 16*source+2*k, multiplied by factor.
+var simdWordSources = [32]struct {
+	source int
+	a, b   int
+	factor int32
+}{
+	{4, 0, 1, 185}, {6, 0, 1, 185}, {0, 0, 1, 185}, {2, 0, 1, 185},
+	{7, 0, 1, 185}, {5, 0, 1, 185}, {3, 0, 1, 185}, {1, 0, 1, 185},
+	{15, 0, 1, 185}, {11, 0, 1, 185}, {12, 0, 1, 185}, {8, 0, 1, 185},
+	{9, 0, 1, 185}, {13, 0, 1, 185}, {10, 0, 1, 185}, {14, 0, 1, 185},
+	{17, -256, -128, 233}, {18, -256, -128, 233}, {23, -256, -128, 233}, {20, -256, -128, 233},
+	{22, -256, -128, 233}, {21, -256, -128, 233}, {16, -256, -128, 233}, {19, -256, -128, 233},
+	{30, -383, -255, 233}, {24, -383, -255, 233}, {25, -383, -255, 233}, {31, -383, -255, 233},
+	{27, -383, -255, 233}, {29, -383, -255, 233}, {28, -383, -255, 233}, {26, -383, -255, 233},
+}
+
+// simdRotations holds the rotations of each round, step k of a round using
+// the pair starting at k%4.
+var simdRotations = [4][4]int{
+	{3, 23, 17, 27},
+	{28, 19, 22, 7},
+	{29, 9, 15, 5},
+	{4, 13, 10, 25},
+}
+
+// simdPermutations gives the line whose rotated word ends each step, step i
+// using the line n^simdPermutations[i%7].
+var simdPermutations = [7]int{1, 6, 2, 3, 5, 7, 4}
+
+type simdState struct {
+	a, b, c, d [8]uint32
+}
+
+func simdIf(x, y, z uint32) uint32 {
+	return (y^z)&x ^ z
+}
+
+func simdMaj(x, y, z uint32) uint32 {
+	return x&y | (x|y)&z
+}
+
+func (s *simdState) step(w *[8]uint32, f func(x, y, z uint32) uint32, r, rs int, i int) {
+	var ta [8]uint32
+	for n := range ta {
+		ta[n] = bits.RotateLeft32(s.a[n], r)
+	}
+
+	p := simdPermutations[i%7]
+	for n := 0; n < 8; n++ {
+		tt := s.d[n] + w[n] + f(s.a[n], s.b[n], s.c[n])
+		s.a[n] = bits.RotateLeft32(tt, rs) + ta[n^p]
+		s.d[n] = s.c[n]
+		s.c[n] = s.b[n]
+		s.b[n] = ta[n]
+	}
+}
+
+func simdCompress(h *[32]uint32, block []byte, final bool) {
+	y := simdExpand(block, final)
+
+	var w [32][8]uint32
+	for i, src := range simdWordSources {
+		for k := 0; k < 8; k++ {
+			lo := y[16*src.source+2*k+src.a] * src.factor
+			hi := y[16*src.source+2*k+src.b] * src.factor
+			w[i][k] = uint32(lo)&0xffff + uint32(hi)<<16
+		}
+	}
+
+	var s simdState
+	for n := 0; n < 8; n++ {
+		s.a[n] = h[n] ^ binary.LittleEndian.Uint32(block[n*4:])
+		s.b[n] = h[8+n] ^ binary.LittleEndian.Uint32(block[32+n*4:])
+		s.c[n] = h[16+n] ^ binary.LittleEndian.Uint32(block[64+n*4:])
+		s.d[n] = h[24+n] ^ binary.LittleEndian.Uint32(block[96+n*4:])
+	}
+
+	for round := 0; round < 4; round++ {
+		rot := &simdRotations[round]
+		for k := 0; k < 8; k++ {
+			f := simdIf
+			if k >= 4 {
+				f = simdMaj
+			}
+			s.step(&w[8*round+k], f, rot[k%4], rot[(k+1)%4], 8*round+k)
+		}
+	}
+
+	// The chaining value is fed forward through four more steps.
+	var iv [4][8]uint32
+	for n := range iv {
+		copy(iv[n][:], h[8*n:8*n+8])
+	}
+	s.step(&iv[0], simdIf, 4, 13, 32)
+	s.step(&iv[1], simdIf, 13, 10, 33)
+	s.step(&iv[2], simdIf, 10, 25, 34)
+	s.step(&iv[3], simdIf, 25, 4, 35)
+
+	copy(h[0:8], s.a[:])
+	copy(h[8:16], s.b[:])
+	copy(h[16:24], s.c[:])
+	copy(h[24:32], s.d[:])
+}
+
+// Simd512 returns the SIMD-512 digest of data.
+func Simd512(data []byte) [64]byte {
+	h := simdIV
+	length := uint64(len(data)) * 8
+
+	for len(data) >= 128 {
+		simdCompress(&h, data[:128], false)
+		data = data[128:]
+	}
+
+	// The last message bytes are padded with zeros, the length goes in a
+	// block of its own.
+	var tail [128]byte
+	if len(data) > 0 {
+		copy(tail[:], data)
+		simdCompress(&h, tail[:], false)
+		tail = [128]byte{}
+	}
+	binary.LittleEndian.PutUint64(tail[:], length)
+	simdCompress(&h, tail[:], true)
+
+	var out [64]byte
+	for i := 0; i < 16; i++ {
+		binary.LittleEndian.PutUint32(out[i*4:], h[i])
+	}
+	return out
+}
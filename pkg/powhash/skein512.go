@@ -0,0 +1,126 @@
+package powhash
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// Skein-512-512 (version 1.3) built on Threefish-512 and UBI chaining.
+
+const (
+	skeinTypeConfig  = 4
+	skeinTypeMessage = 48
+	skeinTypeOutput  = 63
+
+	skeinKeyParity = 0x1bd11bdaa9fc1a22
+)
+
+var threefishRotations = [8][4]int{
+	{46, 36, 19, 37},
+	{33, 27, 14, 42},
+	{17, 49, 36, 39},
+	{44, 9, 54, 56},
+	{39, 30, 34, 24},
+	{13, 50, 10, 17},
+	{25, 29, 39, 43},
+	{8, 35, 56, 22},
+}
+
+// threefishPairs lists the word pairs mixed by each of the four rounds
+// between key injections, with the word permutation folded in.
+var threefishPairs = [4][4][2]int{
+	{{0, 1}, {2, 3}, {4, 5}, {6, 7}},
+	{{2, 1}, {4, 7}, {6, 5}, {0, 3}},
+	{{4, 1}, {6, 3}, {0, 5}, {2, 7}},
+	{{6, 1}, {0, 7}, {2, 5}, {4, 3}},
+}
+
+func threefish512(key *[8]uint64, tweak [2]uint64, x *[8]uint64) {
+	var k [9]uint64
+	copy(k[:], key[:])
+	k[8] = skeinKeyParity
+	for _, w := range key {
+		k[8] ^= w
+	}
+	t := [3]uint64{tweak[0], tweak[1], tweak[0] ^ tweak[1]}
+
+	inject := func(s int) {
+		for i := range x {
+			x[i] += k[(s+i)%9]
+		}
+		x[5] += t[s%3]
+		x[6] += t[(s+1)%3]
+		x[7] += uint64(s)
+	}
+
+	inject(0)
+	for d := 0; d < 72; d++ {
+		for p, pair := range threefishPairs[d%4] {
+			a, b := pair[0], pair[1]
+			x[a] += x[b]
+			x[b] = bits.RotateLeft64(x[b], threefishRotations[d%8][p]) ^ x[a]
+		}
+		if d%4 == 3 {
+			inject(d/4 + 1)
+		}
+	}
+}
+
+// skeinUBI chains one 64 byte block into h.
+func skeinUBI(h *[8]uint64, block []byte, position uint64, blockType uint64, first, final bool) {
+	var m, x [8]uint64
+	for i := range m {
+		m[i] = binary.LittleEndian.Uint64(block[i*8:])
+	}
+	x = m
+
+	tweak := [2]uint64{position, blockType << 56}
+	if first {
+		tweak[1] |= 1 << 62
+	}
+	if final {
+		tweak[1] |= 1 << 63
+	}
+	threefish512(h, tweak, &x)
+
+	for i := range h {
+		h[i] = x[i] ^ m[i]
+	}
+}
+
+var skeinIV = func() (h [8]uint64) {
+	var config [64]byte
+	copy(config[:], "SHA3")
+	binary.LittleEndian.PutUint16(config[4:], 1)
+	binary.LittleEndian.PutUint64(config[8:], 512)
+	skeinUBI(&h, config[:], 32, skeinTypeConfig, true, true)
+	return h
+}()
+
+// Skein512 returns the Skein-512-512 digest of data.
+func Skein512(data []byte) [64]byte {
+	h := skeinIV
+
+	position := uint64(0)
+	first := true
+	for len(data) > 64 {
+		position += 64
+		skeinUBI(&h, data[:64], position, skeinTypeMessage, first, false)
+		data = data[64:]
+		first = false
+	}
+
+	var block [64]byte
+	copy(block[:], data)
+	position += uint64(len(data))
+	skeinUBI(&h, block[:], position, skeinTypeMessage, first, true)
+
+	var counter [64]byte
+	skeinUBI(&h, counter[:], 8, skeinTypeOutput, true, true)
+
+	var out [64]byte
+	for i, w := range h {
+		binary.LittleEndian.PutUint64(out[i*8:], w)
+	}
+	return out
+}
@@ -0,0 +1,18 @@
+package powhash
+
+// X11 chains eleven SHA-3 candidates and keeps the first 256 bits.
+func X11(data []byte) (out [32]byte) {
+	h := Blake512(data)
+	h = Bmw512(h[:])
+	h = Groestl512(h[:])
+	h = Skein512(h[:])
+	h = Jh512(h[:])
+	h = keccak512(h[:])
+	h = Luffa512(h[:])
+	h = Cubehash512(h[:])
+	h = Shavite512(h[:])
+	h = Simd512(h[:])
+	h = Echo512(h[:])
+	copy(out[:], h[:])
+	return out
+}
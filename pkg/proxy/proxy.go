@@ -0,0 +1,375 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Dialer opens the connections to the peers, either directly or through a
+// proxy.
+type Dialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// Direct returns a dialer connecting without a proxy.
+func Direct(timeout time.Duration) Dialer {
+	return &net.Dialer{Timeout: timeout}
+}
+
+// None disables the proxy, i.e. for a coin when a global proxy is set.
+const None = "none"
+
+// Parse validates a proxy given as socks5://[user:password@]host:port or
+// http://[user:password@]host:port. A bare host:port is a SOCKS5 proxy.
+func Parse(spec string) (*url.URL, error) {
+	if !strings.Contains(spec, "://") {
+		spec = "socks5://" + spec
+	}
+
+	proxyURL, err := url.Parse(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy %q: %v", Redact(spec), err)
+	}
+
+	switch proxyURL.Scheme {
+	case "socks5", "socks5h", "http":
+	default:
+		return nil, fmt.Errorf("invalid proxy %q: unsupported scheme %s, use socks5 or http", Redact(spec), proxyURL.Scheme)
+	}
+
+	if _, _, err := net.SplitHostPort(proxyURL.Host); err != nil {
+		return nil, fmt.Errorf("invalid proxy address %q: %v", proxyURL.Host, err)
+	}
+
+	return proxyURL, nil
+}
+
+// Redact hides the password of a proxy so it can be logged.
+func Redact(spec string) string {
+	proxyURL, err := url.Parse(spec)
+	if err != nil || proxyURL.User == nil {
+		return spec
+	}
+	return proxyURL.Redacted()
+}
+
+// New returns the dialer of the proxy, a direct dialer when spec is empty or
+// None. The timeout applies to the connection and the proxy negotiation.
+func New(spec string, timeout time.Duration) (Dialer, error) {
+	if spec == "" || spec == None {
+		return Direct(timeout), nil
+	}
+
+	proxyURL, err := Parse(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	username := proxyURL.User.Username()
+	password, _ := proxyURL.User.Password()
+
+	if proxyURL.Scheme == "http" {
+		return &HTTPConnect{Address: proxyURL.Host, Username: username, Password: password, Timeout: timeout}, nil
+	}
+
+	return &SOCKS5{Address: proxyURL.Host, Username: username, Password: password, Timeout: timeout}, nil
+}
+
+// HTTPClient returns a client sending its requests through the proxy. The
+// timeout bounds the connection, the response headers and the whole request.
+func HTTPClient(spec string, timeout time.Duration) (*http.Client, error) {
+	transport := &http.Transport{
+		TLSHandshakeTimeout:   timeout,
+		ResponseHeaderTimeout: timeout,
+		IdleConnTimeout:       90 * time.Second,
+		MaxIdleConns:          10,
+	}
+
+	if spec == "" || spec == None {
+		transport.DialContext = Direct(timeout).DialContext
+		return &http.Client{Transport: transport, Timeout: timeout}, nil
+	}
+
+	proxyURL, err := Parse(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	if proxyURL.Scheme == "http" {
+		//plain requests are forwarded, the https ones tunneled with CONNECT
+		transport.Proxy = http.ProxyURL(proxyURL)
+		transport.DialContext = Direct(timeout).DialContext
+	} else {
+		dialer, _ := New(spec, timeout)
+		transport.DialContext = dialer.DialContext
+	}
+
+	return &http.Client{Transport: transport, Timeout: timeout}, nil
+}
+
+// SOCKS5 dials through a SOCKS5 proxy such as the one of a local Tor daemon.
+// Host names, .onion names included, are resolved by the proxy.
+type SOCKS5 struct {
+	Address  string
+	Username string
+	Password string
+	Timeout  time.Duration
+}
+
+// SOCKS5 protocol values, see RFC 1928.
+const (
+	socksVersion   = 5
+	socksNoAuth    = 0
+	socksPassword  = 2
+	socksConnect   = 1
+	socksIPv4      = 1
+	socksDomain    = 3
+	socksIPv6      = 4
+	socksSucceeded = 0
+)
+
+var socksReplies = map[byte]string{
+	1: "general SOCKS server failure",
+	2: "connection not allowed by ruleset",
+	3: "network unreachable",
+	4: "host unreachable",
+	5: "connection refused",
+	6: "TTL expired",
+	7: "command not supported",
+	8: "address type not supported",
+}
+
+// ErrProxyAuth is returned when the proxy requires an authentication method
+// we do not offer.
+var ErrProxyAuth = errors.New("proxy: no acceptable authentication method")
+
+// ErrProxyCredentials is returned when the proxy rejects the credentials.
+var ErrProxyCredentials = errors.New("proxy: authentication failed")
+
+// DialContext connects to address through the proxy.
+func (s *SOCKS5) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, portString, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	port, err := strconv.ParseUint(portString, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q", portString)
+	}
+
+	dialer := net.Dialer{Timeout: s.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", s.Address)
+	if err != nil {
+		return nil, fmt.Errorf("proxy %s: %v", s.Address, err)
+	}
+
+	//the whole negotiation shares the dial timeout
+	if s.Timeout > 0 {
+		conn.SetDeadline(time.Now().Add(s.Timeout))
+	}
+
+	err = s.connect(conn, host, uint16(port))
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s: %s: %v", s.Address, address, err)
+	}
+
+	conn.SetDeadline(time.Time{})
+
+	return conn, nil
+}
+
+func (s *SOCKS5) connect(conn net.Conn, host string, port uint16) error {
+	methods := []byte{socksVersion, 1, socksNoAuth}
+	if s.Username != "" {
+		methods = []byte{socksVersion, 2, socksNoAuth, socksPassword}
+	}
+
+	_, err := conn.Write(methods)
+	if err != nil {
+		return err
+	}
+
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[0] != socksVersion {
+		return fmt.Errorf("unexpected SOCKS version %d", reply[0])
+	}
+
+	switch {
+	case reply[1] == socksNoAuth:
+	case reply[1] == socksPassword && s.Username != "":
+		if err := s.authenticate(conn); err != nil {
+			return err
+		}
+	default:
+		return ErrProxyAuth
+	}
+
+	request := []byte{socksVersion, socksConnect, 0}
+	if ip := net.ParseIP(host); ip == nil {
+		if len(host) > 255 {
+			return fmt.Errorf("host name too long")
+		}
+		request = append(request, socksDomain, byte(len(host)))
+		request = append(request, host...)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		request = append(request, socksIPv4)
+		request = append(request, ip4...)
+	} else {
+		request = append(request, socksIPv6)
+		request = append(request, ip.To16()...)
+	}
+	request = binary.BigEndian.AppendUint16(request, port)
+
+	if _, err := conn.Write(request); err != nil {
+		return err
+	}
+
+	//version, reply, reserved, address type
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return err
+	}
+	if header[1] != socksSucceeded {
+		if message, ok := socksReplies[header[1]]; ok {
+			return errors.New(message)
+		}
+		return fmt.Errorf("unknown SOCKS reply %d", header[1])
+	}
+
+	//skip the bound address and port
+	var skip int
+	switch header[3] {
+	case socksIPv4:
+		skip = net.IPv4len + 2
+	case socksIPv6:
+		skip = net.IPv6len + 2
+	case socksDomain:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return err
+		}
+		skip = int(length[0]) + 2
+	default:
+		return fmt.Errorf("unknown SOCKS address type %d", header[3])
+	}
+
+	_, err = io.ReadFull(conn, make([]byte, skip))
+	return err
+}
+
+// authenticate sends the username and password, see RFC 1929.
+func (s *SOCKS5) authenticate(conn net.Conn) error {
+	if len(s.Username) > 255 || len(s.Password) > 255 {
+		return fmt.Errorf("username or password too long")
+	}
+
+	request := []byte{1, byte(len(s.Username))}
+	request = append(request, s.Username...)
+	request = append(request, byte(len(s.Password)))
+	request = append(request, s.Password...)
+
+	if _, err := conn.Write(request); err != nil {
+		return err
+	}
+
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[1] != 0 {
+		return ErrProxyCredentials
+	}
+
+	return nil
+}
+
+// HTTPConnect dials through an HTTP proxy with the CONNECT method.
+type HTTPConnect struct {
+	Address  string
+	Username string
+	Password string
+	Timeout  time.Duration
+}
+
+// DialContext connects to address through the proxy.
+func (h *HTTPConnect) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	dialer := net.Dialer{Timeout: h.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", h.Address)
+	if err != nil {
+		return nil, fmt.Errorf("proxy %s: %v", h.Address, err)
+	}
+
+	if h.Timeout > 0 {
+		conn.SetDeadline(time.Now().Add(h.Timeout))
+	}
+
+	request := "CONNECT " + address + " HTTP/1.1\r\nHost: " + address + "\r\n"
+	if h.Username != "" {
+		credentials := base64.StdEncoding.EncodeToString([]byte(h.Username + ":" + h.Password))
+		request += "Proxy-Authorization: Basic " + credentials + "\r\n"
+	}
+	request += "\r\n"
+
+	if _, err := io.WriteString(conn, request); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s: %v", h.Address, err)
+	}
+
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, &http.Request{Method: http.MethodConnect})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s: %v", h.Address, err)
+	}
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		conn.Close()
+		if response.StatusCode == http.StatusProxyAuthRequired {
+			return nil, fmt.Errorf("proxy %s: %s: %v", h.Address, address, ErrProxyCredentials)
+		}
+		return nil, fmt.Errorf("proxy %s: %s: %s", h.Address, address, response.Status)
+	}
+
+	conn.SetDeadline(time.Time{})
+
+	//the peer may have spoken before we read the whole response
+	if reader.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, reader: reader}, nil
+	}
+
+	return conn, nil
+}
+
+// bufferedConn reads the bytes buffered while reading the proxy response
+// before reading from the connection.
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+// IsOnion reports whether host is a Tor .onion name, they can only be
+// reached through a Tor SOCKS5 proxy.
+func IsOnion(host string) bool {
+	return strings.HasSuffix(strings.ToLower(host), ".onion")
+}
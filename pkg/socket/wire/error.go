@@ -32,3 +32,17 @@ func (e *MessageError) Error() string {
 func messageError(f string, desc string) *MessageError {
 	return &MessageError{Func: f, Description: desc}
 }
+
+// PayloadError describes a message whose payload could not be used, such as
+// an unknown command, a mismatched checksum or a malformed payload. The
+// payload has been read or discarded in full, so the next message can still
+// be read from the stream.
+type PayloadError struct {
+	MessageError
+}
+
+// payloadError creates a payload error for the given function and
+// description.
+func payloadError(f string, desc string) *PayloadError {
+	return &PayloadError{MessageError{Func: f, Description: desc}}
+}
@@ -61,6 +61,8 @@ const (
 	CmdMNB          = "mnb"
 	CmdDESG         = "dseg"
 	CmdGovObj       = "govobj"
+	CmdSendAddrV2   = "sendaddrv2"
+	CmdAddrV2       = "addrv2"
 )
 
 // MessageEncoding represents the wire message encoding format to be used.
@@ -109,15 +111,30 @@ func makeEmptyMessage(command string) (Message, error) {
 	case CmdAddr:
 		msg = &MsgAddr{}
 
+	case CmdSendAddrV2:
+		msg = &MsgSendAddrV2{}
+
+	case CmdAddrV2:
+		msg = &MsgAddrV2{}
+
 	case CmdGetBlocks:
 		msg = &MsgGetBlocks{}
 
+	case CmdGetHeaders:
+		msg = &MsgGetHeaders{}
+
+	case CmdHeaders:
+		msg = &MsgHeaders{}
+
 	case CmdInv:
 		msg = &MsgInv{}
 
 	case CmdGetData:
 		msg = &MsgGetData{}
 
+	case CmdNotFound:
+		msg = &MsgNotFound{}
+
 	case CmdTx:
 		msg = &MsgTx{}
 
@@ -166,7 +183,7 @@ func readMessageHeader(r io.Reader) (int, *messageHeader, error) {
 	readElements(hr, &hdr.magic, &command, &hdr.length, &hdr.checksum)
 
 	// Strip trailing zeros from command string.
-	hdr.command = string(bytes.TrimRight(command[:], string(0)))
+	hdr.command = string(bytes.TrimRight(command[:], string(rune(0))))
 
 	return n, &hdr, nil
 }
@@ -285,7 +302,8 @@ func WriteMessageWithEncodingN(w io.Writer, msg Message, pver uint32,
 // number of bytes read in addition to the parsed Message and raw bytes which
 // comprise the message.  This function is the same as ReadMessageN except it
 // allows the caller to specify which message encoding is to to consult when
-// decoding wire messages.
+// decoding wire messages.  An mnp message is returned undecoded along with its
+// payload, see DecodeMNP.
 func ReadMessageWithEncodingN(r io.Reader, pver uint32, btcnet BitcoinNet,
 	enc MessageEncoding) (int, Message, []byte, error) {
 
@@ -296,7 +314,8 @@ func ReadMessageWithEncodingN(r io.Reader, pver uint32, btcnet BitcoinNet,
 		return totalBytes, nil, nil, err
 	}
 
-	// Enforce maximum message payload.
+	// Enforce maximum message payload.  The payload is left unread, the
+	// stream cannot be parsed any further.
 	if hdr.length > MaxMessagePayload {
 		str := fmt.Sprintf("message payload is too large - header "+
 			"indicates %d bytes, but max message payload is %d "+
@@ -317,14 +336,14 @@ func ReadMessageWithEncodingN(r io.Reader, pver uint32, btcnet BitcoinNet,
 	if !utf8.ValidString(command) {
 		discardInput(r, hdr.length)
 		str := fmt.Sprintf("invalid command %v", []byte(command))
-		return totalBytes, nil, nil, messageError("ReadMessage", str)
+		return totalBytes, nil, nil, payloadError("ReadMessage", str)
 	}
 
 	// Create struct of appropriate message type based on the command.
 	msg, err := makeEmptyMessage(command)
 	if err != nil {
 		discardInput(r, hdr.length)
-		return totalBytes, nil, nil, messageError("ReadMessage",
+		return totalBytes, nil, nil, payloadError("ReadMessage",
 			err.Error())
 	}
 
@@ -337,7 +356,7 @@ func ReadMessageWithEncodingN(r io.Reader, pver uint32, btcnet BitcoinNet,
 		str := fmt.Sprintf("payload exceeds max length - header "+
 			"indicates %v bytes, but max payload size for "+
 			"messages of type [%v] is %v.", hdr.length, command, mpl)
-		return totalBytes, nil, nil, messageError("ReadMessage", str)
+		return totalBytes, nil, nil, payloadError("ReadMessage", str)
 	}
 
 	// Read payload.
@@ -354,7 +373,13 @@ func ReadMessageWithEncodingN(r io.Reader, pver uint32, btcnet BitcoinNet,
 		str := fmt.Sprintf("payload checksum failed - header "+
 			"indicates %v, but actual checksum is %v.",
 			hdr.checksum, checksum)
-		return totalBytes, nil, nil, messageError("ReadMessage", str)
+		return totalBytes, nil, nil, payloadError("ReadMessage", str)
+	}
+
+	// The layout of a ping depends on the ping format of the coin, the
+	// caller decodes the payload with DecodeMNP.
+	if command == CmdMNP {
+		return totalBytes, msg, payload, nil
 	}
 
 	// Unmarshal message.  NOTE: This must be a *bytes.Buffer since the
@@ -362,7 +387,9 @@ func ReadMessageWithEncodingN(r io.Reader, pver uint32, btcnet BitcoinNet,
 	pr := bytes.NewBuffer(payload)
 	err = msg.BtcDecode(pr, pver, enc)
 	if err != nil {
-		return totalBytes, nil, nil, err
+		// The payload has been read in full, the connection is still usable.
+		str := fmt.Sprintf("malformed %v payload: %v", command, err)
+		return totalBytes, nil, nil, payloadError("ReadMessage", str)
 	}
 
 	return totalBytes, msg, payload, nil
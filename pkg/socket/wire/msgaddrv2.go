@@ -0,0 +1,323 @@
+// Copyright (c) 2013-2015 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// NetworkID identifies the network of an address in an addrv2 message as
+// described in BIP0155.
+type NetworkID uint8
+
+// Networks defined by BIP0155.
+const (
+	NetworkIPv4  NetworkID = 1
+	NetworkIPv6  NetworkID = 2
+	NetworkTorV2 NetworkID = 3
+	NetworkTorV3 NetworkID = 4
+	NetworkI2P   NetworkID = 5
+	NetworkCJDNS NetworkID = 6
+)
+
+// MaxAddrV2Size is the maximum length of the address of a single addrv2
+// entry.
+const MaxAddrV2Size = 512
+
+// addrV2Sizes maps the networks known by BIP0155 to their address length.
+var addrV2Sizes = map[NetworkID]int{
+	NetworkIPv4:  4,
+	NetworkIPv6:  16,
+	NetworkTorV2: 10,
+	NetworkTorV3: 32,
+	NetworkI2P:   32,
+	NetworkCJDNS: 16,
+}
+
+// torV3Version is the version byte of Tor v3 onion addresses.
+const torV3Version = 3
+
+// onionEncoding is the base32 alphabet used by .onion names.
+var onionEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NetAddressV2 is a single entry of an addrv2 message.
+type NetAddressV2 struct {
+	// Last time the address was seen.
+	Timestamp time.Time
+
+	// Bitfield which identifies the services supported by the address.
+	Services ServiceFlag
+
+	// Network the address belongs to.
+	Network NetworkID
+
+	// Addr is the raw address, its length depends on the network.
+	Addr []byte
+
+	// Port the peer is using, encoded in big endian on the wire.
+	Port uint16
+}
+
+// TorV3Host returns the .onion name of a Tor v3 public key.
+func TorV3Host(pubKey []byte) string {
+	checksum := torV3Checksum(pubKey)
+
+	name := make([]byte, 0, 35)
+	name = append(name, pubKey...)
+	name = append(name, checksum[:]...)
+	name = append(name, torV3Version)
+
+	return strings.ToLower(onionEncoding.EncodeToString(name)) + ".onion"
+}
+
+// torV3Checksum is the checksum of a Tor v3 onion name, the first two bytes
+// of SHA3-256(".onion checksum" | pubkey | version).
+func torV3Checksum(pubKey []byte) [2]byte {
+	hasher := sha3.New256()
+	hasher.Write([]byte(".onion checksum"))
+	hasher.Write(pubKey)
+	hasher.Write([]byte{torV3Version})
+
+	var checksum [2]byte
+	copy(checksum[:], hasher.Sum(nil))
+	return checksum
+}
+
+// parseTorV3Host returns the public key of a Tor v3 .onion name.
+func parseTorV3Host(host string) ([]byte, error) {
+	name := strings.TrimSuffix(strings.ToLower(host), ".onion")
+	if name == host || len(name) != 56 {
+		return nil, fmt.Errorf("%s is not a Tor v3 onion name", host)
+	}
+
+	decoded, err := onionEncoding.DecodeString(strings.ToUpper(name))
+	if err != nil || len(decoded) != 35 {
+		return nil, fmt.Errorf("%s is not a Tor v3 onion name", host)
+	}
+
+	pubKey := decoded[:32]
+	checksum := torV3Checksum(pubKey)
+	if decoded[32] != checksum[0] || decoded[33] != checksum[1] || decoded[34] != torV3Version {
+		return nil, fmt.Errorf("%s has an invalid onion checksum", host)
+	}
+
+	return pubKey, nil
+}
+
+// NetAddress converts the entry to a NetAddress.  IPv4, IPv6 and Tor v3
+// addresses are supported, false is returned for the other networks since
+// they cannot be dialed.
+func (na *NetAddressV2) NetAddress() (*NetAddress, bool) {
+	addr := &NetAddress{
+		Timestamp: na.Timestamp,
+		Services:  na.Services,
+		Port:      na.Port,
+	}
+
+	switch na.Network {
+	case NetworkIPv4, NetworkIPv6:
+		addr.IP = net.IP(na.Addr)
+	case NetworkTorV3:
+		addr.Host = TorV3Host(na.Addr)
+	default:
+		return nil, false
+	}
+
+	return addr, true
+}
+
+// NewNetAddressV2 converts a NetAddress to an addrv2 entry.
+func NewNetAddressV2(na *NetAddress) (*NetAddressV2, error) {
+	addr := &NetAddressV2{
+		Timestamp: time.Unix(na.Timestamp.Unix(), 0),
+		Services:  na.Services,
+		Port:      na.Port,
+	}
+
+	switch {
+	case na.Host != "":
+		pubKey, err := parseTorV3Host(na.Host)
+		if err != nil {
+			return nil, err
+		}
+		addr.Network = NetworkTorV3
+		addr.Addr = pubKey
+	case na.IP.To4() != nil:
+		addr.Network = NetworkIPv4
+		addr.Addr = na.IP.To4()
+	case na.IP.To16() != nil:
+		addr.Network = NetworkIPv6
+		addr.Addr = na.IP.To16()
+	default:
+		return nil, fmt.Errorf("the address has neither an IP nor a host")
+	}
+
+	return addr, nil
+}
+
+// readNetAddressV2 reads an addrv2 entry from r.  Entries of known networks
+// with the wrong address length are rejected as required by BIP0155.
+func readNetAddressV2(r io.Reader, pver uint32, na *NetAddressV2) error {
+	err := readElement(r, (*uint32Time)(&na.Timestamp))
+	if err != nil {
+		return err
+	}
+
+	services, err := ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+	na.Services = ServiceFlag(services)
+
+	err = readElement(r, (*uint8)(&na.Network))
+	if err != nil {
+		return err
+	}
+
+	na.Addr, err = ReadVarBytes(r, pver, MaxAddrV2Size, "addrv2 address")
+	if err != nil {
+		return err
+	}
+
+	if size, ok := addrV2Sizes[na.Network]; ok && len(na.Addr) != size {
+		str := fmt.Sprintf("invalid address length for network %d "+
+			"[length %v, expected %v]", na.Network, len(na.Addr), size)
+		return messageError("readNetAddressV2", str)
+	}
+
+	// Sigh.  Bitcoin protocol mixes little and big endian.
+	na.Port, err = binarySerializer.Uint16(r, bigEndian)
+	return err
+}
+
+// writeNetAddressV2 writes an addrv2 entry to w.
+func writeNetAddressV2(w io.Writer, pver uint32, na *NetAddressV2) error {
+	err := writeElement(w, uint32(na.Timestamp.Unix()))
+	if err != nil {
+		return err
+	}
+
+	err = WriteVarInt(w, pver, uint64(na.Services))
+	if err != nil {
+		return err
+	}
+
+	err = writeElement(w, uint8(na.Network))
+	if err != nil {
+		return err
+	}
+
+	err = WriteVarBytes(w, pver, na.Addr)
+	if err != nil {
+		return err
+	}
+
+	return binary.Write(w, bigEndian, na.Port)
+}
+
+// MsgAddrV2 implements the Message interface and represents an addrv2
+// message as described in BIP0155.  It replaces the addr message for peers
+// that sent a sendaddrv2 message and can relay Tor v3 addresses.
+type MsgAddrV2 struct {
+	AddrList []*NetAddressV2
+}
+
+// AddAddress adds a known active peer to the message.
+func (msg *MsgAddrV2) AddAddress(na *NetAddressV2) error {
+	if len(msg.AddrList)+1 > MaxAddrPerMsg {
+		str := fmt.Sprintf("too many addresses in message [max %v]",
+			MaxAddrPerMsg)
+		return messageError("MsgAddrV2.AddAddress", str)
+	}
+
+	msg.AddrList = append(msg.AddrList, na)
+	return nil
+}
+
+// BtcDecode decodes r using the bitcoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgAddrV2) BtcDecode(r io.Reader, pver uint32, enc MessageEncoding) error {
+	count, err := ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+
+	// Limit to max addresses per message.
+	if count > MaxAddrPerMsg {
+		str := fmt.Sprintf("too many addresses for message "+
+			"[count %v, max %v]", count, MaxAddrPerMsg)
+		return messageError("MsgAddrV2.BtcDecode", str)
+	}
+
+	addrList := make([]NetAddressV2, count)
+	msg.AddrList = make([]*NetAddressV2, 0, count)
+	for i := uint64(0); i < count; i++ {
+		na := &addrList[i]
+		err := readNetAddressV2(r, pver, na)
+		if err != nil {
+			return err
+		}
+		msg.AddAddress(na)
+	}
+	return nil
+}
+
+// BtcEncode encodes the receiver to w using the bitcoin protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgAddrV2) BtcEncode(w io.Writer, pver uint32, enc MessageEncoding) error {
+	count := len(msg.AddrList)
+	if count > MaxAddrPerMsg {
+		str := fmt.Sprintf("too many addresses for message "+
+			"[count %v, max %v]", count, MaxAddrPerMsg)
+		return messageError("MsgAddrV2.BtcEncode", str)
+	}
+
+	err := WriteVarInt(w, pver, uint64(count))
+	if err != nil {
+		return err
+	}
+
+	for _, na := range msg.AddrList {
+		err = writeNetAddressV2(w, pver, na)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgAddrV2) Command() string {
+	return CmdAddrV2
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgAddrV2) MaxPayloadLength(pver uint32) uint32 {
+	// Timestamp 4 bytes + services varint + network 1 byte + address
+	// varint and bytes + port 2 bytes.
+	entry := uint32(4 + MaxVarIntPayload + 1 + MaxVarIntPayload + MaxAddrV2Size + 2)
+
+	// Num addresses (varInt) + max allowed addresses.
+	return MaxVarIntPayload + (MaxAddrPerMsg * entry)
+}
+
+// NewMsgAddrV2 returns a new addrv2 message that conforms to the Message
+// interface.
+func NewMsgAddrV2() *MsgAddrV2 {
+	return &MsgAddrV2{
+		AddrList: make([]*NetAddressV2, 0, MaxAddrPerMsg),
+	}
+}
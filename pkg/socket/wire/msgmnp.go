@@ -5,11 +5,62 @@
 package wire
 
 import (
+	"bytes"
+	"fmt"
 	"io"
+	"strings"
 
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 )
 
+// PingFormat selects the serialization and the signature of the masternode
+// pings, which differ between the coin families.
+type PingFormat uint8
+
+const (
+	// PingFormatLegacy sends the collateral as a CTxIn and signs the
+	// "CTxIn(COutPoint(...), scriptSig=)" string message.
+	PingFormatLegacy PingFormat = iota
+
+	// PingFormatHash sends the collateral outpoint and signs the hash of
+	// the serialized ping, as done by the coins derived from Dash 12.3.
+	PingFormatHash
+
+	// PingFormatPIVX sends the collateral as a CTxIn followed by the
+	// message version and signs the hash of the ping.
+	PingFormatPIVX
+)
+
+// PingFormats lists the names of the ping formats, indexed by PingFormat.
+var PingFormats = []string{"legacy-string", "hash-based", "pivx"}
+
+func (format PingFormat) String() string {
+	if int(format) < len(PingFormats) {
+		return PingFormats[format]
+	}
+	return fmt.Sprintf("PingFormat(%d)", uint8(format))
+}
+
+// ParsePingFormat returns the ping format with the given name, an empty
+// name is the legacy format.
+func ParsePingFormat(name string) (PingFormat, error) {
+	if name == "" {
+		return PingFormatLegacy, nil
+	}
+
+	for i, format := range PingFormats {
+		if strings.EqualFold(name, format) {
+			return PingFormat(i), nil
+		}
+	}
+
+	return PingFormatLegacy, fmt.Errorf("unknown ping format %q", name)
+}
+
+// PingMessageVersionHash is the PIVX message version of the pings signing
+// their hash.
+const PingMessageVersionHash = 1
+
 // MsgPong implements the Message interface and represents a bitcoin pong
 // message which is used primarily to confirm that a connection is still valid
 // in response to a bitcoin ping message (MsgPing).
@@ -27,6 +78,11 @@ type MsgMNP struct {
 	SentinelVersion   uint32
 	DaemonEnabled     bool
 	DaemonVersion     uint32
+
+	// Format selects the serialization, MessageVersion is only part of
+	// the PIVX format.
+	Format         PingFormat
+	MessageVersion int32
 }
 
 // BtcDecode decodes r using the bitcoin protocol encoding into the receiver.
@@ -40,6 +96,13 @@ func (msg *MsgMNP) BtcDecode(r io.Reader, pver uint32, enc MessageEncoding) erro
 	//	return messageError("MsgPong.BtcDecode", str)
 	//}
 
+	switch msg.Format {
+	case PingFormatHash:
+		return msg.decodeHash(r, pver)
+	case PingFormatPIVX:
+		return msg.decodePIVX(r, pver)
+	}
+
 	//read the tx
 	err := readTxIn(r, pver, 0, &msg.Vin)
 	if err != nil {
@@ -79,6 +142,13 @@ func (msg *MsgMNP) BtcDecode(r io.Reader, pver uint32, enc MessageEncoding) erro
 // This is part of the Message interface implementation.
 func (msg *MsgMNP) BtcEncode(w io.Writer, pver uint32, enc MessageEncoding) error {
 
+	switch msg.Format {
+	case PingFormatHash:
+		return msg.encodeHash(w, pver)
+	case PingFormatPIVX:
+		return msg.encodePIVX(w, pver)
+	}
+
 	writeTxIn(w, pver, 0, &msg.Vin)
 
 	_, err := w.Write(msg.BlockHash[:])
@@ -103,6 +173,217 @@ func (msg *MsgMNP) BtcEncode(w io.Writer, pver uint32, enc MessageEncoding) erro
 	return err
 }
 
+// DecodeMNP decodes the payload of a received mnp message in the format of
+// the coin. The optional sentinel and daemon fields of the legacy format are
+// detected from the payload length.
+func DecodeMNP(payload []byte, pver uint32, format PingFormat) (*MsgMNP, error) {
+	msg := &MsgMNP{Format: format}
+
+	r := bytes.NewReader(payload)
+	if err := msg.BtcDecode(r, pver, BaseEncoding); err != nil {
+		return nil, err
+	}
+
+	//sentinel is current (1) and sentinel version (4), then daemon version (4)
+	if format != PingFormatLegacy || r.Len() < 5 {
+		return msg, nil
+	}
+
+	msg = &MsgMNP{
+		Format:          format,
+		SentinelEnabled: true,
+		DaemonEnabled:   r.Len() >= 9,
+	}
+	if err := msg.BtcDecode(bytes.NewReader(payload), pver, BaseEncoding); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+// decodeHash reads a ping of the hash-based format. The sentinel and daemon
+// fields are optional, older peers stop after the signature.
+func (msg *MsgMNP) decodeHash(r io.Reader, pver uint32) error {
+	err := readOutPoint(r, pver, 0, &msg.Vin.PreviousOutPoint)
+	if err != nil {
+		return err
+	}
+	msg.Vin.Sequence = MaxTxInSequenceNum
+
+	_, err = io.ReadFull(r, msg.BlockHash[:])
+	if err != nil {
+		return err
+	}
+
+	msg.SigTime, err = binarySerializer.Uint64(r, littleEndian)
+	if err != nil {
+		return err
+	}
+
+	msg.VchSig, err = ReadVarBytes(r, pver, MaxMessagePayload, "vchSig")
+	if err != nil {
+		return err
+	}
+
+	err = readElement(r, &msg.SentinelIsCurrent)
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	msg.SentinelVersion, err = binarySerializer.Uint32(r, littleEndian)
+	if err != nil {
+		return err
+	}
+	msg.SentinelEnabled = true
+
+	msg.DaemonVersion, err = binarySerializer.Uint32(r, littleEndian)
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	msg.DaemonEnabled = true
+
+	return nil
+}
+
+// encodeHash writes a ping of the hash-based format, the sentinel and daemon
+// fields are always sent.
+func (msg *MsgMNP) encodeHash(w io.Writer, pver uint32) error {
+	err := writeOutPoint(w, pver, 0, &msg.Vin.PreviousOutPoint)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(msg.BlockHash[:])
+	if err != nil {
+		return err
+	}
+
+	err = writeElement(w, msg.SigTime)
+	if err != nil {
+		return err
+	}
+
+	err = WriteVarBytes(w, pver, msg.VchSig)
+	if err != nil {
+		return err
+	}
+
+	return writeElements(w, msg.SentinelIsCurrent, msg.SentinelVersion, msg.DaemonVersion)
+}
+
+// decodePIVX reads a ping of the PIVX format, pings without a message
+// version are string signed.
+func (msg *MsgMNP) decodePIVX(r io.Reader, pver uint32) error {
+	err := readTxIn(r, pver, 0, &msg.Vin)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.ReadFull(r, msg.BlockHash[:])
+	if err != nil {
+		return err
+	}
+
+	msg.SigTime, err = binarySerializer.Uint64(r, littleEndian)
+	if err != nil {
+		return err
+	}
+
+	msg.VchSig, err = ReadVarBytes(r, pver, MaxMessagePayload, "vchSig")
+	if err != nil {
+		return err
+	}
+
+	err = readElement(r, &msg.MessageVersion)
+	if err == io.EOF {
+		msg.MessageVersion = 0
+		return nil
+	}
+
+	return err
+}
+
+// encodePIVX writes a ping of the PIVX format.
+func (msg *MsgMNP) encodePIVX(w io.Writer, pver uint32) error {
+	err := writeTxIn(w, pver, 0, &msg.Vin)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(msg.BlockHash[:])
+	if err != nil {
+		return err
+	}
+
+	err = writeElement(w, msg.SigTime)
+	if err != nil {
+		return err
+	}
+
+	err = WriteVarBytes(w, pver, msg.VchSig)
+	if err != nil {
+		return err
+	}
+
+	return writeElement(w, msg.MessageVersion)
+}
+
+// SignatureHash returns the hash signed by the masternode key in the
+// hash-based and PIVX formats, the legacy format signs a string message
+// instead. The PIVX pings without a message version leave the block hash
+// out, their hash only identifies them.
+func (msg *MsgMNP) SignatureHash() chainhash.Hash {
+	var buf bytes.Buffer
+
+	if msg.Format == PingFormatPIVX {
+		writeTxIn(&buf, 0, 0, &msg.Vin)
+		if msg.MessageVersion == PingMessageVersionHash {
+			buf.Write(msg.BlockHash[:])
+		}
+		writeElement(&buf, msg.SigTime)
+
+		return chainhash.DoubleHashH(buf.Bytes())
+	}
+
+	writeOutPoint(&buf, 0, 0, &msg.Vin.PreviousOutPoint)
+	buf.Write(msg.BlockHash[:])
+	writeElements(&buf, msg.SigTime, msg.SentinelIsCurrent, msg.SentinelVersion, msg.DaemonVersion)
+
+	return chainhash.DoubleHashH(buf.Bytes())
+}
+
+// InvHash returns the hash the ping is announced and requested with.
+func (msg *MsgMNP) InvHash() chainhash.Hash {
+	switch msg.Format {
+	case PingFormatHash:
+		return msg.hash()
+	case PingFormatPIVX:
+		return msg.SignatureHash()
+	}
+
+	var buf bytes.Buffer
+	msg.Serialize(&buf)
+
+	return chainhash.DoubleHashH(buf.Bytes())
+}
+
+// hash is GetHash of the Dash 12.3 pings, which does not match their
+// serialization: the outpoint is followed by an empty scriptSig and a final
+// sequence, then only the sigTime.
+func (msg *MsgMNP) hash() chainhash.Hash {
+	var buf bytes.Buffer
+	writeOutPoint(&buf, 0, 0, &msg.Vin.PreviousOutPoint)
+	writeElements(&buf, uint8(0), MaxTxInSequenceNum, msg.SigTime)
+
+	return chainhash.DoubleHashH(buf.Bytes())
+}
+
 func (msg *MsgMNP) Serialize(w io.Writer) error {
 	// At the current time, there is no difference between the wire encoding
 	// at protocol version 0 and the stable long-term storage format.  As
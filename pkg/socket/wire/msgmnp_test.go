@@ -0,0 +1,215 @@
+// Copyright (c) 2013-2015 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// pingSignature is the compact signature carried by the test pings, the
+// hashes do not depend on it.
+const pingSignature = "1f0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f" +
+	"202122232425262728292a2b2c2d2e2f303132333435363738393a3b3c3d3e3f40"
+
+// mnpPayload is a ping laid out as the daemons of the coin family serialize
+// it, with the data they sign and announce it with.
+type mnpPayload struct {
+	name    string
+	format  PingFormat
+	payload string
+
+	collateral string
+	index      uint32
+	blockHash  string
+	sigTime    uint64
+
+	sentinelIsCurrent bool
+	sentinelVersion   uint32
+	daemonVersion     uint32
+	messageVersion    int32
+
+	// signedFields and invFields are the fields the daemons write to the
+	// hash writer of GetSignatureHash and GetHash, in their order.
+	signedFields string
+	invFields    string
+}
+
+var mnpPayloads = []mnpPayload{
+	{
+		name:   "Dash 12.3",
+		format: PingFormatHash,
+		payload: "807f6e5d4c3b2a1908f7e6d5c4b3a291807f6e5d4c3b2a1908f7e6d5c4b3a2f1" + // collateral hash
+			"01000000" + // collateral index
+			"b67a40f3cd5804437a108f105533739c37e6229bc1adcab385140b59fd0f0000" + // block hash
+			"80ad2a5c00000000" + // sigTime
+			"41" + pingSignature +
+			"01" + // fSentinelIsCurrent
+			"01000100" + // nSentinelVersion
+			"ecd50100", // nDaemonVersion
+		collateral:        "f1a2b3c4d5e6f708192a3b4c5d6e7f8091a2b3c4d5e6f708192a3b4c5d6e7f80",
+		index:             1,
+		blockHash:         "00000ffd590b1485b3caadc19b22e6379c733355108f107a430458cdf3407ab6",
+		sigTime:           1546300800,
+		sentinelIsCurrent: true,
+		sentinelVersion:   0x010001,
+		daemonVersion:     120300,
+		signedFields: "807f6e5d4c3b2a1908f7e6d5c4b3a291807f6e5d4c3b2a1908f7e6d5c4b3a2f101000000" + // masternodeOutpoint
+			"b67a40f3cd5804437a108f105533739c37e6229bc1adcab385140b59fd0f0000" + // blockHash
+			"80ad2a5c00000000" + // sigTime
+			"01" + "01000100" + "ecd50100", // fSentinelIsCurrent, nSentinelVersion, nDaemonVersion
+		invFields: "807f6e5d4c3b2a1908f7e6d5c4b3a291807f6e5d4c3b2a1908f7e6d5c4b3a2f101000000" + // masternodeOutpoint
+			"00" + "ffffffff" + // the dummy scriptSig and sequence of the old hashing format
+			"80ad2a5c00000000", // sigTime
+	},
+	{
+		name:   "PIVX",
+		format: PingFormatPIVX,
+		payload: "f9e8d7c6b5a4938271605f4e3d2c1b0af9e8d7c6b5a4938271605f4e3d2c1b0a" + // collateral hash
+			"00000000" + // collateral index
+			"00" + // scriptSig
+			"ffffffff" + // sequence
+			"18f80e68784ac79737df761bc38e0b5c407384b4ef8ed991969b2b481e040000" + // block hash
+			"00e10b5e00000000" + // sigTime
+			"41" + pingSignature +
+			"01000000", // nMessVersion
+		collateral:     "0a1b2c3d4e5f60718293a4b5c6d7e8f90a1b2c3d4e5f60718293a4b5c6d7e8f9",
+		blockHash:      "0000041e482b9b9691d98eefb48473405c0b8ec31b76df3797c74a78680ef818",
+		sigTime:        1577836800,
+		messageVersion: PingMessageVersionHash,
+		signedFields: "f9e8d7c6b5a4938271605f4e3d2c1b0af9e8d7c6b5a4938271605f4e3d2c1b0a0000000000ffffffff" + // vin
+			"18f80e68784ac79737df761bc38e0b5c407384b4ef8ed991969b2b481e040000" + // blockHash
+			"00e10b5e00000000", // sigTime
+		invFields: "f9e8d7c6b5a4938271605f4e3d2c1b0af9e8d7c6b5a4938271605f4e3d2c1b0a0000000000ffffffff" + // vin
+			"18f80e68784ac79737df761bc38e0b5c407384b4ef8ed991969b2b481e040000" + // blockHash
+			"00e10b5e00000000", // sigTime
+	},
+	{
+		name:   "PIVX string signed",
+		format: PingFormatPIVX,
+		payload: "f9e8d7c6b5a4938271605f4e3d2c1b0af9e8d7c6b5a4938271605f4e3d2c1b0a" + // collateral hash
+			"00000000" + // collateral index
+			"00" + // scriptSig
+			"ffffffff" + // sequence
+			"18f80e68784ac79737df761bc38e0b5c407384b4ef8ed991969b2b481e040000" + // block hash
+			"00e10b5e00000000" + // sigTime
+			"41" + pingSignature, // no nMessVersion
+		collateral: "0a1b2c3d4e5f60718293a4b5c6d7e8f90a1b2c3d4e5f60718293a4b5c6d7e8f9",
+		blockHash:  "0000041e482b9b9691d98eefb48473405c0b8ec31b76df3797c74a78680ef818",
+		sigTime:    1577836800,
+		invFields: "f9e8d7c6b5a4938271605f4e3d2c1b0af9e8d7c6b5a4938271605f4e3d2c1b0a0000000000ffffffff" + // vin
+			"00e10b5e00000000", // sigTime, without the blockHash of the hash signed pings
+	},
+}
+
+// hashFields returns the double SHA-256 of the hex encoded fields, as
+// CHashWriter computes it.
+func hashFields(t *testing.T, fields string) chainhash.Hash {
+	data, err := hex.DecodeString(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := sha256.Sum256(data)
+	return chainhash.Hash(sha256.Sum256(first[:]))
+}
+
+func TestDecodeMNP(t *testing.T) {
+	for _, p := range mnpPayloads {
+		payload, err := hex.DecodeString(p.payload)
+		if err != nil {
+			t.Fatalf("%s: %v", p.name, err)
+		}
+
+		msg, err := DecodeMNP(payload, ProtocolVersion, p.format)
+		if err != nil {
+			t.Errorf("%s: %v", p.name, err)
+			continue
+		}
+
+		outPoint := msg.Vin.PreviousOutPoint
+		if outPoint.Hash.String() != p.collateral || outPoint.Index != p.index {
+			t.Errorf("%s: collateral %v, want %s:%d", p.name, outPoint, p.collateral, p.index)
+		}
+		if msg.BlockHash.String() != p.blockHash {
+			t.Errorf("%s: block hash %s, want %s", p.name, msg.BlockHash, p.blockHash)
+		}
+		if msg.SigTime != p.sigTime {
+			t.Errorf("%s: sigTime %d, want %d", p.name, msg.SigTime, p.sigTime)
+		}
+		if hex.EncodeToString(msg.VchSig) != pingSignature {
+			t.Errorf("%s: signature %x", p.name, msg.VchSig)
+		}
+		if msg.SentinelIsCurrent != p.sentinelIsCurrent || msg.SentinelVersion != p.sentinelVersion || msg.DaemonVersion != p.daemonVersion {
+			t.Errorf("%s: sentinel %v %x, daemon %d", p.name, msg.SentinelIsCurrent, msg.SentinelVersion, msg.DaemonVersion)
+		}
+		if msg.MessageVersion != p.messageVersion {
+			t.Errorf("%s: message version %d, want %d", p.name, msg.MessageVersion, p.messageVersion)
+		}
+
+		if p.signedFields != "" {
+			want := hashFields(t, p.signedFields)
+			if hash := msg.SignatureHash(); hash != want {
+				t.Errorf("%s: signature hash %s, want %s", p.name, hash, want)
+			}
+		}
+		want := hashFields(t, p.invFields)
+		if hash := msg.InvHash(); hash != want {
+			t.Errorf("%s: inv hash %s, want %s", p.name, hash, want)
+		}
+	}
+}
+
+// TestEncodeMNP checks that the pings sent by phantom are serialized as the
+// daemons expect them.
+func TestEncodeMNP(t *testing.T) {
+	for _, p := range mnpPayloads {
+		if p.format == PingFormatPIVX && p.messageVersion != PingMessageVersionHash {
+			continue
+		}
+
+		payload, _ := hex.DecodeString(p.payload)
+		msg, err := DecodeMNP(payload, ProtocolVersion, p.format)
+		if err != nil {
+			t.Fatalf("%s: %v", p.name, err)
+		}
+
+		var buf bytes.Buffer
+		if err := msg.BtcEncode(&buf, ProtocolVersion, BaseEncoding); err != nil {
+			t.Fatalf("%s: %v", p.name, err)
+		}
+		if !bytes.Equal(buf.Bytes(), payload) {
+			t.Errorf("%s: encoded %x, want %x", p.name, buf.Bytes(), payload)
+		}
+	}
+}
+
+// TestDecodeMNPOptionalFields checks the Dash pings of the peers stopping
+// before the sentinel or the daemon fields.
+func TestDecodeMNPOptionalFields(t *testing.T) {
+	payload, _ := hex.DecodeString(mnpPayloads[0].payload)
+	withoutDaemon := len(payload) - 4
+	withoutSentinel := withoutDaemon - 5
+
+	msg, err := DecodeMNP(payload[:withoutDaemon], ProtocolVersion, PingFormatHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !msg.SentinelEnabled || msg.DaemonEnabled || msg.SentinelVersion != 0x010001 {
+		t.Errorf("without the daemon version: sentinel %v %x, daemon %v", msg.SentinelEnabled, msg.SentinelVersion, msg.DaemonEnabled)
+	}
+
+	msg, err = DecodeMNP(payload[:withoutSentinel], ProtocolVersion, PingFormatHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.SentinelEnabled || msg.DaemonEnabled || hex.EncodeToString(msg.VchSig) != pingSignature {
+		t.Errorf("without the sentinel: sentinel %v, daemon %v, signature %x", msg.SentinelEnabled, msg.DaemonEnabled, msg.VchSig)
+	}
+}
@@ -41,6 +41,11 @@ type NetAddress struct {
 	// IP address of the peer.
 	IP net.IP
 
+	// Host is set instead of IP for peers that are only reachable by name,
+	// such as Tor .onion addresses learned from addrv2 messages.  It is
+	// never encoded on the wire by the legacy address format.
+	Host string
+
 	// Port the peer is using.  This is encoded in big endian on the wire
 	// which differs from most everything else.
 	Port uint16
@@ -51,6 +56,15 @@ func (na *NetAddress) HasService(service ServiceFlag) bool {
 	return na.Services&service == service
 }
 
+// Hostname returns the host the peer can be reached at, the onion name for
+// Tor peers or the IP address otherwise.
+func (na *NetAddress) Hostname() string {
+	if na.Host != "" {
+		return na.Host
+	}
+	return na.IP.String()
+}
+
 // AddService adds service as a supported service by the peer generating the
 // message.
 func (na *NetAddress) AddService(service ServiceFlag) {
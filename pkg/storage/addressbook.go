@@ -0,0 +1,316 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/TrueNodes/bbolt"
+)
+
+// PeerRecord is what the address book knows about a single ip:port.
+type PeerRecord struct {
+	Address         string    `json:"address"`
+	FirstSeen       time.Time `json:"first_seen"`
+	LastSeen        time.Time `json:"last_seen"`
+	LastAttempt     time.Time `json:"last_attempt"`
+	LastSuccess     time.Time `json:"last_success"`
+	Failures        int       `json:"failures"`
+	Services        uint64    `json:"services"`
+	ProtocolVersion uint32    `json:"protocol_version,omitempty"`
+	UserAgent       string    `json:"user_agent,omitempty"`
+}
+
+// AddressBook persists the peers of a single network, one record per ip:port,
+// in the network bucket of the shared peers bucket. Like the addrman of the
+// nodes it holds at most maxPeers records, the worst ones are evicted to make
+// room for the new addresses.
+type AddressBook struct {
+	db       *bbolt.DB
+	network  string
+	maxPeers int
+
+	mutex sync.Mutex
+	count int
+}
+
+// NewAddressBook opens the address book of the network, maxPeers <= 0 means
+// no limit.
+func NewAddressBook(db *bbolt.DB, network string, maxPeers int) (*AddressBook, error) {
+	if err := InitialiseNetworkBucket(db, network); err != nil {
+		return nil, err
+	}
+
+	book := &AddressBook{db: db, network: network, maxPeers: maxPeers}
+
+	err := db.View(func(tx *bbolt.Tx) error {
+		book.count = book.bucket(tx).Stats().KeyN
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return book, nil
+}
+
+func (b *AddressBook) bucket(tx *bbolt.Tx) *bbolt.Bucket {
+	return tx.Bucket([]byte("peers")).Bucket([]byte(b.network))
+}
+
+// update loads the record of the address, lets fn modify it and stores it.
+// Updates are batched since addr messages come with many addresses at once.
+func (b *AddressBook) update(address string, fn func(record *PeerRecord)) error {
+	if err := b.makeRoom(); err != nil {
+		return err
+	}
+
+	created := false
+	err := b.db.Batch(func(tx *bbolt.Tx) error {
+		bucket := b.bucket(tx)
+
+		record := PeerRecord{Address: address}
+		data := bucket.Get([]byte(address))
+		//a batch may be run again, the last run is the one committed
+		created = data == nil
+		if data != nil {
+			//a corrupted record is simply replaced
+			json.Unmarshal(data, &record)
+			record.Address = address
+		}
+
+		fn(&record)
+
+		data, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+
+		return bucket.Put([]byte(address), data)
+	})
+
+	if err == nil && created {
+		b.mutex.Lock()
+		b.count++
+		b.mutex.Unlock()
+	}
+
+	return err
+}
+
+// Len returns the number of records.
+func (b *AddressBook) Len() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.count
+}
+
+// makeRoom evicts the worst records once the address book is full, down to
+// nine tenths of maxPeers so the records are not sorted for every address.
+func (b *AddressBook) makeRoom() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.maxPeers <= 0 || b.count < b.maxPeers {
+		return nil
+	}
+
+	keep := b.maxPeers * 9 / 10
+
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		bucket := b.bucket(tx)
+
+		var records []PeerRecord
+		var corrupted [][]byte
+		err := bucket.ForEach(func(key []byte, value []byte) error {
+			var record PeerRecord
+			if err := json.Unmarshal(value, &record); err != nil || record.Address == "" {
+				corrupted = append(corrupted, append([]byte(nil), key...))
+				return nil
+			}
+			records = append(records, record)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		//the best records first, the tail is evicted
+		sort.Slice(records, func(i, j int) bool {
+			return betterRecord(records[i], records[j])
+		})
+
+		stale := corrupted
+		for i := keep; i < len(records); i++ {
+			stale = append(stale, []byte(records[i].Address))
+		}
+
+		for _, key := range stale {
+			if err := bucket.Delete(key); err != nil {
+				return fmt.Errorf("DB: Could not evict %s: %v", key, err)
+			}
+		}
+
+		b.count = len(records) + len(corrupted) - len(stale)
+		return nil
+	})
+}
+
+// betterRecord tells whether a is worth keeping over b, like the nodes the
+// peers we reached are preferred, then the ones failing less, then the most
+// recently active.
+func betterRecord(a PeerRecord, b PeerRecord) bool {
+	if a.LastSuccess.IsZero() != b.LastSuccess.IsZero() {
+		return !a.LastSuccess.IsZero()
+	}
+	if a.Failures != b.Failures {
+		return a.Failures < b.Failures
+	}
+	return lastActive(a).After(lastActive(b))
+}
+
+func lastActive(record PeerRecord) time.Time {
+	if record.LastSuccess.After(record.LastSeen) {
+		return record.LastSuccess
+	}
+	return record.LastSeen
+}
+
+// Seen records an address advertised by a peer.
+func (b *AddressBook) Seen(address string, services uint64, timestamp time.Time) error {
+	now := time.Now().UTC()
+	if timestamp.IsZero() || timestamp.After(now) {
+		timestamp = now
+	}
+
+	return b.update(address, func(record *PeerRecord) {
+		if record.FirstSeen.IsZero() {
+			record.FirstSeen = now
+		}
+		if timestamp.After(record.LastSeen) {
+			record.LastSeen = timestamp.UTC()
+		}
+		if services != 0 {
+			record.Services = services
+		}
+	})
+}
+
+// Attempt records a connection attempt to the address.
+func (b *AddressBook) Attempt(address string) error {
+	return b.update(address, func(record *PeerRecord) {
+		now := time.Now().UTC()
+		if record.FirstSeen.IsZero() {
+			record.FirstSeen = now
+			record.LastSeen = now
+		}
+		record.LastAttempt = now
+	})
+}
+
+// Success records a completed version handshake and resets the failures.
+func (b *AddressBook) Success(address string, services uint64, protocolVersion uint32, userAgent string) error {
+	return b.update(address, func(record *PeerRecord) {
+		now := time.Now().UTC()
+		if record.FirstSeen.IsZero() {
+			record.FirstSeen = now
+		}
+		record.LastSeen = now
+		record.LastSuccess = now
+		record.Failures = 0
+		record.Services = services
+		record.ProtocolVersion = protocolVersion
+		record.UserAgent = userAgent
+	})
+}
+
+// Failure records a failed connection or handshake.
+func (b *AddressBook) Failure(address string) error {
+	return b.update(address, func(record *PeerRecord) {
+		if record.FirstSeen.IsZero() {
+			now := time.Now().UTC()
+			record.FirstSeen = now
+			record.LastSeen = now
+		}
+		record.Failures++
+	})
+}
+
+// Peers returns every record, the most recently successful first.
+func (b *AddressBook) Peers() ([]PeerRecord, error) {
+	var records []PeerRecord
+
+	err := b.db.View(func(tx *bbolt.Tx) error {
+		return b.bucket(tx).ForEach(func(key []byte, value []byte) error {
+			var record PeerRecord
+			if err := json.Unmarshal(value, &record); err != nil || record.Address == "" {
+				return nil //skip the records of older versions
+			}
+			records = append(records, record)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		if !records[i].LastSuccess.Equal(records[j].LastSuccess) {
+			return records[i].LastSuccess.After(records[j].LastSuccess)
+		}
+		return records[i].LastSeen.After(records[j].LastSeen)
+	})
+
+	return records, nil
+}
+
+// Evict removes the peers that have not been seen nor reached for maxAge and
+// the peers that failed maxFailures times in a row. Records that can not be
+// decoded are removed as well. It returns the number of evicted peers.
+func (b *AddressBook) Evict(maxAge time.Duration, maxFailures int) (int, error) {
+	evicted := 0
+	cutoff := time.Now().UTC().Add(-maxAge)
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	err := b.db.Update(func(tx *bbolt.Tx) error {
+		bucket := b.bucket(tx)
+
+		var stale [][]byte
+		total := 0
+		err := bucket.ForEach(func(key []byte, value []byte) error {
+			total++
+
+			var record PeerRecord
+			if err := json.Unmarshal(value, &record); err != nil || record.Address == "" {
+				stale = append(stale, append([]byte(nil), key...))
+				return nil
+			}
+
+			if lastActive(record).Before(cutoff) || (maxFailures > 0 && record.Failures >= maxFailures) {
+				stale = append(stale, append([]byte(nil), key...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, key := range stale {
+			if err := bucket.Delete(key); err != nil {
+				return fmt.Errorf("DB: Could not evict %s: %v", key, err)
+			}
+			evicted++
+		}
+
+		//the count drifts when a batch fails, it is corrected here
+		b.count = total - evicted
+		return nil
+	})
+
+	return evicted, err
+}
@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/TrueNodes/bbolt"
+)
+
+// SaveState stores a value of a network in the state bucket, the previous
+// value of the key is replaced.
+func SaveState(db *bbolt.DB, network string, key string, value []byte) error {
+	return db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.Bucket([]byte("state")).CreateBucketIfNotExists([]byte(network))
+		if err != nil {
+			return fmt.Errorf("DB: Could not create %s state bucket: %v", network, err)
+		}
+
+		return bucket.Put([]byte(key), value)
+	})
+}
+
+// LoadState returns a value of a network stored by SaveState, or nil when the
+// key has never been saved.
+func LoadState(db *bbolt.DB, network string, key string) ([]byte, error) {
+	var value []byte
+
+	err := db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("state")).Bucket([]byte(network))
+		if bucket == nil {
+			return nil
+		}
+
+		if data := bucket.Get([]byte(key)); data != nil {
+			value = append([]byte(nil), data...)
+		}
+		return nil
+	})
+
+	return value, err
+}
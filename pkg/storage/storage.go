@@ -1,7 +1,6 @@
 package storage
 
 import (
-	"encoding/json"
 	"fmt"
 	"log"
 
@@ -21,6 +20,11 @@ func InitialiseDB(path string) (*bbolt.DB, error) {
 		} else {
 			log.Println("DB: Bucket created was created")
 		}
+
+		_, err = tx.CreateBucketIfNotExists([]byte("state"))
+		if err != nil {
+			return fmt.Errorf("DB: Could not create state bucket: %v", err)
+		}
 		return nil
 	})
 
@@ -33,41 +37,14 @@ func InitialiseDB(path string) (*bbolt.DB, error) {
 	return db, nil
 }
 
-func CachePeerToDB(db *bbolt.DB, peer string) error {
-	entry := peer
-	entryBytes, err := json.Marshal(entry)
-
-	if err != nil {
-		return err
-	}
-
-	err = db.Update(func(tx *bbolt.Tx) error {
-		err := tx.Bucket([]byte("peers")).Put([]byte("peer"), (entryBytes))
+// InitialiseNetworkBucket creates the bucket holding the peers of a single
+// coin network inside the shared peers bucket.
+func InitialiseNetworkBucket(db *bbolt.DB, network string) error {
+	return db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.Bucket([]byte("peers")).CreateBucketIfNotExists([]byte(network))
 		if err != nil {
-			return err
+			return fmt.Errorf("DB: Could not create %s bucket: %v", network, err)
 		}
-
-		return nil
-	})
-
-	log.Println("Peer added to cache", entry)
-	defer db.Close()
-
-	return err
-}
-
-func LoadPeersFromDB(db *bbolt.DB) error {
-	err := db.View(func(tx *bbolt.Tx) error {
-		peers := tx.Bucket([]byte("peers")).Get([]byte("peer"))
-		log.Println("Peers:\n", string(peers))
 		return nil
 	})
-
-	if err != nil {
-		return err
-	}
-
-	defer db.Close()
-
-	return nil
 }